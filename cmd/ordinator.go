@@ -1,29 +1,124 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	ctx "github.com/Alcereo/ordinator/pkg/context"
+	"github.com/fsnotify/fsnotify"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 	"gopkg.in/yaml.v2"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "validate" {
+		os.Exit(validateCommand(os.Args[2:]))
+	}
 
-	configInit()
-	config := loadConfig()
+	configReader := configInit()
+	config, err := loadConfig(configReader)
+	if err != nil {
+		panic(fmt.Errorf("Fatal error config file: %s \n", err))
+	}
 	setupLogging(config.LogLevel)
 
 	bytes, _ := yaml.Marshal(config)
 	log.Tracef("Resolved config:\n%+v", string(bytes))
 
-	context := ctx.NewContext()
-	context.SetupCache(config.CacheAdapters)
-	context.SetupRouters(config.Routers, config.GoogleSecret)
+	gateway := ctx.NewGateway()
+	if err := gateway.Apply(config); err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+	watchConfig(gateway, configReader.ConfigFileUsed())
+
+	if config.Metrics.Enabled {
+		metricsServer := ctx.BuildMetricsServer(config.Metrics)
+		log.Printf("Metrics server starting on port %v", config.Metrics.Port)
+		go func() {
+			log.Fatal(metricsServer.ListenAndServe())
+		}()
+	}
 
-	port := viper.GetInt("port")
+	port := configReader.GetInt("port")
 	log.Printf("Server starting on port %v", port)
-	log.Fatal(context.BuildServer(port).ListenAndServe())
+	log.Fatal(gateway.BuildServer(port).ListenAndServe())
+}
+
+// watchConfig reloads routers, filters and cache adapters when the config file changes or on SIGHUP.
+// Port and metrics settings require restart. Each reload reads the file into its own viper instance,
+// the watching one re-reads the file in its own goroutine.
+func watchConfig(gateway *ctx.Gateway, configFile string) {
+	var mutex sync.Mutex
+	reload := func(reason string) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		log.Infof("Reloading configuration. Reason: %v", reason)
+		configReader := newConfigReader()
+		configReader.SetConfigFile(configFile)
+		if err := configReader.ReadInConfig(); err != nil {
+			log.Errorf("Reading config file error, running configuration is kept. Reason: %v", err)
+			return
+		}
+		config, err := loadConfig(configReader)
+		if err != nil {
+			log.Errorf("Config file error, running configuration is kept. Reason: %v", err)
+			return
+		}
+		if err := gateway.Apply(config); err != nil {
+			log.Errorf("Running configuration is kept. Reason: %v", err)
+			return
+		}
+		setupLogging(config.LogLevel)
+	}
+
+	watcher := viper.New()
+	watcher.SetConfigFile(configFile)
+	watcher.OnConfigChange(func(event fsnotify.Event) {
+		reload("config file changed: " + event.Name)
+	})
+	watcher.WatchConfig()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		for range signals {
+			reload("SIGHUP")
+		}
+	}()
+}
+
+// validateCommand checks the config file without starting the server: 'ordinator validate --config config.yaml'.
+// Every problem is printed with its path in the file, or with the environment variable it comes from,
+// exit code is 1 when there are any.
+func validateCommand(args []string) int {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	configFile := flags.String("config", "config.yaml", "path to the config file")
+	_ = flags.Parse(args)
+
+	configReader := newConfigReader()
+	configReader.SetConfigFile(*configFile)
+	if err := configReader.ReadInConfig(); err != nil {
+		fmt.Fprintf(os.Stderr, "Reading config file error: %v\n", err)
+		return 1
+	}
+	config, err := loadConfig(configReader)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Config file error: %v\n", err)
+		return 1
+	}
+	if errors := ctx.Validate(config); len(errors) > 0 {
+		for _, err := range errors {
+			fmt.Fprintln(os.Stderr, err.Error())
+		}
+		fmt.Fprintf(os.Stderr, "%v: %v error(s) found\n", *configFile, len(errors))
+		return 1
+	}
+	fmt.Printf("%v: configuration is valid\n", *configFile)
+	return 0
 }
 
 func setupLogging(logLevel ctx.LogLevel) {
@@ -43,32 +138,41 @@ func setupLogging(logLevel ctx.LogLevel) {
 	}
 }
 
-func loadConfig() *ctx.ProxyConfiguration {
+func loadConfig(configReader *viper.Viper) (*ctx.ProxyConfiguration, error) {
 	var config ctx.ProxyConfiguration
-	err := viper.Unmarshal(&config)
+	err := configReader.Unmarshal(&config)
 	if err != nil {
-		panic(fmt.Errorf("Fatal error config file: %s \n", err))
+		return nil, err
 	}
 
-	viper.SetEnvPrefix("")
-	_ = viper.BindEnv("GOOGLE_CLIENT_ID")
-	config.GoogleSecret.ClientId = viper.GetString("GOOGLE_CLIENT_ID")
+	configReader.SetEnvPrefix("")
+	_ = configReader.BindEnv("GOOGLE_CLIENT_ID")
+	config.GoogleSecret.ClientId = configReader.GetString("GOOGLE_CLIENT_ID")
 
-	_ = viper.BindEnv("GOOGLE_CLIENT_SECRET")
-	config.GoogleSecret.ClientSecret = viper.GetString("GOOGLE_CLIENT_SECRET")
-	return &config
+	_ = configReader.BindEnv("GOOGLE_CLIENT_SECRET")
+	config.GoogleSecret.ClientSecret = configReader.GetString("GOOGLE_CLIENT_SECRET")
+	return &config, nil
 }
 
-func configInit() {
-	viper.SetConfigName("config")
-	viper.AddConfigPath(".")
-	viper.AddConfigPath("./cmd")
+func configInit() *viper.Viper {
+	configReader := newConfigReader()
+	configReader.SetConfigName("config")
+	configReader.AddConfigPath(".")
+	configReader.AddConfigPath("./cmd")
 
-	// Defaults
-	viper.SetDefault("port", 8080)
-
-	err := viper.ReadInConfig()
+	err := configReader.ReadInConfig()
 	if err != nil {
 		panic(fmt.Errorf("Fatal error config file: %s \n", err))
 	}
+	return configReader
+}
+
+func newConfigReader() *viper.Viper {
+	configReader := viper.New()
+
+	// Defaults
+	configReader.SetDefault("port", 8080)
+	configReader.SetDefault("metrics.port", 9090)
+	configReader.SetDefault("metrics.path", "/metrics")
+	return configReader
 }
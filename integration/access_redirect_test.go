@@ -19,10 +19,7 @@ var _ = Describe("UserAuthenticationFilter", func() {
 
 	It("get page when access accepted", func() {
 		client := buildClient()
-		resp, _ := getByClient(
-			client,
-			"http://localhost"+server.Addr+"/authentication/google?code=google-auth-code",
-		)
+		resp, _ := login(client, "/authentication/google", "google-auth-code")
 		Expect(resp.StatusCode).To(Equal(200))
 
 		resp, message := getByClient(client, "http://localhost"+server.Addr+"/pages/work-page")
@@ -10,6 +10,7 @@ import (
 	"log"
 	"net/http"
 	"net/http/cookiejar"
+	"net/url"
 )
 
 var _ = Describe("In ordinator gateway", func() {
@@ -30,7 +31,7 @@ var _ = Describe("In ordinator gateway", func() {
 	})
 
 	It("GoogleOauth2Authorization can authenticate in google", func() {
-		resp, message := get("http://localhost" + server.Addr + "/authentication/google?code=google-auth-code")
+		resp, message := login(buildClient(), "/authentication/google", "google-auth-code")
 		Expect(resp.StatusCode).To(Equal(200))
 
 		messageMap := unmarshalToMap(message)
@@ -38,8 +39,91 @@ var _ = Describe("In ordinator gateway", func() {
 		Expect(messageMap).To(HaveKeyWithValue("service", "resource"))
 		Expect(messageMap).To(HaveKeyWithValue("version", "v2"))
 	})
+
+	It("GoogleOauth2Authorization redirects to authorization endpoint with state and PKCE challenge", func() {
+		location := initiateLogin(buildClient(), "/authentication/google")
+		Expect(location.Path).To(Equal("/o/oauth2/v2/auth"))
+
+		query := location.Query()
+		Expect(query.Get("client_id")).To(Equal("google-client-id-1"))
+		Expect(query.Get("redirect_uri")).To(Equal("http://localhost:8080/authentication/google"))
+		Expect(query.Get("response_type")).To(Equal("code"))
+		Expect(query.Get("state")).NotTo(BeEmpty())
+		Expect(query.Get("code_challenge")).NotTo(BeEmpty())
+		Expect(query.Get("code_challenge_method")).To(Equal("S256"))
+	})
+
+	It("GoogleOauth2Authorization rejects callback without state", func() {
+		client := buildClient()
+		initiateLogin(client, "/authentication/google")
+
+		resp, _ := getByClient(client, "http://localhost"+server.Addr+"/authentication/google?code=google-auth-code")
+		Expect(resp.StatusCode).To(Equal(403))
+	})
+
+	It("GoogleOauth2Authorization rejects callback with wrong state", func() {
+		client := buildClient()
+		initiateLogin(client, "/authentication/google")
+
+		resp, _ := getByClient(
+			client,
+			"http://localhost"+server.Addr+"/authentication/google?code=google-auth-code&state=wrong-state",
+		)
+		Expect(resp.StatusCode).To(Equal(403))
+	})
+
+	It("GoogleOauth2Authorization rejects state initiated by another session", func() {
+		state := initiateLogin(buildClient(), "/authentication/google").Query().Get("state")
+
+		resp, _ := get("http://localhost" + server.Addr + "/authentication/google?code=google-auth-code&state=" + state)
+		Expect(resp.StatusCode).To(Equal(403))
+	})
+
+	It("GoogleOauth2Authorization rejects reused state", func() {
+		client := buildClient()
+		state := initiateLogin(client, "/authentication/google").Query().Get("state")
+
+		resp, _ := getByClient(
+			client,
+			"http://localhost"+server.Addr+"/authentication/google?error=access_denied&state="+state,
+		)
+		Expect(resp.StatusCode).To(Equal(403))
+
+		resp, _ = getByClient(
+			client,
+			"http://localhost"+server.Addr+"/authentication/google?code=google-auth-code&state="+state,
+		)
+		Expect(resp.StatusCode).To(Equal(403))
+	})
 })
 
+// login initiates authentication and calls back the gateway with the code, as a provider would do
+func login(client *http.Client, path string, code string) (*http.Response, []byte) {
+	state := initiateLogin(client, path).Query().Get("state")
+	callbackUrl := "http://localhost" + server.Addr + path + "?" + url.Values{
+		"code":  {code},
+		"state": {state},
+	}.Encode()
+	return getByClient(client, callbackUrl)
+}
+
+// initiateLogin returns the provider authorization url the gateway redirects to
+func initiateLogin(client *http.Client, path string) *url.URL {
+	noRedirectClient := &http.Client{
+		Jar: client.Jar,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, _ := getByClient(noRedirectClient, "http://localhost"+server.Addr+path)
+	Expect(resp.StatusCode).To(Equal(302))
+	location, err := resp.Location()
+	if err != nil {
+		Fail(err.Error())
+	}
+	return location
+}
+
 func unmarshalToMap(message []byte) map[string]string {
 	messageMap := make(map[string]string)
 	if err := json.Unmarshal(message, &messageMap); err != nil {
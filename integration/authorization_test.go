@@ -0,0 +1,36 @@
+package integration_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Authorization filter", func() {
+
+	It("allows users of the group given by the provider", func() {
+		client := authenticatedClient()
+		resp, message := getByClient(client, "http://localhost"+server.Addr+"/staff/api/v1/resource")
+		Expect(resp.StatusCode).To(Equal(200))
+		Expect(unmarshalToMap(message)).To(HaveKeyWithValue("version", "v1"))
+	})
+
+	It("allows users by identifier in OR rule", func() {
+		client := buildClient()
+		resp, _ := login(client, "/authentication/google", "google-auth-code")
+		Expect(resp.StatusCode).To(Equal(200))
+
+		resp, _ = getByClient(client, "http://localhost"+server.Addr+"/staff/api/v1/resource")
+		Expect(resp.StatusCode).To(Equal(200))
+	})
+
+	It("denies users not matching each of AND conditions", func() {
+		client := authenticatedClient()
+		resp, _ := getByClient(client, "http://localhost"+server.Addr+"/admins/api/v1/resource")
+		Expect(resp.StatusCode).To(Equal(403))
+	})
+
+	It("denies anonymous users", func() {
+		resp, _ := get("http://localhost" + server.Addr + "/staff/api/v1/resource")
+		Expect(resp.StatusCode).To(Equal(401))
+	})
+})
@@ -0,0 +1,64 @@
+package integration_test
+
+import (
+	. "github.com/Alcereo/ordinator/integration/utils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"time"
+)
+
+var _ = Describe("Bearer authentication", func() {
+
+	validClaims := func() JsonMap {
+		return JsonMap{
+			"iss": oidcProviderStub.URL(),
+			"aud": []string{"ordinator-api", "other-api"},
+			"sub": "service-account-1",
+			"exp": time.Now().Add(time.Hour).Unix(),
+		}
+	}
+
+	getWithBearer := func(token string) *http.Response {
+		request, err := http.NewRequest("GET", "http://localhost"+server.Addr+"/machine/api/v1/resource", nil)
+		Expect(err).NotTo(HaveOccurred())
+		if token != "" {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := buildClient().Do(request)
+		Expect(err).NotTo(HaveOccurred())
+		_ = resp.Body.Close()
+		return resp
+	}
+
+	It("allows request with token signed by a JWKS key", func() {
+		resp := getWithBearer(oidcProviderStub.SignToken(validClaims()))
+		Expect(resp.StatusCode).To(Equal(200))
+	})
+
+	It("denies request without token", func() {
+		resp := getWithBearer("")
+		Expect(resp.StatusCode).To(Equal(401))
+		Expect(resp.Header.Get("WWW-Authenticate")).To(Equal("Bearer"))
+	})
+
+	It("denies token signed by unknown key", func() {
+		resp := getWithBearer(oidcProviderStub.SignForgedToken(validClaims()))
+		Expect(resp.StatusCode).To(Equal(401))
+		Expect(resp.Header.Get("WWW-Authenticate")).To(Equal(`Bearer error="invalid_token"`))
+	})
+
+	It("denies token with unexpected claims", func() {
+		for name, value := range map[string]interface{}{
+			"iss": "https://other-issuer.example.com",
+			"aud": "other-api",
+			"exp": time.Now().Add(-time.Minute).Unix(),
+			"nbf": time.Now().Add(time.Hour).Unix(),
+		} {
+			claims := validClaims()
+			claims[name] = value
+			resp := getWithBearer(oidcProviderStub.SignToken(claims))
+			Expect(resp.StatusCode).To(Equal(401), "claim %v: %v", name, value)
+		}
+	})
+})
@@ -0,0 +1,186 @@
+package integration_test
+
+import (
+	. "github.com/Alcereo/ordinator/pkg/context"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var _ = Describe("Config reload", func() {
+	var gateway *Gateway
+	var gatewayServer *httptest.Server
+
+	configuration := func(cacheAdapter CacheAdapter, routers ...Router) *ProxyConfiguration {
+		return &ProxyConfiguration{
+			CacheAdapters: []CacheAdapter{cacheAdapter},
+			Routers: append([]Router{
+				{
+					Type:        ReverseProxy,
+					Pattern:     "/reloaded/",
+					TargetUrl:   resourceStub.URL,
+					StripPrefix: "/reloaded/",
+					Filters: []Filter{
+						{
+							Type:                   RateLimitFilter,
+							Name:                   "rate limit filter for: /reloaded/",
+							CacheAdapterIdentifier: "reload-adapter",
+							RateLimitKey:           ClientIpRateLimitKey,
+							RateLimitRate:          0.001,
+							RateLimitBurst:         1,
+						},
+					},
+				},
+			}, routers...),
+		}
+	}
+	cacheAdapter := CacheAdapter{
+		Identifier:             "reload-adapter",
+		Type:                   GoCache,
+		ExpirationTimeHours:    1,
+		EvictScheduleTimeHours: 1,
+	}
+
+	status := func(path string) int {
+		resp, _ := get(gatewayServer.URL + path)
+		return resp.StatusCode
+	}
+
+	BeforeEach(func() {
+		gateway = NewGateway()
+		Expect(gateway.Apply(configuration(cacheAdapter))).To(Succeed())
+		gatewayServer = httptest.NewServer(gateway)
+
+		Expect(status("/reloaded/api/v1/resource")).To(Equal(200))
+		Expect(status("/reloaded/api/v1/resource")).To(Equal(429))
+	})
+
+	AfterEach(func() {
+		gatewayServer.Close()
+		gateway.Close()
+	})
+
+	It("serves new routers and keeps unchanged cache adapters", func() {
+		Expect(status("/added/api/v1/resource")).To(Equal(404))
+
+		err := gateway.Apply(configuration(cacheAdapter, Router{
+			Type:        ReverseProxy,
+			Pattern:     "/added/",
+			TargetUrl:   resourceStub.URL,
+			StripPrefix: "/added/",
+		}))
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status("/added/api/v1/resource")).To(Equal(200))
+		Expect(status("/reloaded/api/v1/resource")).To(Equal(429), "Rate limit counters of the kept adapter are lost")
+	})
+
+	It("keeps in-memory cache adapter with changed settings", func() {
+		changedAdapter := cacheAdapter
+		changedAdapter.ExpirationTimeHours = 2
+
+		Expect(gateway.Apply(configuration(changedAdapter))).To(Succeed())
+
+		Expect(status("/reloaded/api/v1/resource")).To(Equal(429), "Rate limit counters of the kept adapter are lost")
+	})
+
+	It("creates cache adapter with changed storage again", func() {
+		dir, err := ioutil.TempDir("", "ordinator-reload")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+		changedAdapter := cacheAdapter
+		changedAdapter.Type = File
+		changedAdapter.FilePath = filepath.Join(dir, "cache.db")
+
+		Expect(gateway.Apply(configuration(changedAdapter))).To(Succeed())
+
+		Expect(status("/reloaded/api/v1/resource")).To(Equal(200))
+	})
+
+	It("keeps file cache adapter with changed settings", func() {
+		dir, err := ioutil.TempDir("", "ordinator-reload")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+		fileAdapter := CacheAdapter{
+			Identifier:             "reload-adapter",
+			Type:                   File,
+			FilePath:               filepath.Join(dir, "cache.db"),
+			ExpirationTimeHours:    1,
+			EvictScheduleTimeHours: 1,
+		}
+		Expect(gateway.Apply(configuration(fileAdapter))).To(Succeed())
+		Expect(status("/reloaded/api/v1/resource")).To(Equal(200))
+		Expect(status("/reloaded/api/v1/resource")).To(Equal(429))
+
+		changedAdapter := fileAdapter
+		changedAdapter.ExpirationTimeHours = 2
+		changedAdapter.EvictScheduleTimeHours = 2
+
+		Expect(gateway.Apply(configuration(changedAdapter))).To(Succeed())
+		Expect(status("/reloaded/api/v1/resource")).To(Equal(429), "Rate limit counters of the kept adapter are lost")
+	})
+
+	It("drops idle upstream connections of the replaced config", func() {
+		var mutex sync.Mutex
+		closed := 0
+		upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			writer.WriteHeader(200)
+		}))
+		upstream.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+			if state == http.StateClosed {
+				mutex.Lock()
+				closed++
+				mutex.Unlock()
+			}
+		}
+		upstream.Start()
+		defer upstream.Close()
+		upstreamRouter := Router{
+			Type:      ReverseProxy,
+			Pattern:   "/upstream/",
+			TargetUrl: upstream.URL,
+		}
+		Expect(gateway.Apply(configuration(cacheAdapter, upstreamRouter))).To(Succeed())
+		Expect(status("/upstream/")).To(Equal(200))
+
+		Expect(gateway.Apply(configuration(cacheAdapter, upstreamRouter))).To(Succeed())
+
+		Eventually(func() int {
+			mutex.Lock()
+			defer mutex.Unlock()
+			return closed
+		}).Should(Equal(1), "Keep-alive connection of the replaced config is left open")
+	})
+
+	It("rejects bad config and keeps the running one", func() {
+		err := gateway.Apply(configuration(cacheAdapter, Router{
+			Type:    "UnknownRouter",
+			Pattern: "/added/",
+		}))
+
+		Expect(err).To(MatchError(ContainSubstring("routers[1].type: undefined router type 'UnknownRouter'")))
+		Expect(status("/reloaded/api/v1/resource")).To(Equal(429))
+		Expect(status("/added/api/v1/resource")).To(Equal(404))
+	})
+
+	It("rejects config failing to build and keeps the running one", func() {
+		config := configuration(cacheAdapter)
+		config.CacheAdapters = append(config.CacheAdapters, CacheAdapter{
+			Identifier: "unavailable-file-adapter",
+			Type:       File,
+			FilePath:   "/not-existing-directory/cache.db",
+		})
+
+		err := gateway.Apply(config)
+
+		Expect(err).To(BeAssignableToTypeOf(ConfigErrors{}))
+		Expect(err).To(MatchError(ContainSubstring("cache-adapters[1].file-path: cache file opening error")))
+		Expect(status("/reloaded/api/v1/resource")).To(Equal(429))
+	})
+})
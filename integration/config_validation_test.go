@@ -0,0 +1,159 @@
+package integration_test
+
+import (
+	. "github.com/Alcereo/ordinator/pkg/context"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Config validation", func() {
+
+	It("accepts the suite configuration", func() {
+		Expect(Validate(suiteConfiguration)).To(BeEmpty())
+	})
+
+	It("collects all errors with their paths", func() {
+		config := &ProxyConfiguration{
+			CacheAdapters: []CacheAdapter{
+				{Identifier: "memory", Type: GoCache},
+				{Identifier: "user-data", Type: Session},
+				{Identifier: "memory", Type: "Memcached"},
+			},
+			Routers: []Router{
+				{
+					Type:      ReverseProxy,
+					Pattern:   "/api/",
+					TargetUrl: resourceStub.URL,
+					Filters: []Filter{
+						{Type: SessionFilter, Name: "session", CacheAdapterIdentifier: "user-data"},
+						{Type: UserAuthenticationFilter, Name: "auth", CacheAdapterIdentifier: "missing"},
+						{Type: LogFilter, Name: "log", Template: "{{.Request.Method"},
+						{Type: RateLimitFilter, Name: "limit", CacheAdapterIdentifier: "memory", RateLimitKey: "Header"},
+					},
+				},
+				{
+					Type:    ReverseProxy,
+					Pattern: "/api/",
+				},
+				{
+					Type:    "Static",
+					Pattern: "/static/",
+					Filters: []Filter{
+						{Type: AuthorizationFilter, Name: "authorization", AuthorizationRule: AuthorizationRule{
+							Any: []AuthorizationRule{{Groups: []string{"staff"}}, {}},
+						}},
+					},
+				},
+			},
+		}
+
+		errors := Validate(config)
+
+		paths := make([]string, 0, len(errors))
+		for _, err := range errors {
+			paths = append(paths, err.Path)
+		}
+		Expect(paths).To(ConsistOf(
+			"cache-adapters[2].identifier",
+			"cache-adapters[2].type",
+			"routers[0].filters[0].cache-adapter-identifier",
+			"routers[0].filters[1].cache-adapter-identifier",
+			"routers[0].filters[2].template",
+			"routers[0].filters[3].rate-limit-rate",
+			"routers[0].filters[3].rate-limit-key",
+			"routers[1].target-url",
+			"routers[1].pattern",
+			"routers[2].type",
+			"routers[2].filters[0].authorization-rule.any[1]",
+		))
+		Expect(errors.Error()).To(ContainSubstring(
+			"routers[0].filters[1].cache-adapter-identifier: cache adapter with identifier 'missing' not found",
+		))
+		Expect(errors.Error()).To(ContainSubstring(
+			"routers[0].filters[0].cache-adapter-identifier: Session cache adapter 'user-data' can't be used as session cache",
+		))
+	})
+
+	It("reports the Google secret as environment variables", func() {
+		config := &ProxyConfiguration{
+			CacheAdapters: []CacheAdapter{{Identifier: "memory", Type: GoCache}},
+			Routers: []Router{{
+				Type:                   GoogleOauth2Authorization,
+				Pattern:                "/google/auth",
+				CacheAdapterIdentifier: "memory",
+				SuccessLoginUrl:        "/",
+				AccessTokenRequestUrl:  "https://oauth2.googleapis.com/token",
+				UserInfoRequestUrl:     "https://www.googleapis.com/oauth2/v1/userinfo",
+			}},
+		}
+
+		errors := Validate(config)
+
+		Expect(errors).To(ConsistOf(
+			ConfigError{Path: "$GOOGLE_CLIENT_ID", Message: "environment variable is required by routers[0]"},
+			ConfigError{Path: "$GOOGLE_CLIENT_SECRET", Message: "environment variable is required by routers[0]"},
+		))
+
+		config.GoogleSecret = GoogleSecret{ClientId: "client-id", ClientSecret: "client-secret"}
+		Expect(Validate(config)).To(BeEmpty(), "Authorization request url is defaulted")
+
+		config.Routers[0].AuthorizationRequestUrl = "accounts.google.com"
+		Expect(Validate(config).Error()).To(Equal("routers[0].authorization-request-url: invalid url 'accounts.google.com'"))
+	})
+
+	It("requires issuer and audience for the bearer JWKS keys", func() {
+		config := &ProxyConfiguration{
+			Routers: []Router{{
+				Type:      ReverseProxy,
+				Pattern:   "/machine/",
+				TargetUrl: resourceStub.URL,
+				Filters: []Filter{{
+					Type:          BearerAuthenticationFilter,
+					Name:          "bearer",
+					BearerJwksUrl: "https://www.googleapis.com/oauth2/v3/certs",
+				}},
+			}},
+		}
+
+		errors := Validate(config)
+
+		paths := make([]string, 0, len(errors))
+		for _, err := range errors {
+			paths = append(paths, err.Path)
+		}
+		Expect(paths).To(ConsistOf(
+			"routers[0].filters[0].bearer-issuer",
+			"routers[0].filters[0].bearer-audience",
+		))
+	})
+
+	It("requires absolute post logout redirect url with the end session url", func() {
+		config := &ProxyConfiguration{
+			CacheAdapters: []CacheAdapter{{Identifier: "memory", Type: GoCache}},
+			Routers: []Router{{
+				Type:                   Logout,
+				Pattern:                "/logout",
+				CacheAdapterIdentifier: "memory",
+				PostLogoutRedirectUrl:  "/api/v1/",
+				CookieName:             "session",
+			}},
+		}
+		Expect(Validate(config)).To(BeEmpty())
+
+		config.Routers[0].EndSessionUrl = "https://issuer.example.com/logout"
+
+		Expect(Validate(config).Error()).To(Equal("routers[0].post-logout-redirect-url: invalid url '/api/v1/'"))
+	})
+
+	It("rejects invalid configuration on reload", func() {
+		gateway := NewGateway()
+		defer gateway.Close()
+
+		err := gateway.Apply(&ProxyConfiguration{
+			Routers: []Router{{Type: ReverseProxy, Pattern: "/api/"}},
+		})
+
+		Expect(err).To(BeAssignableToTypeOf(ConfigErrors{}))
+		Expect(err.Error()).To(Equal("routers[0].target-url: target url is required for the reverse proxy router"))
+	})
+})
@@ -0,0 +1,70 @@
+package integration_test
+
+import (
+	. "github.com/Alcereo/ordinator/integration/utils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"net/http"
+)
+
+var _ = Describe("CORS", func() {
+	const origin = "http://app.localhost:3000"
+
+	preflight := func(origin string, method string, headers string) *http.Response {
+		request, err := http.NewRequest("OPTIONS", "http://localhost"+server.Addr+"/api/v3/mutable-resource", nil)
+		Expect(err).NotTo(HaveOccurred())
+		request.Header.Set("Origin", origin)
+		request.Header.Set("Access-Control-Request-Method", method)
+		request.Header.Set("Access-Control-Request-Headers", headers)
+		resp, err := buildClient().Do(request)
+		Expect(err).NotTo(HaveOccurred())
+		_ = resp.Body.Close()
+		return resp
+	}
+
+	It("answers preflight before session and CSRF filters", func() {
+		resp := preflight(origin, "POST", "content-type, x-csrf-token")
+
+		Expect(resp.StatusCode).To(Equal(204))
+		Expect(resp.Header.Get("Access-Control-Allow-Origin")).To(Equal(origin))
+		Expect(resp.Header.Get("Access-Control-Allow-Credentials")).To(Equal("true"))
+		Expect(resp.Header.Get("Access-Control-Allow-Methods")).To(Equal("GET, POST"))
+		Expect(resp.Header.Get("Access-Control-Allow-Headers")).To(Equal("Content-Type, X-Csrf-Token"))
+		Expect(resp.Header.Get("Access-Control-Max-Age")).To(Equal("600"))
+		Expect(resp.Header.Get("Set-Cookie")).To(BeEmpty())
+	})
+
+	It("allows origins by pattern", func() {
+		resp := preflight("https://app.example.com", "POST", "content-type")
+		Expect(resp.StatusCode).To(Equal(204))
+		Expect(resp.Header.Get("Access-Control-Allow-Origin")).To(Equal("https://app.example.com"))
+	})
+
+	It("denies preflight from unknown origin", func() {
+		resp := preflight("https://example.org", "POST", "content-type")
+		Expect(resp.StatusCode).To(Equal(403))
+		Expect(resp.Header.Get("Access-Control-Allow-Origin")).To(BeEmpty())
+	})
+
+	It("exposes CSRF header to allowed origin", func() {
+		client := buildClient()
+		resp, _ := login(client, "/authentication/google", "google-auth-code")
+		Expect(resp.StatusCode).To(Equal(200))
+		csrfToken := resp.Header.Get("X-CSRF-TOKEN")
+
+		resp, _ = postJsonByClient(
+			client,
+			"http://localhost"+server.Addr+"/api/v3/mutable-resource",
+			JsonMap{"method": "mutate"},
+			func(req *http.Request) *http.Request {
+				req.Header.Set("Origin", origin)
+				req.Header.Add("X-CSRF-TOKEN", csrfToken)
+				return req
+			},
+		)
+
+		Expect(resp.StatusCode).To(Equal(201))
+		Expect(resp.Header.Get("Access-Control-Allow-Origin")).To(Equal(origin))
+		Expect(resp.Header.Get("Access-Control-Expose-Headers")).To(Equal("X-CSRF-TOKEN"))
+	})
+})
@@ -0,0 +1,83 @@
+package integration_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var _ = Describe("CSRF modes", func() {
+
+	postForm := func(client *http.Client, path string, form url.Values, mutator requestMutator) (*http.Response, string) {
+		request, err := http.NewRequest("POST", "http://localhost"+server.Addr+path, strings.NewReader(form.Encode()))
+		Expect(err).NotTo(HaveOccurred())
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if mutator != nil {
+			request = mutator(request)
+		}
+		resp, err := client.Do(request)
+		Expect(err).NotTo(HaveOccurred())
+		body, _ := ioutil.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		return resp, string(body)
+	}
+
+	Describe("double submit cookie", func() {
+
+		It("accepts form post with the cookie token in the form field without session", func() {
+			client := buildClient()
+			resp, _ := getByClient(client, "http://localhost"+server.Addr+"/forms/new-order")
+			Expect(resp.StatusCode).To(Equal(200))
+			csrfToken := resp.Header.Get("X-CSRF-TOKEN")
+			Expect(csrfToken).NotTo(BeEmpty())
+
+			form := url.Values{"item": {"book"}, "csrf_token": {csrfToken}}
+			resp, _ = postForm(client, "/forms/new-order", form, nil)
+
+			Expect(resp.StatusCode).To(Equal(200))
+			Expect(string(headerRecorderStub.LastBody())).To(Equal(form.Encode()))
+		})
+
+		It("denies form post without the cookie", func() {
+			client := buildClient()
+			resp, _ := getByClient(client, "http://localhost"+server.Addr+"/forms/new-order")
+			csrfToken := resp.Header.Get("X-CSRF-TOKEN")
+
+			resp, message := postForm(buildClient(), "/forms/new-order", url.Values{"csrf_token": {csrfToken}}, nil)
+
+			Expect(resp.StatusCode).To(Equal(403))
+			Expect(message).To(Equal("resolving CSRF cookie error. CSRF cookie: csrf is empty"))
+		})
+	})
+
+	Describe("origin check", func() {
+
+		It("accepts unsafe request from the allowed origin", func() {
+			resp, _ := postForm(buildClient(), "/origin-checked/orders", url.Values{}, func(r *http.Request) *http.Request {
+				r.Header.Set("Origin", "http://app.localhost:3000")
+				return r
+			})
+			Expect(resp.StatusCode).To(Equal(200))
+		})
+
+		It("accepts unsafe request with the allowed Referer", func() {
+			resp, _ := postForm(buildClient(), "/origin-checked/orders", url.Values{}, func(r *http.Request) *http.Request {
+				r.Header.Set("Referer", "http://app.localhost:3000/orders/new")
+				return r
+			})
+			Expect(resp.StatusCode).To(Equal(200))
+		})
+
+		It("denies unsafe request from another origin", func() {
+			resp, message := postForm(buildClient(), "/origin-checked/orders", url.Values{}, func(r *http.Request) *http.Request {
+				r.Header.Set("Origin", "http://evil.localhost")
+				return r
+			})
+			Expect(resp.StatusCode).To(Equal(403))
+			Expect(message).To(Equal("CSRF origin check error. Origin is not allowed: http://evil.localhost"))
+		})
+	})
+})
@@ -12,10 +12,7 @@ var _ = Describe("CSRF", func() {
 
 	It("CsrfFilter allow unsafe methods with CSRF token", func() {
 		client := buildClient()
-		resp, _ := getByClient(
-			client,
-			"http://localhost"+server.Addr+"/authentication/google?code=google-auth-code",
-		)
+		resp, _ := login(client, "/authentication/google", "google-auth-code")
 		Expect(resp.StatusCode).To(Equal(200))
 		csrfToken := resp.Header.Get(headerName)
 		Expect(csrfToken).NotTo(BeEmpty(), "CSRF token not found in header: %v", headerName)
@@ -40,10 +37,7 @@ var _ = Describe("CSRF", func() {
 
 	It("CsrfFilter allow safe methods without CSRF token", func() {
 		client := buildClient()
-		resp, _ := getByClient(
-			client,
-			"http://localhost"+server.Addr+"/authentication/google?code=google-auth-code",
-		)
+		resp, _ := login(client, "/authentication/google", "google-auth-code")
 		Expect(resp.StatusCode).To(Equal(200))
 
 		resp, bytes := getByClient(
@@ -61,10 +55,7 @@ var _ = Describe("CSRF", func() {
 
 	It("CsrfFilter denied methods without CSRF token", func() {
 		client := buildClient()
-		resp, _ := getByClient(
-			client,
-			"http://localhost"+server.Addr+"/authentication/google?code=google-auth-code",
-		)
+		resp, _ := login(client, "/authentication/google", "google-auth-code")
 		Expect(resp.StatusCode).To(Equal(200))
 		csrfToken := resp.Header.Get(headerName)
 		Expect(csrfToken).NotTo(BeEmpty(), "CSRF token not found in header: %v", headerName)
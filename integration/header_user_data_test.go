@@ -0,0 +1,38 @@
+package integration_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"net/http"
+)
+
+var _ = Describe("Header user data serializer", func() {
+
+	getWithForgedHeaders := func(client *http.Client) http.Header {
+		request, err := http.NewRequest("GET", "http://localhost"+server.Addr+"/legacy/resource", nil)
+		Expect(err).NotTo(HaveOccurred())
+		request.Header.Set("X-User-Id", "admin")
+		request.Header.Set("X-User-Email", "admin@example.com")
+		resp, err := client.Do(request)
+		Expect(err).NotTo(HaveOccurred())
+		_ = resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(200))
+		return headerRecorderStub.LastHeaders()
+	}
+
+	It("sends user data fields in plain headers instead of forged ones", func() {
+		headers := getWithForgedHeaders(authenticatedClient())
+
+		Expect(headers["X-User-Id"]).To(Equal([]string{"oidc-user-1"}))
+		Expect(headers["X-User-Email"]).To(Equal([]string{"oidc-user@example.com"}))
+		Expect(headers.Get("X-User-Name")).To(Equal("oidc-user"))
+		Expect(headers.Get("X-User-Groups")).To(Equal("staff"))
+	})
+
+	It("strips forged headers of anonymous requests", func() {
+		headers := getWithForgedHeaders(buildClient())
+
+		Expect(headers).NotTo(HaveKey("X-User-Id"))
+		Expect(headers).NotTo(HaveKey("X-User-Email"))
+	})
+})
@@ -1,13 +1,23 @@
 package integration_test
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
 	. "github.com/Alcereo/ordinator/integration/utils"
 	. "github.com/Alcereo/ordinator/pkg/context"
+	"github.com/alicebob/miniredis/v2"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"testing"
+	"time"
 )
 
 func TestIntegration(t *testing.T) {
@@ -18,6 +28,12 @@ func TestIntegration(t *testing.T) {
 var server *http.Server
 var googleApiStub *httptest.Server
 var resourceStub *httptest.Server
+var oidcProviderStub *OidcProviderStub
+var redisStub *miniredis.Miniredis
+var streamingStub *httptest.Server
+var headerRecorderStub *HeaderRecorderStub
+var userDataKeyFile string
+var suiteConfiguration *ProxyConfiguration
 
 var _ = BeforeSuite(func() {
 
@@ -36,30 +52,184 @@ var _ = BeforeSuite(func() {
 
 	googleApiStub = createGoogleApiStub()
 	resourceStub = createResourceServiceStub()
+	oidcProviderStub = createOidcProviderStub()
+	redisStub = createRedisStub()
+	streamingStub = CreateStreamingStub(300 * time.Millisecond)
+	headerRecorderStub = CreateHeaderRecorderStub()
+	userDataKeyFile = writeUserDataKeyFile()
 	context := NewContext()
 
 	cacheAdapterIdentifier := "main-adapter"
+	redisCacheAdapterIdentifier := "redis-adapter"
+	sessionCacheAdapterIdentifier := "session-adapter"
 
-	context.SetupCache([]CacheAdapter{
+	cacheAdapters := []CacheAdapter{
 		{
 			Identifier:             cacheAdapterIdentifier,
 			Type:                   GoCache,
 			ExpirationTimeHours:    1,
 			EvictScheduleTimeHours: 1,
 		},
-	})
-	context.SetupRouters([]Router{
 		{
-			Type:                   GoogleOauth2Authorization,
-			Pattern:                "/authentication/google",
+			Identifier:          redisCacheAdapterIdentifier,
+			Type:                Redis,
+			ExpirationTimeHours: 1,
+			RedisAddress:        redisStub.Addr(),
+			KeyPrefix:           "ordinator:",
+		},
+		{
+			Identifier: sessionCacheAdapterIdentifier,
+			Type:       Session,
+		},
+	}
+	routers := []Router{
+		{
+			Type:                    GoogleOauth2Authorization,
+			Pattern:                 "/authentication/google",
+			CacheAdapterIdentifier:  cacheAdapterIdentifier,
+			SuccessLoginUrl:         "/api/v2/resource",
+			AuthorizationRequestUrl: googleApiStub.URL + "/o/oauth2/v2/auth",
+			AccessTokenRequestUrl:   googleApiStub.URL + "/oauth2/v4/token",
+			UserInfoRequestUrl:      googleApiStub.URL + "/oauth2/v3/userinfo",
+			Filters: []Filter{
+				{
+					Type:                   SessionFilter,
+					Name:                   "session filter for google auth",
+					CacheAdapterIdentifier: cacheAdapterIdentifier,
+					CookieDomain:           "localhost",
+					CookiePath:             "/",
+					CookieName:             "session",
+					CookieTTLHours:         24,
+					CookieRenewBeforeHours: 2,
+				},
+			},
+		},
+		{
+			Type:                   OidcAuthorization,
+			Pattern:                "/authentication/oidc",
 			CacheAdapterIdentifier: cacheAdapterIdentifier,
 			SuccessLoginUrl:        "/api/v2/resource",
-			AccessTokenRequestUrl:  googleApiStub.URL + "/oauth2/v4/token",
-			UserInfoRequestUrl:     googleApiStub.URL + "/oauth2/v3/userinfo",
+			IssuerUrl:              oidcProviderStub.URL(),
+			ClientId:               oidcProviderStub.ClientId,
+			ClientSecret:           oidcProviderStub.ClientSecret,
+			RedirectUrl:            "http://localhost:8080/authentication/oidc",
 			Filters: []Filter{
 				{
 					Type:                   SessionFilter,
-					Name:                   "session filter for google auth",
+					Name:                   "session filter for oidc auth",
+					CacheAdapterIdentifier: cacheAdapterIdentifier,
+					CookieDomain:           "localhost",
+					CookiePath:             "/",
+					CookieName:             "session",
+					CookieTTLHours:         24,
+					CookieRenewBeforeHours: 2,
+				},
+			},
+		},
+		{
+			Type:                   OidcAuthorization,
+			Pattern:                "/redis/authentication/oidc",
+			CacheAdapterIdentifier: redisCacheAdapterIdentifier,
+			SuccessLoginUrl:        "/redis/api/v2/resource",
+			IssuerUrl:              oidcProviderStub.URL(),
+			ClientId:               oidcProviderStub.ClientId,
+			ClientSecret:           oidcProviderStub.ClientSecret,
+			RedirectUrl:            "http://localhost:8080/redis/authentication/oidc",
+			Filters: []Filter{
+				{
+					Type:                   SessionFilter,
+					Name:                   "redis session filter for oidc auth",
+					CacheAdapterIdentifier: redisCacheAdapterIdentifier,
+					CookieDomain:           "localhost",
+					CookiePath:             "/redis/",
+					CookieName:             "redis-session",
+					CookieTTLHours:         24,
+					CookieRenewBeforeHours: 2,
+				},
+			},
+		},
+		{
+			Type:      ReverseProxy,
+			Pattern:   "/redis/api/v2/",
+			TargetUrl: resourceStub.URL,
+			Filters: []Filter{
+				{
+					Type:                   SessionFilter,
+					Name:                   "redis session filter for: /redis/api/v2/",
+					CacheAdapterIdentifier: redisCacheAdapterIdentifier,
+					CookieDomain:           "localhost",
+					CookiePath:             "/redis/",
+					CookieName:             "redis-session",
+					CookieTTLHours:         24,
+					CookieRenewBeforeHours: 2,
+				},
+				{
+					Type:                   UserAuthenticationFilter,
+					Name:                   "redis auth filter for: /redis/api/v2/",
+					CacheAdapterIdentifier: redisCacheAdapterIdentifier,
+					UserDataRequired:       true,
+				},
+			},
+		},
+		{
+			Type:                   OidcAuthorization,
+			Pattern:                "/stateless/authentication/oidc",
+			CacheAdapterIdentifier: sessionCacheAdapterIdentifier,
+			SuccessLoginUrl:        "/stateless/api/v2/resource",
+			IssuerUrl:              oidcProviderStub.URL(),
+			ClientId:               oidcProviderStub.ClientId,
+			ClientSecret:           oidcProviderStub.ClientSecret,
+			RedirectUrl:            "http://localhost:8080/stateless/authentication/oidc",
+			Filters: []Filter{
+				statelessSessionFilter("stateless session filter for oidc auth"),
+			},
+		},
+		{
+			Type:      ReverseProxy,
+			Pattern:   "/stateless/api/v2/",
+			TargetUrl: resourceStub.URL,
+			Filters: []Filter{
+				statelessSessionFilter("stateless session filter for: /stateless/api/v2/"),
+				{
+					Type:                   UserAuthenticationFilter,
+					Name:                   "stateless auth filter for: /stateless/api/v2/",
+					CacheAdapterIdentifier: sessionCacheAdapterIdentifier,
+					UserDataRequired:       true,
+				},
+			},
+		},
+		{
+			Type:                   Logout,
+			Pattern:                "/stateless/authentication/logout",
+			CacheAdapterIdentifier: sessionCacheAdapterIdentifier,
+			PostLogoutRedirectUrl:  "/pages/login-page",
+			CookieDomain:           "localhost",
+			CookiePath:             "/stateless/",
+			CookieName:             "stateless-session",
+			Filters: []Filter{
+				statelessSessionFilter("stateless session filter for logout"),
+			},
+		},
+		{
+			Type:                   Logout,
+			Pattern:                "/authentication/logout",
+			CacheAdapterIdentifier: cacheAdapterIdentifier,
+			PostLogoutRedirectUrl:  "/pages/login-page",
+			RevocationUrl:          googleApiStub.URL + "/oauth2/revoke",
+			CookieDomain:           "localhost",
+			CookiePath:             "/",
+			CookieName:             "session",
+			Filters: []Filter{
+				{
+					Type:               CsrfFilter,
+					Name:               "csrf filter for logout",
+					CsrfMode:           OriginCsrfMode,
+					CsrfSafeMethods:    []string{"GET", "HEAD", "OPTIONS"},
+					CsrfAllowedOrigins: []string{"http://localhost:8080"},
+				},
+				{
+					Type:                   SessionFilter,
+					Name:                   "session filter for logout",
 					CacheAdapterIdentifier: cacheAdapterIdentifier,
 					CookieDomain:           "localhost",
 					CookiePath:             "/",
@@ -158,6 +328,16 @@ var _ = BeforeSuite(func() {
 					},
 					CsrfEncryptorPrivateKey: "some-private-key",
 				},
+				{
+					Type:                 CorsFilter,
+					Name:                 "cors filter for: /api/v3/",
+					CorsAllowedOrigins:   []string{"http://app.localhost:3000", "https://*.example.com"},
+					CorsAllowedMethods:   []string{"GET", "POST"},
+					CorsAllowedHeaders:   []string{"Content-Type", "X-CSRF-TOKEN"},
+					CorsExposedHeaders:   []string{"X-CSRF-TOKEN"},
+					CorsAllowCredentials: true,
+					CorsMaxAgeSeconds:    600,
+				},
 				{
 					Type:     LogFilter,
 					Name:     "log filter for: /api/v3/",
@@ -165,6 +345,185 @@ var _ = BeforeSuite(func() {
 				},
 			},
 		},
+		{
+			Type:                      ReverseProxy,
+			Pattern:                   "/streaming/",
+			TargetUrl:                 streamingStub.URL,
+			StripPrefix:               "/streaming/",
+			UpgradeIdleTimeoutSeconds: 1,
+			Filters: []Filter{
+				{
+					Type:                   SessionFilter,
+					Name:                   "session filter for: /streaming/",
+					CacheAdapterIdentifier: cacheAdapterIdentifier,
+					CookieDomain:           "localhost",
+					CookiePath:             "/",
+					CookieName:             "session",
+					CookieTTLHours:         24,
+					CookieRenewBeforeHours: 2,
+				},
+				{
+					Type:                   UserAuthenticationFilter,
+					Name:                   "auth filter for: /streaming/",
+					CacheAdapterIdentifier: cacheAdapterIdentifier,
+					UserDataRequired:       true,
+				},
+			},
+		},
+		{
+			Type:        ReverseProxy,
+			Pattern:     "/machine/",
+			TargetUrl:   resourceStub.URL,
+			StripPrefix: "/machine/",
+			Filters: []Filter{
+				{
+					Type:             BearerAuthenticationFilter,
+					Name:             "bearer filter for: /machine/",
+					BearerJwksUrl:    oidcProviderStub.URL() + "/jwks",
+					BearerIssuer:     oidcProviderStub.URL(),
+					BearerAudience:   []string{"ordinator-api"},
+					UserDataRequired: true,
+				},
+			},
+		},
+		authorizedRouter("/staff/", cacheAdapterIdentifier, AuthorizationRule{
+			Any: []AuthorizationRule{
+				{Groups: []string{"staff", "admins"}},
+				{Identifiers: []string{"user-identifier-1"}},
+			},
+		}),
+		authorizedRouter("/admins/", cacheAdapterIdentifier, AuthorizationRule{
+			EmailDomains: []string{"example.com"},
+			Groups:       []string{"admins"},
+		}),
+		{
+			Type:    UserDataJwks,
+			Pattern: "/.well-known/user-data-jwks",
+		},
+		{
+			Type:      ReverseProxy,
+			Pattern:   "/signed/",
+			TargetUrl: headerRecorderStub.URL(),
+			Filters: []Filter{
+				{
+					Type:                   SessionFilter,
+					Name:                   "session filter for: /signed/",
+					CacheAdapterIdentifier: cacheAdapterIdentifier,
+					CookieDomain:           "localhost",
+					CookiePath:             "/",
+					CookieName:             "session",
+					CookieTTLHours:         24,
+					CookieRenewBeforeHours: 2,
+				},
+				{
+					Type:                   UserAuthenticationFilter,
+					Name:                   "auth filter for: /signed/",
+					CacheAdapterIdentifier: cacheAdapterIdentifier,
+					UserDataRequired:       true,
+				},
+				{
+					Type:                   UserDataSenderFilter,
+					Name:                   "user data sender for: /signed/",
+					CacheAdapterIdentifier: cacheAdapterIdentifier,
+					UserDataHeader:         "X-USER-DATA",
+					UserDataTypeSerializer: UserDataSerializer{
+						Type:           JwtUserDataSerializer,
+						Algorithm:      "ES256",
+						PrivateKeyFile: userDataKeyFile,
+						Issuer:         "ordinator",
+						Audience:       []string{"backend"},
+					},
+				},
+			},
+		},
+		{
+			Type:      ReverseProxy,
+			Pattern:   "/legacy/",
+			TargetUrl: headerRecorderStub.URL(),
+			Filters: []Filter{
+				{
+					Type:                   SessionFilter,
+					Name:                   "session filter for: /legacy/",
+					CacheAdapterIdentifier: cacheAdapterIdentifier,
+					CookieDomain:           "localhost",
+					CookiePath:             "/",
+					CookieName:             "session",
+					CookieTTLHours:         24,
+					CookieRenewBeforeHours: 2,
+				},
+				{
+					Type:                   UserAuthenticationFilter,
+					Name:                   "auth filter for: /legacy/",
+					CacheAdapterIdentifier: cacheAdapterIdentifier,
+				},
+				{
+					Type:                   UserDataSenderFilter,
+					Name:                   "user data sender for: /legacy/",
+					CacheAdapterIdentifier: cacheAdapterIdentifier,
+					UserDataTypeSerializer: UserDataSerializer{
+						Type:    HeaderUserDataSerializer,
+						Headers: map[string]string{"picture": ""},
+					},
+				},
+			},
+		},
+		{
+			Type:      ReverseProxy,
+			Pattern:   "/plain/",
+			TargetUrl: headerRecorderStub.URL(),
+			RequestHeaders: RequestHeaders{
+				Remove: []string{"X-Debug"},
+				Set:    []HeaderValue{{Name: "X-Gateway", Value: "ordinator"}},
+			},
+		},
+		{
+			Type:      ReverseProxy,
+			Pattern:   "/forms/",
+			TargetUrl: headerRecorderStub.URL(),
+			Filters: []Filter{
+				{
+					Type:                    CsrfFilter,
+					Name:                    "double submit csrf filter for: /forms/",
+					CsrfMode:                DoubleSubmitCookieCsrfMode,
+					CsrfHeader:              "X-CSRF-TOKEN",
+					CsrfFormField:           "csrf_token",
+					CsrfSafeMethods:         []string{"GET"},
+					CsrfEncryptorPrivateKey: "some-private-key",
+					CookieName:              "csrf",
+					CookiePath:              "/forms/",
+				},
+			},
+		},
+		{
+			Type:      ReverseProxy,
+			Pattern:   "/origin-checked/",
+			TargetUrl: headerRecorderStub.URL(),
+			Filters: []Filter{
+				{
+					Type:               CsrfFilter,
+					Name:               "origin csrf filter for: /origin-checked/",
+					CsrfMode:           OriginCsrfMode,
+					CsrfSafeMethods:    []string{"GET"},
+					CsrfAllowedOrigins: []string{"http://app.localhost:3000"},
+				},
+			},
+		},
+		{
+			Type:        ReverseProxy,
+			Pattern:     "/limited/",
+			TargetUrl:   resourceStub.URL,
+			StripPrefix: "/limited/",
+			Filters: []Filter{
+				{
+					Type:                   RateLimitFilter,
+					Name:                   "rate limit filter for: /limited/",
+					CacheAdapterIdentifier: redisCacheAdapterIdentifier,
+					RateLimitKey:           ClientIpRateLimitKey,
+					RateLimitRate:          0.1,
+					RateLimitBurst:         2,
+				},
+			},
+		},
 		{
 			Type:      ReverseProxy,
 			Pattern:   "/pages/work-page",
@@ -206,19 +565,136 @@ var _ = BeforeSuite(func() {
 				},
 			},
 		},
-	}, GoogleSecret{
-		ClientId:     "google-client-id-1",
-		ClientSecret: "google-client-secret",
-	})
+	}
+	suiteConfiguration = &ProxyConfiguration{
+		CacheAdapters: cacheAdapters,
+		Routers:       routers,
+		GoogleSecret: GoogleSecret{
+			ClientId:     "google-client-id-1",
+			ClientSecret: "google-client-secret",
+		},
+	}
+	context.SetupCache(suiteConfiguration.CacheAdapters)
+	if errors := context.SetupRouters(suiteConfiguration.Routers, suiteConfiguration.GoogleSecret); len(errors) > 0 {
+		Fail(errors.Error())
+	}
 	server = context.BuildServer(8080)
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		Fail(err.Error())
+	}
 	go func() {
 		defer GinkgoRecover()
-		_ = server.ListenAndServe()
+		_ = server.Serve(listener)
 	}()
 })
 
+func writeUserDataKeyFile() string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		Fail(err.Error())
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		Fail(err.Error())
+	}
+	file, err := ioutil.TempFile("", "ordinator-user-data-key")
+	if err != nil {
+		Fail(err.Error())
+	}
+	defer file.Close()
+	if err := pem.Encode(file, &pem.Block{Type: "PRIVATE KEY", Bytes: der}); err != nil {
+		Fail(err.Error())
+	}
+	return file.Name()
+}
+
+func authorizedRouter(pattern string, cacheAdapterIdentifier string, rule AuthorizationRule) Router {
+	return Router{
+		Type:        ReverseProxy,
+		Pattern:     pattern,
+		TargetUrl:   resourceStub.URL,
+		StripPrefix: pattern,
+		Filters: []Filter{
+			{
+				Type:                   SessionFilter,
+				Name:                   "session filter for: " + pattern,
+				CacheAdapterIdentifier: cacheAdapterIdentifier,
+				CookieDomain:           "localhost",
+				CookiePath:             "/",
+				CookieName:             "session",
+				CookieTTLHours:         24,
+				CookieRenewBeforeHours: 2,
+			},
+			{
+				Type:                   UserAuthenticationFilter,
+				Name:                   "auth filter for: " + pattern,
+				CacheAdapterIdentifier: cacheAdapterIdentifier,
+				UserDataRequired:       true,
+			},
+			{
+				Type:              AuthorizationFilter,
+				Name:              "authorization filter for: " + pattern,
+				AuthorizationRule: rule,
+			},
+		},
+	}
+}
+
+func statelessSessionFilter(name string) Filter {
+	return Filter{
+		Type:                   SessionFilter,
+		Name:                   name,
+		SessionMode:            CookieSessionMode,
+		SessionKeys:            []string{"stateless-session-key", "retired-session-key"},
+		CookieDomain:           "localhost",
+		CookiePath:             "/stateless/",
+		CookieName:             "stateless-session",
+		CookieTTLHours:         24,
+		CookieRenewBeforeHours: 2,
+	}
+}
+
+func createRedisStub() *miniredis.Miniredis {
+	stub, err := miniredis.Run()
+	if err != nil {
+		Fail(err.Error())
+	}
+	return stub
+}
+
 func createResourceServiceStub() *httptest.Server {
 	return CreateServiceStub([]RequestMock{
+		{
+			Request: Request{
+				Method: "GET",
+				Url:    "/stateless/api/v2/resource",
+			},
+			Response: Response{
+				Status:  200,
+				Headers: nil,
+				Body: JsonMap{
+					"status":  "OK",
+					"service": "resource",
+					"version": "stateless",
+				},
+			},
+		},
+		{
+			Request: Request{
+				Method: "GET",
+				Url:    "/redis/api/v2/resource",
+			},
+			Response: Response{
+				Status:  200,
+				Headers: nil,
+				Body: JsonMap{
+					"status":  "OK",
+					"service": "resource",
+					"version": "redis",
+				},
+			},
+		},
 		{
 			Request: Request{
 				Method: "POST",
@@ -297,6 +773,25 @@ func createResourceServiceStub() *httptest.Server {
 	})
 }
 
+func createOidcProviderStub() *OidcProviderStub {
+	stub := CreateOidcProviderStub("oidc-client-id", "oidc-client-secret")
+	stub.Codes["oidc-auth-code"] = JsonMap{
+		"sub":                "oidc-user-1",
+		"preferred_username": "oidc-user",
+		"email":              "oidc-user@example.com",
+		"groups":             []string{"staff"},
+	}
+	stub.Codes["foreign-nonce-code"] = JsonMap{
+		"sub":   "oidc-user-1",
+		"nonce": "nonce-of-another-login",
+	}
+	stub.AuthorizeCode = "oidc-auth-code"
+	stub.ForgedCodes["forged-auth-code"] = JsonMap{
+		"sub": "oidc-user-1",
+	}
+	return stub
+}
+
 func createGoogleApiStub() *httptest.Server {
 	return CreateServiceStub([]RequestMock{
 		{ // Token retrieving request
@@ -334,6 +829,25 @@ func createGoogleApiStub() *httptest.Server {
 				},
 			},
 		},
+		{ // Token revocation request
+			Request: Request{
+				Method: "POST",
+				Url:    "/oauth2/revoke",
+				Body: []BodyCheck{
+					URLPropsBody{
+						Props: map[string]string{
+							"token":           "refresh-token-1",
+							"token_type_hint": "refresh_token",
+							"client_id":       "google-client-id-1",
+						},
+					},
+				},
+			},
+			Response: Response{
+				Status: 200,
+				Body:   JsonMap{},
+			},
+		},
 		{ // User data request
 			Request: Request{
 				Method: "GET",
@@ -368,4 +882,9 @@ var _ = AfterSuite(func() {
 	}
 	resourceStub.Close()
 	googleApiStub.Close()
+	oidcProviderStub.Close()
+	redisStub.Close()
+	streamingStub.Close()
+	headerRecorderStub.Close()
+	_ = os.Remove(userDataKeyFile)
 })
@@ -0,0 +1,102 @@
+package integration_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"net/http"
+)
+
+var _ = Describe("Logout", func() {
+
+	gatewayOrigin := "http://localhost:8080"
+
+	It("removes user data and redirects to post logout page", func() {
+		client := buildClient()
+		resp, _ := login(client, "/authentication/google", "google-auth-code")
+		Expect(resp.StatusCode).To(Equal(200))
+
+		resp, message := logoutByClient(client, "/authentication/logout", gatewayOrigin)
+		Expect(resp.StatusCode).To(Equal(200))
+		messageMap := unmarshalToMap(message)
+		Expect(messageMap).To(HaveKeyWithValue("service", "pages"))
+		Expect(messageMap).To(HaveKeyWithValue("version", "login-page"))
+
+		resp, _ = getByClient(client, "http://localhost"+server.Addr+"/api/v2/resource")
+		Expect(resp.StatusCode).To(Equal(401))
+	})
+
+	It("expires session cookie", func() {
+		client := buildClient()
+		resp, _ := login(client, "/authentication/google", "google-auth-code")
+		Expect(resp.StatusCode).To(Equal(200))
+
+		resp, _ = logoutByClient(noRedirectClient(client), "/authentication/logout", gatewayOrigin)
+		Expect(resp.StatusCode).To(Equal(302))
+		Expect(resp.Header.Get("Location")).To(Equal("/pages/login-page"))
+
+		var sessionCookie *http.Cookie
+		for _, cookie := range resp.Cookies() {
+			if cookie.Name == "session" {
+				sessionCookie = cookie
+			}
+		}
+		Expect(sessionCookie).NotTo(BeNil())
+		Expect(sessionCookie.MaxAge).To(BeNumerically("<", 0))
+	})
+
+	It("doesn't log out on GET", func() {
+		client := buildClient()
+		resp, _ := login(client, "/authentication/google", "google-auth-code")
+		Expect(resp.StatusCode).To(Equal(200))
+
+		resp, _ = getByClient(noRedirectClient(client), "http://localhost"+server.Addr+"/authentication/logout")
+		Expect(resp.StatusCode).To(Equal(405))
+		Expect(resp.Header.Get("Allow")).To(Equal("POST"))
+		Expect(resp.Cookies()).To(BeEmpty())
+
+		resp, _ = getByClient(client, "http://localhost"+server.Addr+"/api/v2/resource")
+		Expect(resp.StatusCode).To(Equal(200))
+	})
+
+	It("doesn't log out on cross-site post", func() {
+		client := buildClient()
+		resp, _ := login(client, "/authentication/google", "google-auth-code")
+		Expect(resp.StatusCode).To(Equal(200))
+
+		resp, _ = logoutByClient(noRedirectClient(client), "/authentication/logout", "http://evil.example.com")
+		Expect(resp.StatusCode).To(Equal(403))
+
+		resp, _ = getByClient(client, "http://localhost"+server.Addr+"/api/v2/resource")
+		Expect(resp.StatusCode).To(Equal(200))
+	})
+})
+
+func noRedirectClient(client *http.Client) *http.Client {
+	return &http.Client{
+		Jar: client.Jar,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func logoutByClient(client *http.Client, path string, origin string) (*http.Response, []byte) {
+	request, err := http.NewRequest("POST", "http://localhost"+server.Addr+path, nil)
+	if err != nil {
+		Fail(err.Error())
+	}
+	if origin != "" {
+		request.Header.Set("Origin", origin)
+	}
+	resp, err := client.Do(request)
+	if err != nil {
+		Fail(err.Error())
+	}
+	message, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		Fail(err.Error())
+	}
+	return resp, message
+}
@@ -0,0 +1,61 @@
+package integration_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("OidcAuthorization", func() {
+
+	It("authenticates through the provider authorization endpoint", func() {
+		client := buildClient()
+		resp, message := getByClient(client, "http://localhost"+server.Addr+"/authentication/oidc")
+		Expect(resp.StatusCode).To(Equal(200))
+
+		messageMap := unmarshalToMap(message)
+		Expect(messageMap).To(HaveKeyWithValue("status", "OK"))
+		Expect(messageMap).To(HaveKeyWithValue("service", "resource"))
+		Expect(messageMap).To(HaveKeyWithValue("version", "v2"))
+	})
+
+	It("rejects unknown authorization code", func() {
+		resp, _ := login(buildClient(), "/authentication/oidc", "unknown-code")
+		Expect(resp.StatusCode).To(Equal(403))
+	})
+
+	It("rejects ID token signed with a key not published in JWKS", func() {
+		client := buildClient()
+		resp, _ := login(client, "/authentication/oidc", "forged-auth-code")
+		Expect(resp.StatusCode).To(Equal(403))
+
+		resp, _ = getByClient(client, "http://localhost"+server.Addr+"/api/v2/resource")
+		Expect(resp.StatusCode).To(Equal(401))
+	})
+
+	It("rejects ID token without the login state nonce", func() {
+		// The callback is called directly, so the provider never saw the nonce
+		resp, _ := login(buildClient(), "/authentication/oidc", "oidc-auth-code")
+		Expect(resp.StatusCode).To(Equal(403))
+	})
+
+	It("rejects ID token issued for another login nonce", func() {
+		resp, _ := login(buildClient(), "/authentication/oidc", "foreign-nonce-code")
+		Expect(resp.StatusCode).To(Equal(403))
+	})
+
+	It("sends the login state nonce to the provider", func() {
+		location := initiateLogin(buildClient(), "/authentication/oidc")
+		Expect(location.Query().Get("nonce")).NotTo(BeEmpty())
+	})
+
+	It("rejects callback with wrong state", func() {
+		client := buildClient()
+		initiateLogin(client, "/authentication/oidc")
+
+		resp, _ := getByClient(
+			client,
+			"http://localhost"+server.Addr+"/authentication/oidc?code=oidc-auth-code&state=wrong-state",
+		)
+		Expect(resp.StatusCode).To(Equal(403))
+	})
+})
@@ -0,0 +1,30 @@
+package integration_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"strings"
+)
+
+var _ = Describe("Rate limit filter", func() {
+
+	It("limits requests after burst and keeps counters in redis", func() {
+		for i := 0; i < 2; i++ {
+			resp, message := get("http://localhost" + server.Addr + "/limited/api/v1/resource")
+			Expect(resp.StatusCode).To(Equal(200))
+			Expect(unmarshalToMap(message)).To(HaveKeyWithValue("version", "v1"))
+		}
+
+		resp, _ := get("http://localhost" + server.Addr + "/limited/api/v1/resource")
+		Expect(resp.StatusCode).To(Equal(429))
+		Expect(resp.Header.Get("Retry-After")).To(Equal("10"))
+
+		var rateLimitKeys int
+		for _, key := range redisStub.Keys() {
+			if strings.HasPrefix(key, "ordinator:rate-limit:") {
+				rateLimitKeys++
+			}
+		}
+		Expect(rateLimitKeys).To(Equal(1))
+	})
+})
@@ -0,0 +1,37 @@
+package integration_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"strings"
+)
+
+var _ = Describe("Redis cache adapter", func() {
+
+	It("keeps session, login state and user data in redis", func() {
+		client := buildClient()
+		resp, message := getByClient(client, "http://localhost"+server.Addr+"/redis/authentication/oidc")
+		Expect(resp.StatusCode).To(Equal(200))
+
+		messageMap := unmarshalToMap(message)
+		Expect(messageMap).To(HaveKeyWithValue("service", "resource"))
+		Expect(messageMap).To(HaveKeyWithValue("version", "redis"))
+
+		var sessionKeys, userDataKeys int
+		for _, key := range redisStub.Keys() {
+			if strings.HasPrefix(key, "ordinator:session:") {
+				sessionKeys++
+			}
+			if strings.HasPrefix(key, "ordinator:user-data:") {
+				userDataKeys++
+			}
+		}
+		Expect(sessionKeys).To(BeNumerically(">", 0))
+		Expect(userDataKeys).To(BeNumerically(">", 0))
+	})
+
+	It("denies access without user data in redis", func() {
+		resp, _ := get("http://localhost" + server.Addr + "/redis/api/v2/resource")
+		Expect(resp.StatusCode).To(Equal(401))
+	})
+})
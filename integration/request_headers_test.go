@@ -0,0 +1,47 @@
+package integration_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"net/http"
+)
+
+var _ = Describe("Request headers sanitizing", func() {
+
+	getWithForgedHeaders := func(client *http.Client, path string) (*http.Response, http.Header) {
+		request, err := http.NewRequest("GET", "http://localhost"+server.Addr+path, nil)
+		Expect(err).NotTo(HaveOccurred())
+		request.Header.Set("X-USER-DATA", "forged-token")
+		request.Header.Set("X-User-Id", "admin")
+		request.Header.Set("X-Debug", "true")
+		request.Header.Set("X-Gateway", "forged")
+		resp, err := client.Do(request)
+		Expect(err).NotTo(HaveOccurred())
+		_ = resp.Body.Close()
+		return resp, headerRecorderStub.LastHeaders()
+	}
+
+	It("removes user data headers on routes without user data sender", func() {
+		resp, headers := getWithForgedHeaders(buildClient(), "/plain/resource")
+		Expect(resp.StatusCode).To(Equal(200))
+
+		Expect(headers).NotTo(HaveKey("X-User-Data"))
+		Expect(headers).NotTo(HaveKey("X-User-Id"))
+	})
+
+	It("removes and overwrites configured headers", func() {
+		_, headers := getWithForgedHeaders(buildClient(), "/plain/resource")
+
+		Expect(headers).NotTo(HaveKey("X-Debug"))
+		Expect(headers["X-Gateway"]).To(Equal([]string{"ordinator"}))
+	})
+
+	It("forwards only the user data header of the gateway", func() {
+		resp, headers := getWithForgedHeaders(authenticatedClient(), "/signed/resource")
+		Expect(resp.StatusCode).To(Equal(200))
+
+		Expect(headers["X-User-Data"]).To(HaveLen(1))
+		Expect(headers.Get("X-User-Data")).NotTo(Equal("forged-token"))
+		Expect(headers).NotTo(HaveKey("X-User-Id"))
+	})
+})
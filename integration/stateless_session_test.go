@@ -0,0 +1,57 @@
+package integration_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"net/url"
+)
+
+var _ = Describe("Cookie session mode", func() {
+
+	It("keeps login state and user data in the sealed cookie", func() {
+		client := buildClient()
+		resp, message := getByClient(client, "http://localhost"+server.Addr+"/stateless/authentication/oidc")
+		Expect(resp.StatusCode).To(Equal(200))
+
+		messageMap := unmarshalToMap(message)
+		Expect(messageMap).To(HaveKeyWithValue("service", "resource"))
+		Expect(messageMap).To(HaveKeyWithValue("version", "stateless"))
+
+		resp, _ = getByClient(client, "http://localhost"+server.Addr+"/stateless/api/v2/resource")
+		Expect(resp.StatusCode).To(Equal(200))
+	})
+
+	It("expires the sealed cookie on logout", func() {
+		client := buildClient()
+		resp, _ := getByClient(client, "http://localhost"+server.Addr+"/stateless/authentication/oidc")
+		Expect(resp.StatusCode).To(Equal(200))
+
+		resp, _ = logoutByClient(noRedirectClient(client), "/stateless/authentication/logout", "")
+		Expect(resp.StatusCode).To(Equal(302))
+		cookies := resp.Cookies()
+		Expect(cookies).To(HaveLen(1))
+		Expect(cookies[0].Name).To(Equal("stateless-session"))
+		Expect(cookies[0].MaxAge).To(BeNumerically("<", 0))
+
+		resp, _ = getByClient(client, "http://localhost"+server.Addr+"/stateless/api/v2/resource")
+		Expect(resp.StatusCode).To(Equal(401))
+	})
+
+	It("denies access with a forged session cookie", func() {
+		client := buildClient()
+		resp, _ := getByClient(client, "http://localhost"+server.Addr+"/stateless/authentication/oidc")
+		Expect(resp.StatusCode).To(Equal(200))
+
+		gatewayUrl, _ := url.Parse("http://localhost" + server.Addr + "/stateless/")
+		cookies := client.Jar.Cookies(gatewayUrl)
+		Expect(cookies).NotTo(BeEmpty())
+		for _, cookie := range cookies {
+			cookie.Value = cookie.Value[:len(cookie.Value)-2] + "AA"
+		}
+		forgedClient := buildClient()
+		forgedClient.Jar.SetCookies(gatewayUrl, cookies)
+
+		resp, _ = getByClient(forgedClient, "http://localhost"+server.Addr+"/stateless/api/v2/resource")
+		Expect(resp.StatusCode).To(Equal(401))
+	})
+})
@@ -0,0 +1,75 @@
+package integration_test
+
+import (
+	"bufio"
+	"github.com/gorilla/websocket"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var _ = Describe("Streaming through authenticated routes", func() {
+
+	It("proxies WebSocket messages after authenticated handshake", func() {
+		conn := dialWebSocket(authenticatedClient())
+		defer conn.Close()
+
+		Expect(conn.WriteMessage(websocket.TextMessage, []byte("hello"))).To(Succeed())
+		messageType, message, err := conn.ReadMessage()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(messageType).To(Equal(websocket.TextMessage))
+		Expect(string(message)).To(Equal("hello"))
+	})
+
+	It("denies WebSocket handshake without user data", func() {
+		dialer := websocket.Dialer{Jar: buildClient().Jar}
+		_, resp, err := dialer.Dial("ws://localhost"+server.Addr+"/streaming/ws/echo", nil)
+		Expect(err).To(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(401))
+	})
+
+	It("closes idle WebSocket connection after route idle timeout", func() {
+		conn := dialWebSocket(authenticatedClient())
+		defer conn.Close()
+
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		start := time.Now()
+		_, _, err := conn.ReadMessage()
+		Expect(err).To(HaveOccurred())
+		Expect(time.Since(start)).To(BeNumerically("<", 3*time.Second))
+	})
+
+	It("flushes server-sent events as they are sent", func() {
+		client := authenticatedClient()
+		resp, err := client.Get("http://localhost" + server.Addr + "/streaming/events")
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(200))
+		Expect(resp.Header.Get("Content-Type")).To(Equal("text/event-stream"))
+
+		start := time.Now()
+		reader := bufio.NewReader(resp.Body)
+		line, err := reader.ReadString('\n')
+		Expect(err).NotTo(HaveOccurred())
+		Expect(strings.TrimSpace(line)).To(Equal("data: event-1"))
+		// Rest of the events are sent with pauses, the first one must not wait for them
+		Expect(time.Since(start)).To(BeNumerically("<", 300*time.Millisecond))
+	})
+})
+
+func authenticatedClient() *http.Client {
+	client := buildClient()
+	resp, _ := getByClient(client, "http://localhost"+server.Addr+"/authentication/oidc")
+	Expect(resp.StatusCode).To(Equal(200))
+	return client
+}
+
+func dialWebSocket(client *http.Client) *websocket.Conn {
+	dialer := websocket.Dialer{Jar: client.Jar}
+	conn, resp, err := dialer.Dial("ws://localhost"+server.Addr+"/streaming/ws/echo", nil)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(resp.StatusCode).To(Equal(http.StatusSwitchingProtocols))
+	return conn
+}
@@ -0,0 +1,43 @@
+package integration_test
+
+import (
+	"github.com/Alcereo/ordinator/pkg/jwks"
+	"github.com/dgrijalva/jwt-go"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"time"
+)
+
+var _ = Describe("User data JWKS", func() {
+	jwksUrl := func() string {
+		return "http://localhost" + server.Addr + "/.well-known/user-data-jwks"
+	}
+
+	It("publishes public keys of user data serializers", func() {
+		resp, message := get(jwksUrl())
+		Expect(resp.StatusCode).To(Equal(200))
+
+		keySet, err := jwks.Parse(message)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(keySet.Keys).To(HaveLen(1))
+		Expect(keySet.Keys[0].KeyType).To(Equal("EC"))
+		Expect(keySet.Keys[0].Algorithm).To(Equal("ES256"))
+		Expect(keySet.Keys[0].KeyId).NotTo(BeEmpty())
+	})
+
+	It("lets backends verify user data header by published keys", func() {
+		resp, _ := getByClient(authenticatedClient(), "http://localhost"+server.Addr+"/signed/resource")
+		Expect(resp.StatusCode).To(Equal(200))
+		userDataHeader := headerRecorderStub.LastHeaders().Get("X-USER-DATA")
+		Expect(userDataHeader).NotTo(BeEmpty())
+
+		claims := jwt.MapClaims{}
+		keySource := jwks.NewRemoteKeySource(jwksUrl(), time.Minute)
+		_, err := jwt.ParseWithClaims(userDataHeader, claims, jwks.Keyfunc(keySource))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(claims).To(HaveKeyWithValue("sub", "oidc-user-1"))
+		Expect(claims).To(HaveKeyWithValue("iss", "ordinator"))
+		Expect(claims).To(HaveKeyWithValue("aud", "backend"))
+		Expect(claims).To(HaveKey("exp"))
+	})
+})
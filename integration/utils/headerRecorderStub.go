@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+)
+
+// HeaderRecorderStub answers any request with 200 and keeps headers and body of the last request,
+// so tests can check what the gateway forwards to backends.
+type HeaderRecorderStub struct {
+	Server *httptest.Server
+
+	mutex   sync.Mutex
+	headers http.Header
+	body    []byte
+}
+
+func CreateHeaderRecorderStub() *HeaderRecorderStub {
+	stub := &HeaderRecorderStub{}
+	stub.Server = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		body, _ := ioutil.ReadAll(request.Body)
+		stub.mutex.Lock()
+		stub.headers = request.Header.Clone()
+		stub.body = body
+		stub.mutex.Unlock()
+		writeJson(writer, 200, JsonMap{"status": "OK"})
+	}))
+	return stub
+}
+
+func (stub *HeaderRecorderStub) LastHeaders() http.Header {
+	stub.mutex.Lock()
+	defer stub.mutex.Unlock()
+	return stub.headers
+}
+
+func (stub *HeaderRecorderStub) LastBody() []byte {
+	stub.mutex.Lock()
+	defer stub.mutex.Unlock()
+	return stub.body
+}
+
+func (stub *HeaderRecorderStub) URL() string {
+	return stub.Server.URL
+}
+
+func (stub *HeaderRecorderStub) Close() {
+	stub.Server.Close()
+}
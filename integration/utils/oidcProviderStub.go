@@ -0,0 +1,231 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	OidcKeyId       = "stub-key-1"
+	OidcForgedKeyId = "stub-key-2"
+)
+
+type OidcProviderStub struct {
+	Server       *httptest.Server
+	ClientId     string
+	ClientSecret string
+	// Authorization code -> ID token claims. The token is signed with the published key.
+	Codes map[string]JsonMap
+	// Authorization code -> ID token claims. The token is signed with a key unknown to the JWKS.
+	ForgedCodes map[string]JsonMap
+	// Code issued by the authorization endpoint
+	AuthorizeCode string
+
+	signingKey      *rsa.PrivateKey
+	forgedKey       *rsa.PrivateKey
+	challengesMutex sync.Mutex
+	challenges      map[string]string
+	nonces          map[string]string
+}
+
+// CreateOidcProviderStub starts a provider serving discovery, JWKS, authorization and token endpoints.
+// Claims 'iss', 'aud', 'iat' and 'exp' are added to every issued ID token,
+// 'nonce' is added when the authorization request had one.
+func CreateOidcProviderStub(clientId string, clientSecret string) *OidcProviderStub {
+	stub := &OidcProviderStub{
+		ClientId:     clientId,
+		ClientSecret: clientSecret,
+		Codes:        make(map[string]JsonMap),
+		ForgedCodes:  make(map[string]JsonMap),
+		signingKey:   generateRsaKey(),
+		forgedKey:    generateRsaKey(),
+		challenges:   make(map[string]string),
+		nonces:       make(map[string]string),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", stub.discovery)
+	mux.HandleFunc("/jwks", stub.jwks)
+	mux.HandleFunc("/authorize", stub.authorize)
+	mux.HandleFunc("/token", stub.token)
+	stub.Server = httptest.NewServer(mux)
+	return stub
+}
+
+func (stub *OidcProviderStub) URL() string {
+	return stub.Server.URL
+}
+
+func (stub *OidcProviderStub) Close() {
+	stub.Server.Close()
+}
+
+func (stub *OidcProviderStub) discovery(writer http.ResponseWriter, request *http.Request) {
+	writeJson(writer, 200, JsonMap{
+		"issuer":                 stub.URL(),
+		"authorization_endpoint": stub.URL() + "/authorize",
+		"token_endpoint":         stub.URL() + "/token",
+		"jwks_uri":               stub.URL() + "/jwks",
+	})
+}
+
+func (stub *OidcProviderStub) jwks(writer http.ResponseWriter, request *http.Request) {
+	publicKey := stub.signingKey.PublicKey
+	writeJson(writer, 200, JsonMap{
+		"keys": []JsonMap{
+			{
+				"kty": "RSA",
+				"kid": OidcKeyId,
+				"use": "sig",
+				"alg": "RS256",
+				"n":   base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes()),
+			},
+		},
+	})
+}
+
+// authorize immediately redirects back with AuthorizeCode, remembering the PKCE challenge and nonce for it
+func (stub *OidcProviderStub) authorize(writer http.ResponseWriter, request *http.Request) {
+	query := request.URL.Query()
+	if query.Get("client_id") != stub.ClientId || query.Get("code_challenge_method") != "S256" {
+		writeJson(writer, 400, JsonMap{"error": "invalid_request"})
+		return
+	}
+	stub.challengesMutex.Lock()
+	stub.challenges[stub.AuthorizeCode] = query.Get("code_challenge")
+	stub.nonces[stub.AuthorizeCode] = query.Get("nonce")
+	stub.challengesMutex.Unlock()
+
+	redirectUrl, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil {
+		writeJson(writer, 400, JsonMap{"error": "invalid_request"})
+		return
+	}
+	redirectQuery := redirectUrl.Query()
+	redirectQuery.Set("code", stub.AuthorizeCode)
+	redirectQuery.Set("state", query.Get("state"))
+	redirectUrl.RawQuery = redirectQuery.Encode()
+	http.Redirect(writer, request, redirectUrl.String(), 302)
+}
+
+func (stub *OidcProviderStub) token(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != "POST" {
+		writeJson(writer, 405, JsonMap{"error": "invalid_request"})
+		return
+	}
+	if err := request.ParseForm(); err != nil {
+		writeJson(writer, 400, JsonMap{"error": "invalid_request"})
+		return
+	}
+	if request.PostForm.Get("client_id") != stub.ClientId ||
+		request.PostForm.Get("client_secret") != stub.ClientSecret {
+		writeJson(writer, 401, JsonMap{"error": "invalid_client"})
+		return
+	}
+
+	code := request.PostForm.Get("code")
+	stub.challengesMutex.Lock()
+	challenge, challenged := stub.challenges[code]
+	nonce := stub.nonces[code]
+	delete(stub.challenges, code)
+	delete(stub.nonces, code)
+	stub.challengesMutex.Unlock()
+	if challenged {
+		hash := sha256.Sum256([]byte(request.PostForm.Get("code_verifier")))
+		if base64.RawURLEncoding.EncodeToString(hash[:]) != challenge {
+			writeJson(writer, 400, JsonMap{"error": "invalid_grant"})
+			return
+		}
+	}
+
+	if claims, found := stub.Codes[code]; found {
+		stub.writeToken(writer, claims, nonce, stub.signingKey, OidcKeyId)
+		return
+	}
+	if claims, found := stub.ForgedCodes[code]; found {
+		stub.writeToken(writer, claims, nonce, stub.forgedKey, OidcForgedKeyId)
+		return
+	}
+	writeJson(writer, 400, JsonMap{"error": "invalid_grant"})
+}
+
+// SignToken signs claims as is with the published key, for clients presenting provider tokens as bearer
+func (stub *OidcProviderStub) SignToken(claims JsonMap) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims(claims))
+	token.Header["kid"] = OidcKeyId
+	signed, err := token.SignedString(stub.signingKey)
+	if err != nil {
+		panic(err)
+	}
+	return signed
+}
+
+// SignForgedToken signs claims with a key unknown to the JWKS
+func (stub *OidcProviderStub) SignForgedToken(claims JsonMap) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims(claims))
+	token.Header["kid"] = OidcKeyId
+	signed, err := token.SignedString(stub.forgedKey)
+	if err != nil {
+		panic(err)
+	}
+	return signed
+}
+
+func (stub *OidcProviderStub) writeToken(writer http.ResponseWriter, claims JsonMap, nonce string, key *rsa.PrivateKey, kid string) {
+	mapClaims := jwt.MapClaims{
+		"iss": stub.URL(),
+		"aud": stub.ClientId,
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	if nonce != "" {
+		mapClaims["nonce"] = nonce
+	}
+	for name, value := range claims {
+		mapClaims[name] = value
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, mapClaims)
+	token.Header["kid"] = kid
+	idToken, err := token.SignedString(key)
+	if err != nil {
+		writeJson(writer, 500, JsonMap{"error": err.Error()})
+		return
+	}
+	writeJson(writer, 200, JsonMap{
+		"access_token": "oidc-access-token",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+func writeJson(writer http.ResponseWriter, status int, body JsonMap) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	bytes, err := json.Marshal(body)
+	if err != nil {
+		_, _ = fmt.Fprint(writer, err.Error())
+		return
+	}
+	_, _ = writer.Write(bytes)
+}
+
+func generateRsaKey() *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
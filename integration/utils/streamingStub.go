@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"fmt"
+	"github.com/gorilla/websocket"
+	"net/http"
+	"net/http/httptest"
+	"time"
+)
+
+// CreateStreamingStub serves WebSocket echo on '/ws/echo' and three server-sent events
+// on '/events', sent with a pause so buffering in the gateway would be noticed.
+func CreateStreamingStub(eventsPause time.Duration) *httptest.Server {
+	upgrader := websocket.Upgrader{}
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/ws/echo", func(writer http.ResponseWriter, request *http.Request) {
+		conn, err := upgrader.Upgrade(writer, request, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			messageType, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err := conn.WriteMessage(messageType, message); err != nil {
+				return
+			}
+		}
+	})
+
+	mux.HandleFunc("/events", func(writer http.ResponseWriter, request *http.Request) {
+		flusher, ok := writer.(http.Flusher)
+		if !ok {
+			writer.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		writer.Header().Set("Content-Type", "text/event-stream")
+		writer.Header().Set("Cache-Control", "no-cache")
+		for i := 1; i <= 3; i++ {
+			_, _ = fmt.Fprintf(writer, "data: event-%v\n\n", i)
+			flusher.Flush()
+			select {
+			case <-time.After(eventsPause):
+			case <-request.Context().Done():
+				return
+			}
+		}
+	})
+
+	return httptest.NewServer(mux)
+}
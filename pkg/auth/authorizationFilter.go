@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"fmt"
+	"github.com/Alcereo/ordinator/pkg/common"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+)
+
+// AuthorizationRule decides whether the authenticated user is allowed to the route
+type AuthorizationRule interface {
+	Allows(userData *common.UserData) bool
+}
+
+// AllRule allows when each of the rules allows
+type AllRule []AuthorizationRule
+
+func (rule AllRule) Allows(userData *common.UserData) bool {
+	for _, nested := range rule {
+		if !nested.Allows(userData) {
+			return false
+		}
+	}
+	return true
+}
+
+// AnyRule allows when one of the rules allows
+type AnyRule []AuthorizationRule
+
+func (rule AnyRule) Allows(userData *common.UserData) bool {
+	for _, nested := range rule {
+		if nested.Allows(userData) {
+			return true
+		}
+	}
+	return false
+}
+
+// EmailDomainRule allows emails of one of the domains, verified by the provider
+type EmailDomainRule []string
+
+func (rule EmailDomainRule) Allows(userData *common.UserData) bool {
+	at := strings.LastIndex(userData.Email, "@")
+	if at < 0 || !emailVerified(userData) {
+		return false
+	}
+	return containsFold(rule, userData.Email[at+1:])
+}
+
+// EmailRule allows one of the emails, verified by the provider
+type EmailRule []string
+
+func (rule EmailRule) Allows(userData *common.UserData) bool {
+	return userData.Email != "" && emailVerified(userData) && containsFold(rule, userData.Email)
+}
+
+// IdentifierRule allows one of the provider identifiers
+type IdentifierRule []string
+
+func (rule IdentifierRule) Allows(userData *common.UserData) bool {
+	for _, identifier := range rule {
+		if identifier == userData.Identifier {
+			return true
+		}
+	}
+	return false
+}
+
+// GroupRule allows members of one of the groups
+type GroupRule []string
+
+func (rule GroupRule) Allows(userData *common.UserData) bool {
+	for _, group := range rule {
+		for _, userGroup := range userData.Groups {
+			if group == userGroup {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ClaimRule allows when the claim equals the value or, for array claims, contains it
+type ClaimRule struct {
+	Name  string
+	Value string
+}
+
+func (rule ClaimRule) Allows(userData *common.UserData) bool {
+	switch value := userData.Claims[rule.Name].(type) {
+	case nil:
+		return false
+	case []interface{}:
+		for _, element := range value {
+			if fmt.Sprint(element) == rule.Value {
+				return true
+			}
+		}
+		return false
+	default:
+		return fmt.Sprint(value) == rule.Value
+	}
+}
+
+// emailVerified requires the provider to state the email is verified, emails of providers
+// without the claim are not trusted. Google v2 user info names the claim 'verified_email'.
+func emailVerified(userData *common.UserData) bool {
+	for _, name := range []string{"email_verified", "verified_email"} {
+		if verified := userData.Claims[name]; verified == true || verified == "true" {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(values []string, expected string) bool {
+	for _, value := range values {
+		if strings.EqualFold(value, expected) {
+			return true
+		}
+	}
+	return false
+}
+
+type authorizationFilter struct {
+	next         *common.RequestHandler
+	Name         string
+	rule         AuthorizationRule
+	redirectPage string
+}
+
+// NewAuthorizationFilter requires user data in the request context, so it goes after
+// the user or bearer authentication filter. Denied requests get 403, or are redirected
+// to the redirect page when it's set.
+func NewAuthorizationFilter(name string, rule AuthorizationRule, redirectPage string) *authorizationFilter {
+	return &authorizationFilter{
+		next:         nil,
+		Name:         name,
+		rule:         rule,
+		redirectPage: redirectPage,
+	}
+}
+
+func (filter *authorizationFilter) Handle(log *log.Entry, writer http.ResponseWriter, request *http.Request) {
+	log = log.WithField("filterName", filter.Name)
+
+	userData, found := request.Context().Value(common.UserDataContextKey).(*common.UserData)
+	if !found || userData == nil {
+		log.Debugf("User data not found in the request context. Authentication filter required before")
+		filter.deny(writer, request, 401)
+		return
+	}
+	if !filter.rule.Allows(userData) {
+		log.Debugf("User is not allowed. Identifier: %v", userData.Identifier)
+		filter.deny(writer, request, 403)
+		return
+	}
+
+	if filter.next != nil {
+		(*filter.next).Handle(log, writer, request)
+	} else {
+		log.Debugf("Authorization filter: %v doesn't have next handler", filter.Name)
+	}
+}
+
+func (filter *authorizationFilter) deny(writer http.ResponseWriter, request *http.Request, status int) {
+	if filter.redirectPage != "" {
+		http.Redirect(writer, request, filter.redirectPage, 302)
+	} else {
+		writer.WriteHeader(status)
+	}
+}
+
+func (filter *authorizationFilter) SetNext(handler common.RequestHandler) {
+	filter.next = &handler
+}
@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"context"
+	"github.com/Alcereo/ordinator/pkg/common"
+	"github.com/sirupsen/logrus"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuthorizationRules(t *testing.T) {
+	user := &common.UserData{
+		Identifier: "u1",
+		Email:      "User@Example.com",
+		Groups:     []string{"staff"},
+		Claims: map[string]interface{}{
+			"hd":             "example.com",
+			"roles":          []interface{}{"reader", "writer"},
+			"email_verified": true,
+		},
+	}
+	unverified := &common.UserData{
+		Email:  "user@example.com",
+		Claims: map[string]interface{}{"email_verified": false},
+	}
+	withoutClaim := &common.UserData{
+		Email: "user@example.com",
+	}
+	googleVerified := &common.UserData{
+		Email:  "user@example.com",
+		Claims: map[string]interface{}{"verified_email": true},
+	}
+	cases := []struct {
+		rule     AuthorizationRule
+		userData *common.UserData
+		allowed  bool
+	}{
+		{EmailDomainRule{"example.com"}, user, true},
+		{EmailDomainRule{"other.com"}, user, false},
+		{EmailDomainRule{"example.com"}, unverified, false},
+		{EmailRule{"user@example.com"}, user, true},
+		{EmailRule{"user@example.com"}, unverified, false},
+		{EmailDomainRule{"example.com"}, withoutClaim, false},
+		{EmailRule{"user@example.com"}, withoutClaim, false},
+		{EmailRule{"user@example.com"}, googleVerified, true},
+		{IdentifierRule{"u2", "u1"}, user, true},
+		{GroupRule{"admins"}, user, false},
+		{ClaimRule{Name: "hd", Value: "example.com"}, user, true},
+		{ClaimRule{Name: "roles", Value: "writer"}, user, true},
+		{ClaimRule{Name: "missing", Value: ""}, user, false},
+		{AllRule{GroupRule{"staff"}, EmailDomainRule{"example.com"}}, user, true},
+		{AllRule{GroupRule{"staff"}, GroupRule{"admins"}}, user, false},
+		{AnyRule{GroupRule{"admins"}, IdentifierRule{"u1"}}, user, true},
+		{AnyRule{GroupRule{"admins"}, IdentifierRule{"u2"}}, user, false},
+	}
+	for i, testCase := range cases {
+		if allowed := testCase.rule.Allows(testCase.userData); allowed != testCase.allowed {
+			t.Fatalf("Case %v: rule %+v expect allowed %v, got %v", i, testCase.rule, testCase.allowed, allowed)
+		}
+	}
+}
+
+func TestAuthorizationFilterRedirects(t *testing.T) {
+	// Given
+	filter := NewAuthorizationFilter("Filter name", GroupRule{"admins"}, "/pages/forbidden")
+	filter.SetNext(&contextCapturingHandler{})
+	request := httptest.NewRequest("GET", "/foo", nil)
+	request = request.WithContext(context.WithValue(request.Context(), common.UserDataContextKey, &common.UserData{Identifier: "u1"}))
+
+	// When
+	w := httptest.NewRecorder()
+	filter.Handle(logrus.NewEntry(logrus.StandardLogger()), w, request)
+
+	// Then
+	if w.Code != 302 || w.Header().Get("Location") != "/pages/forbidden" {
+		t.Fatalf("Expect redirect to the redirect page, got: %v %v", w.Code, w.Header().Get("Location"))
+	}
+}
@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Alcereo/ordinator/pkg/common"
+	"github.com/Alcereo/ordinator/pkg/jwks"
+	"github.com/dgrijalva/jwt-go"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+)
+
+// BearerVerifier checks the signature and the standard claims of bearer tokens.
+// Exactly one of the verification methods is used: HS256 shared secret or RS256/ES256 keys of a JWKS.
+type BearerVerifier struct {
+	parser   *jwt.Parser
+	keyfunc  jwt.Keyfunc
+	Issuer   string
+	Audience []string
+	// A JWKS usually signs tokens of other clients too, they are told apart by 'iss' and 'aud' only
+	claimsRequired bool
+}
+
+func NewHmacBearerVerifier(secret string, issuer string, audience []string) *BearerVerifier {
+	return &BearerVerifier{
+		parser: &jwt.Parser{ValidMethods: []string{jwt.SigningMethodHS256.Alg()}},
+		keyfunc: func(token *jwt.Token) (interface{}, error) {
+			return []byte(secret), nil
+		},
+		Issuer:   issuer,
+		Audience: audience,
+	}
+}
+
+func NewJwksBearerVerifier(keySource jwks.KeySource, issuer string, audience []string) *BearerVerifier {
+	return &BearerVerifier{
+		parser:         &jwt.Parser{ValidMethods: []string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodES256.Alg()}},
+		keyfunc:        jwks.Keyfunc(keySource),
+		Issuer:         issuer,
+		Audience:       audience,
+		claimsRequired: true,
+	}
+}
+
+// Verify returns user data of the token subject. Besides the signature, 'exp' is required,
+// 'nbf' is checked when present. 'iss' and 'aud' are always checked for JWKS keys, a verifier
+// without them configured denies every token. For the shared secret they are checked when configured.
+func (verifier *BearerVerifier) Verify(token string) (*common.UserData, error) {
+	claims := jwt.MapClaims{}
+	if _, err := verifier.parser.ParseWithClaims(token, claims, verifier.keyfunc); err != nil {
+		return nil, err
+	}
+	if _, found := claims["exp"]; !found {
+		return nil, errors.New("'exp' claim is required")
+	}
+	if verifier.Issuer != "" || verifier.claimsRequired {
+		if issuer, _ := claims["iss"].(string); issuer == "" || issuer != verifier.Issuer {
+			return nil, fmt.Errorf("unexpected issuer '%v'", issuer)
+		}
+	}
+	if (len(verifier.Audience) > 0 || verifier.claimsRequired) && !audienceContainsAny(claims["aud"], verifier.Audience) {
+		return nil, errors.New("none of the expected audiences found in the token")
+	}
+
+	var bearerClaims OidcClaims
+	if err := remarshal(claims, &bearerClaims); err != nil {
+		return nil, err
+	}
+	if bearerClaims.Subject == "" {
+		return nil, errors.New("'sub' claim is required")
+	}
+	bearerClaims.Claims = claims
+	return bearerClaims.toUserData(), nil
+}
+
+func audienceContainsAny(audience interface{}, expected []string) bool {
+	for _, value := range expected {
+		if audienceContains(audience, value) {
+			return true
+		}
+	}
+	return false
+}
+
+type bearerAuthenticationFilter struct {
+	next             *common.RequestHandler
+	Name             string
+	verifier         *BearerVerifier
+	userDataRequired bool
+}
+
+// NewBearerAuthenticationFilter authenticates requests by the 'Authorization: Bearer' token.
+// Requests without the token pass when user data is not required or is already found,
+// for example by the user authentication filter. Invalid tokens are always denied.
+func NewBearerAuthenticationFilter(
+	name string,
+	verifier *BearerVerifier,
+	userDataRequired bool,
+) *bearerAuthenticationFilter {
+	return &bearerAuthenticationFilter{
+		next:             nil,
+		Name:             name,
+		verifier:         verifier,
+		userDataRequired: userDataRequired,
+	}
+}
+
+func (filter *bearerAuthenticationFilter) Handle(log *log.Entry, writer http.ResponseWriter, request *http.Request) {
+	log = log.WithField("filterName", filter.Name)
+
+	token, found := bearerToken(request)
+	if !found {
+		_, authenticated := request.Context().Value(common.UserDataContextKey).(*common.UserData)
+		if filter.userDataRequired && !authenticated {
+			log.Debugf("Bearer token not found in the request")
+			writer.Header().Set("WWW-Authenticate", "Bearer")
+			writer.WriteHeader(401)
+			return
+		}
+		filter.handleNext(log, writer, request)
+		return
+	}
+
+	userData, err := filter.verifier.Verify(token)
+	if err != nil {
+		log.Debugf("Bearer token verification error. Reason: %v", err)
+		writer.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		writer.WriteHeader(401)
+		return
+	}
+	log.Debugf("Bearer token verified and user data put to context. Identifier: %v", userData.Identifier)
+	newContext := context.WithValue(request.Context(), common.UserDataContextKey, userData)
+	filter.handleNext(log, writer, request.WithContext(newContext))
+}
+
+func (filter *bearerAuthenticationFilter) handleNext(log *log.Entry, writer http.ResponseWriter, request *http.Request) {
+	if filter.next != nil {
+		(*filter.next).Handle(log, writer, request)
+	} else {
+		log.Debugf("Bearer authentication filter: %v doesn't have next handler", filter.Name)
+	}
+}
+
+func (filter *bearerAuthenticationFilter) SetNext(handler common.RequestHandler) {
+	filter.next = &handler
+}
+
+func bearerToken(request *http.Request) (string, bool) {
+	authorization := request.Header.Get("Authorization")
+	const prefix = "bearer "
+	if len(authorization) <= len(prefix) || strings.ToLower(authorization[:len(prefix)]) != prefix {
+		return "", false
+	}
+	return strings.TrimSpace(authorization[len(prefix):]), true
+}
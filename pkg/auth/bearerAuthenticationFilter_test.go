@@ -0,0 +1,185 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/Alcereo/ordinator/pkg/common"
+	"github.com/Alcereo/ordinator/pkg/jwks"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBearerTokenByJwksFile(t *testing.T) {
+	// Given
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Generating key error: %v", err)
+	}
+	path, cleanup := writeJwksFile(t, key, "key-1")
+	defer cleanup()
+	keySource, err := jwks.NewFileKeySource(path)
+	if err != nil {
+		t.Fatalf("Reading JWKS file error: %v", err)
+	}
+	filter := NewBearerAuthenticationFilter("Filter name", NewJwksBearerVerifier(keySource, "https://issuer", []string{"api"}), true)
+	next := &contextCapturingHandler{}
+	filter.SetNext(next)
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"iss":   "https://issuer",
+		"aud":   "api",
+		"sub":   "client-1",
+		"email": "client-1@example.com",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	})
+	token.Header["kid"] = "key-1"
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("Signing token error: %v", err)
+	}
+
+	// When
+	w := httptest.NewRecorder()
+	filter.Handle(logrus.NewEntry(logrus.StandardLogger()), w, requestWithBearer(signed))
+
+	// Then
+	if w.Code != 200 {
+		t.Fatalf("Expect token accepted, got: %v", w.Code)
+	}
+	if next.userData == nil || next.userData.Identifier != "client-1" || next.userData.Email != "client-1@example.com" {
+		t.Fatalf("Expect user data from token claims in context, got: %+v", next.userData)
+	}
+}
+
+func TestBearerTokenOfOtherAudienceByJwks(t *testing.T) {
+	// Given
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Generating key error: %v", err)
+	}
+	path, cleanup := writeJwksFile(t, key, "key-1")
+	defer cleanup()
+	keySource, err := jwks.NewFileKeySource(path)
+	if err != nil {
+		t.Fatalf("Reading JWKS file error: %v", err)
+	}
+	filter := NewBearerAuthenticationFilter("Filter name", NewJwksBearerVerifier(keySource, "https://issuer", []string{"api"}), true)
+	unconfigured := NewBearerAuthenticationFilter("Filter name", NewJwksBearerVerifier(keySource, "", nil), true)
+	filter.SetNext(&contextCapturingHandler{})
+	unconfigured.SetNext(&contextCapturingHandler{})
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"iss": "https://issuer",
+		"aud": "other-client",
+		"sub": "client-1",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	token.Header["kid"] = "key-1"
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("Signing token error: %v", err)
+	}
+
+	// When
+	w := httptest.NewRecorder()
+	filter.Handle(logrus.NewEntry(logrus.StandardLogger()), w, requestWithBearer(signed))
+	unconfiguredW := httptest.NewRecorder()
+	unconfigured.Handle(logrus.NewEntry(logrus.StandardLogger()), unconfiguredW, requestWithBearer(signed))
+
+	// Then
+	if w.Code != 401 {
+		t.Fatalf("Expect token of other audience denied, got: %v", w.Code)
+	}
+	if unconfiguredW.Code != 401 {
+		t.Fatalf("Expect token denied without configured issuer and audience, got: %v", unconfiguredW.Code)
+	}
+}
+
+func TestBearerTokenByHmacSecret(t *testing.T) {
+	verifier := NewHmacBearerVerifier("secret", "", nil)
+	cases := []struct {
+		method   jwt.SigningMethod
+		secret   string
+		claims   jwt.MapClaims
+		accepted bool
+	}{
+		{jwt.SigningMethodHS256, "secret", jwt.MapClaims{"sub": "c1", "exp": time.Now().Add(time.Hour).Unix()}, true},
+		{jwt.SigningMethodHS256, "other", jwt.MapClaims{"sub": "c1", "exp": time.Now().Add(time.Hour).Unix()}, false},
+		{jwt.SigningMethodHS512, "secret", jwt.MapClaims{"sub": "c1", "exp": time.Now().Add(time.Hour).Unix()}, false},
+		{jwt.SigningMethodHS256, "secret", jwt.MapClaims{"sub": "c1"}, false},
+		{jwt.SigningMethodHS256, "secret", jwt.MapClaims{"exp": time.Now().Add(time.Hour).Unix()}, false},
+	}
+	for i, testCase := range cases {
+		signed, err := jwt.NewWithClaims(testCase.method, testCase.claims).SignedString([]byte(testCase.secret))
+		if err != nil {
+			t.Fatalf("Signing token error: %v", err)
+		}
+		if _, err := verifier.Verify(signed); (err == nil) != testCase.accepted {
+			t.Fatalf("Case %v: expect accepted %v, got error: %v", i, testCase.accepted, err)
+		}
+	}
+}
+
+func TestBearerTokenNotRequired(t *testing.T) {
+	// Given
+	filter := NewBearerAuthenticationFilter("Filter name", NewHmacBearerVerifier("secret", "", nil), false)
+	next := &contextCapturingHandler{}
+	filter.SetNext(next)
+
+	// When
+	w := httptest.NewRecorder()
+	filter.Handle(logrus.NewEntry(logrus.StandardLogger()), w, httptest.NewRequest("GET", "/foo", nil))
+	invalid := httptest.NewRecorder()
+	filter.Handle(logrus.NewEntry(logrus.StandardLogger()), invalid, requestWithBearer("not-a-token"))
+
+	// Then
+	if w.Code != 200 || next.userData != nil {
+		t.Fatalf("Expect anonymous request passed, got: %v", w.Code)
+	}
+	if invalid.Code != 401 {
+		t.Fatalf("Expect invalid token denied even when not required, got: %v", invalid.Code)
+	}
+}
+
+type contextCapturingHandler struct {
+	userData *common.UserData
+}
+
+func (handler *contextCapturingHandler) Handle(log *logrus.Entry, writer http.ResponseWriter, request *http.Request) {
+	handler.userData, _ = request.Context().Value(common.UserDataContextKey).(*common.UserData)
+}
+
+func requestWithBearer(token string) *http.Request {
+	request := httptest.NewRequest("GET", "/foo", nil)
+	request.Header.Set("Authorization", "Bearer "+token)
+	return request
+}
+
+func writeJwksFile(t *testing.T, key *ecdsa.PrivateKey, kid string) (string, func()) {
+	dir, err := ioutil.TempDir("", "ordinator-jwks")
+	if err != nil {
+		t.Fatalf("Creating temp dir error: %v", err)
+	}
+	data, _ := json.Marshal(jwks.JsonWebKeySet{Keys: []jwks.JsonWebKey{{
+		KeyType: "EC",
+		KeyId:   kid,
+		Curve:   "P-256",
+		X:       base64.RawURLEncoding.EncodeToString(key.X.Bytes()),
+		Y:       base64.RawURLEncoding.EncodeToString(key.Y.Bytes()),
+	}}})
+	path := filepath.Join(dir, "jwks.json")
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("Writing JWKS file error: %v", err)
+	}
+	return path, func() { _ = os.RemoveAll(dir) }
+}
@@ -0,0 +1,51 @@
+package auth
+
+// tokenClaims describe the token itself rather than the user, they are not kept in user data
+var tokenClaims = map[string]bool{
+	"iss":       true,
+	"aud":       true,
+	"exp":       true,
+	"iat":       true,
+	"nbf":       true,
+	"jti":       true,
+	"nonce":     true,
+	"at_hash":   true,
+	"c_hash":    true,
+	"azp":       true,
+	"auth_time": true,
+	"sid":       true,
+}
+
+// groupClaims are the claims providers commonly put groups and roles to
+var groupClaims = []string{"groups", "roles"}
+
+func userClaims(claims map[string]interface{}) map[string]interface{} {
+	if len(claims) == 0 {
+		return nil
+	}
+	result := make(map[string]interface{}, len(claims))
+	for name, value := range claims {
+		if !tokenClaims[name] {
+			result[name] = value
+		}
+	}
+	return result
+}
+
+// claimGroups accepts both a single string and an array of strings in each of the group claims
+func claimGroups(claims map[string]interface{}) []string {
+	var groups []string
+	for _, name := range groupClaims {
+		switch value := claims[name].(type) {
+		case string:
+			groups = append(groups, value)
+		case []interface{}:
+			for _, group := range value {
+				if group, ok := group.(string); ok {
+					groups = append(groups, group)
+				}
+			}
+		}
+	}
+	return groups
+}
@@ -5,22 +5,32 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/Alcereo/ordinator/pkg/common"
+	"github.com/Alcereo/ordinator/pkg/metrics"
 	"github.com/sirupsen/logrus"
 	"gopkg.in/go-playground/validator.v9"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	googleAuthorizationRequestUrl = "https://accounts.google.com/o/oauth2/v2/auth"
+	googleDefaultRedirectUrl      = "http://localhost:8080/authentication/google"
 )
 
 type googleOAuth2Provider struct {
-	cacheProvider         UserAuthCachePort
-	SuccessLoginUrl       string `validate:"required"`
-	GoogleClientId        string `validate:"required"`
-	GoogleClientSecret    string `validate:"required"`
-	DomainUrl             string `validate:"required"`
-	GrantType             string `validate:"required"`
-	AuthenticationUrl     string `validate:"required"`
-	AccessTokenRequestUrl string `validate:"required"`
-	UserInfoRequestUrl    string `validate:"required"`
+	cacheProvider           UserAuthCachePort
+	SuccessLoginUrl         string `validate:"required"`
+	GoogleClientId          string `validate:"required"`
+	GoogleClientSecret      string `validate:"required"`
+	RedirectUrl             string `validate:"required"`
+	GrantType               string `validate:"required"`
+	AuthorizationRequestUrl string `validate:"required"`
+	AccessTokenRequestUrl   string `validate:"required"`
+	UserInfoRequestUrl      string `validate:"required"`
+	Scopes                  []string
+	keptTokens              KeptTokens
 }
 
 var validate = validator.New()
@@ -30,19 +40,31 @@ func NewGoogleOAuth2Provider(
 	successLoginUrl string,
 	googleClientId string,
 	googleSecretId string,
+	authorizationRequestUrl string,
 	accessTokenRequestUrl string,
 	userInfoRequestUrl string,
+	redirectUrl string,
+	scopes []string,
+	keptTokens KeptTokens,
 ) *googleOAuth2Provider {
+	if authorizationRequestUrl == "" {
+		authorizationRequestUrl = googleAuthorizationRequestUrl
+	}
+	if redirectUrl == "" {
+		redirectUrl = googleDefaultRedirectUrl
+	}
 	provider := &googleOAuth2Provider{
-		cacheProvider:         cacheProvider,
-		SuccessLoginUrl:       successLoginUrl,
-		GoogleClientId:        googleClientId,
-		GoogleClientSecret:    googleSecretId,
-		DomainUrl:             "http://localhost:8080",
-		GrantType:             "authorization_code",
-		AuthenticationUrl:     "/authentication/google",
-		AccessTokenRequestUrl: accessTokenRequestUrl,
-		UserInfoRequestUrl:    userInfoRequestUrl,
+		cacheProvider:           cacheProvider,
+		SuccessLoginUrl:         successLoginUrl,
+		GoogleClientId:          googleClientId,
+		GoogleClientSecret:      googleSecretId,
+		RedirectUrl:             redirectUrl,
+		GrantType:               "authorization_code",
+		AuthorizationRequestUrl: authorizationRequestUrl,
+		AccessTokenRequestUrl:   accessTokenRequestUrl,
+		UserInfoRequestUrl:      userInfoRequestUrl,
+		Scopes:                  scopes,
+		keptTokens:              keptTokens,
 	}
 	err := validate.Struct(provider)
 	if err != nil {
@@ -69,6 +91,23 @@ func (router *googleOAuth2Provider) Handle(log *logrus.Entry, writer http.Respon
 		return
 	}
 
+	if !isLoginCallback(request) {
+		initiateLogin(log, writer, request, router.cacheProvider, session, &authorizationRequest{
+			AuthorizationUrl: router.AuthorizationRequestUrl,
+			ClientId:         router.GoogleClientId,
+			RedirectUrl:      router.RedirectUrl,
+			Scopes:           router.Scopes,
+		})
+		return
+	}
+
+	loginState, err := takeLoginState(request, router.cacheProvider, session)
+	if err != nil {
+		log.Errorf(stage, err)
+		writer.WriteHeader(403)
+		return
+	}
+
 	accessCode, err := getAccessCode(request)
 	if err != nil {
 		log.Errorf(stage, err)
@@ -76,7 +115,7 @@ func (router *googleOAuth2Provider) Handle(log *logrus.Entry, writer http.Respon
 		return
 	}
 
-	userData, err := router.getUserData(log, accessCode)
+	userData, err := router.getUserData(log, accessCode, loginState.CodeVerifier)
 	if err != nil {
 		log.Errorf(stage, err)
 		writer.WriteHeader(403)
@@ -93,10 +132,10 @@ func (router *googleOAuth2Provider) Handle(log *logrus.Entry, writer http.Respon
 	http.Redirect(writer, request, router.SuccessLoginUrl, 302)
 }
 
-func (router *googleOAuth2Provider) getUserData(log *logrus.Entry, accessCode *string) (*common.UserData, error) {
+func (router *googleOAuth2Provider) getUserData(log *logrus.Entry, accessCode *string, codeVerifier string) (*common.UserData, error) {
 	const stage = "Getting user data error."
 
-	token, err := router.retrieveAccessToken(*accessCode)
+	token, err := router.retrieveAccessToken(*accessCode, codeVerifier)
 	if err != nil {
 		return nil, newErr(stage, err)
 	}
@@ -113,6 +152,12 @@ func (router *googleOAuth2Provider) getUserData(log *logrus.Entry, accessCode *s
 		Email:      googleUserInfo.Email,
 		Picture:    googleUserInfo.Picture,
 		Locale:     googleUserInfo.Locale,
+		Groups:     claimGroups(googleUserInfo.Claims),
+		Claims:     userClaims(googleUserInfo.Claims),
+		Tokens: router.keptTokens.filter(common.ProviderTokens{
+			AccessToken:  token.AccessToken,
+			RefreshToken: token.RefreshToken,
+		}),
 	}, nil
 }
 
@@ -129,15 +174,16 @@ func getAccessCode(request *http.Request) (*string, error) {
 	return &accessCode, nil
 }
 
-func (router *googleOAuth2Provider) retrieveAccessToken(accessCode string) (*GoogleOAuth2Token, error) {
+func (router *googleOAuth2Provider) retrieveAccessToken(accessCode string, codeVerifier string) (*GoogleOAuth2Token, error) {
 	const stage = "Retrieving access token error."
 
 	requestPayload := GoogleRequestBuilder{
 		Code:         accessCode,
 		ClientId:     router.GoogleClientId,
 		ClientSecret: router.GoogleClientSecret,
-		RedirectUri:  router.DomainUrl + router.AuthenticationUrl,
+		RedirectUri:  router.RedirectUrl,
 		GrantType:    router.GrantType,
+		CodeVerifier: codeVerifier,
 	}
 
 	req, err := router.buildAccessTokenRequest(requestPayload)
@@ -145,7 +191,7 @@ func (router *googleOAuth2Provider) retrieveAccessToken(accessCode string) (*Goo
 		return nil, newErr(stage, err)
 	}
 
-	responseBody, err := performRequest(req)
+	responseBody, err := performObservedRequest("google", "token", req)
 	if err != nil {
 		return nil, newErr(stage, err)
 	}
@@ -178,7 +224,7 @@ func (router *googleOAuth2Provider) getUserInfo(accessToken string) (*GoogleUser
 		return nil, newErr(stage, err)
 	}
 
-	responseBody, err := performRequest(req)
+	responseBody, err := performObservedRequest("google", "user-info", req)
 	if err != nil {
 		return nil, newErr(stage, err)
 	}
@@ -187,6 +233,9 @@ func (router *googleOAuth2Provider) getUserInfo(accessToken string) (*GoogleUser
 	if err := json.Unmarshal(*responseBody, &googleUserInfo); err != nil {
 		return nil, newErr(stage, err)
 	}
+	if err := json.Unmarshal(*responseBody, &googleUserInfo.Claims); err != nil {
+		return nil, newErr(stage, err)
+	}
 	return &googleUserInfo, nil
 }
 
@@ -203,6 +252,14 @@ func (router *googleOAuth2Provider) buildRequestToGoogleApi(accessToken string)
 	return req, nil
 }
 
+// performObservedRequest records the provider call latency
+func performObservedRequest(provider string, operation string, req *http.Request) (*[]byte, error) {
+	start := time.Now()
+	responseBody, err := performRequest(req)
+	metrics.ObserveOAuthRequest(provider, operation, start, err)
+	return responseBody, err
+}
+
 func performRequest(req *http.Request) (*[]byte, error) {
 	const stage = "Performing request error."
 
@@ -234,6 +291,8 @@ type GoogleUserInfo struct {
 	Picture    string `json:"picture"`
 	Email      string `json:"email"`
 	Locale     string `json:"locale"`
+	// All the user info fields, like 'hd' of G Suite accounts
+	Claims map[string]interface{} `json:"-"`
 }
 
 type GoogleOAuth2Token struct {
@@ -249,19 +308,16 @@ type GoogleRequestBuilder struct {
 	ClientSecret string
 	RedirectUri  string
 	GrantType    string
+	CodeVerifier string
 }
 
 func (builder *GoogleRequestBuilder) String() string {
-	return fmt.Sprintf(
-		"code=%s"+
-			"&client_id=%s"+
-			"&client_secret=%s"+
-			"&redirect_uri=%s"+
-			"&grant_type=%s",
-		builder.Code,
-		builder.ClientId,
-		builder.ClientSecret,
-		builder.RedirectUri,
-		builder.GrantType,
-	)
+	return url.Values{
+		"code":          {builder.Code},
+		"client_id":     {builder.ClientId},
+		"client_secret": {builder.ClientSecret},
+		"redirect_uri":  {builder.RedirectUri},
+		"grant_type":    {builder.GrantType},
+		"code_verifier": {builder.CodeVerifier},
+	}.Encode()
 }
@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"github.com/Alcereo/ordinator/pkg/common"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const loginStateTTL = 10 * time.Minute
+
+var defaultScopes = []string{"openid", "email", "profile"}
+
+// Authorization request parameters which are the same for every login
+type authorizationRequest struct {
+	AuthorizationUrl string
+	ClientId         string
+	RedirectUrl      string
+	Scopes           []string
+	// Send the login state nonce, OpenID Connect providers return it in the ID token
+	WithNonce bool
+}
+
+// Requests without any of the callback parameters start a new login
+func isLoginCallback(request *http.Request) bool {
+	query := request.URL.Query()
+	return query.Get("code") != "" || query.Get("state") != "" || query.Get("error") != ""
+}
+
+// initiateLogin generates state, nonce and PKCE code verifier, binds them to the session
+// and redirects the user agent to the provider authorization endpoint.
+func initiateLogin(
+	log *logrus.Entry,
+	writer http.ResponseWriter,
+	request *http.Request,
+	cacheProvider UserAuthCachePort,
+	session *common.Session,
+	authRequest *authorizationRequest,
+) {
+	const stage = "Login initiation error. Reason: %v"
+
+	loginState, err := newLoginState()
+	if err != nil {
+		log.Errorf(stage, err)
+		writer.WriteHeader(500)
+		return
+	}
+
+	redirectUrl, err := authRequest.build(loginState)
+	if err != nil {
+		log.Errorf(stage, err)
+		writer.WriteHeader(500)
+		return
+	}
+
+	if err := cacheProvider.PutLoginState(session, loginState); err != nil {
+		log.Errorf(stage, err)
+		writer.WriteHeader(500)
+		return
+	}
+
+	log.Debugf("Login initiated. Redirecting to authorization endpoint.")
+	http.Redirect(writer, request, redirectUrl, 302)
+}
+
+// takeLoginState checks callback 'state' against the one bound to the session.
+// Stored state is removed on the first check, so a state can't be replayed.
+func takeLoginState(request *http.Request, cacheProvider UserAuthCachePort, session *common.Session) (*common.LoginState, error) {
+	const stage = "Checking login state error."
+
+	requestState := request.URL.Query().Get("state")
+	if requestState == "" {
+		return nil, newErr(stage, "'state' query param not found or empty.")
+	}
+
+	loginState, found := cacheProvider.TakeLoginState(session)
+	if !found {
+		return nil, newErr(stage, "login state for the session not found. Login wasn't initiated or state was already used.")
+	}
+	if subtle.ConstantTimeCompare([]byte(loginState.State), []byte(requestState)) != 1 {
+		return nil, newErr(stage, "'state' query param doesn't match the session login state.")
+	}
+	if loginState.Expires.Before(time.Now()) {
+		return nil, newErr(stage, "login state expired.")
+	}
+	return loginState, nil
+}
+
+func newLoginState() (*common.LoginState, error) {
+	state, err := randomString(32)
+	if err != nil {
+		return nil, err
+	}
+	codeVerifier, err := randomString(32)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := randomString(32)
+	if err != nil {
+		return nil, err
+	}
+	return &common.LoginState{
+		State:        state,
+		CodeVerifier: codeVerifier,
+		Nonce:        nonce,
+		Expires:      time.Now().Add(loginStateTTL),
+	}, nil
+}
+
+func (authRequest *authorizationRequest) build(loginState *common.LoginState) (string, error) {
+	if authRequest.AuthorizationUrl == "" {
+		return "", errors.New("authorization url is not defined")
+	}
+	authorizationUrl, err := url.Parse(authRequest.AuthorizationUrl)
+	if err != nil {
+		return "", err
+	}
+	scopes := authRequest.Scopes
+	if len(scopes) == 0 {
+		scopes = defaultScopes
+	}
+
+	query := authorizationUrl.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", authRequest.ClientId)
+	query.Set("redirect_uri", authRequest.RedirectUrl)
+	query.Set("scope", strings.Join(scopes, " "))
+	query.Set("state", loginState.State)
+	query.Set("code_challenge", codeChallenge(loginState.CodeVerifier))
+	query.Set("code_challenge_method", "S256")
+	if authRequest.WithNonce {
+		query.Set("nonce", loginState.Nonce)
+	}
+	authorizationUrl.RawQuery = query.Encode()
+	return authorizationUrl.String(), nil
+}
+
+func codeChallenge(codeVerifier string) string {
+	hash := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+func randomString(size int) (string, error) {
+	bytes := make([]byte, size)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
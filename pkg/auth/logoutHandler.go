@@ -0,0 +1,191 @@
+package auth
+
+import (
+	"bytes"
+	"github.com/Alcereo/ordinator/pkg/common"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+type SessionRemovalPort interface {
+	RemoveSession(session *common.Session)
+}
+
+// KeptTokens are the provider tokens the logout handlers of the user cache use, the login
+// providers don't store the rest with the user data
+type KeptTokens struct {
+	// Refresh token, or the access token when the provider gives no refresh token
+	ForRevocation bool
+	// ID token
+	ForEndSession bool
+}
+
+func (kept KeptTokens) filter(tokens common.ProviderTokens) common.ProviderTokens {
+	var filtered common.ProviderTokens
+	if kept.ForRevocation {
+		if tokens.RefreshToken != "" {
+			filtered.RefreshToken = tokens.RefreshToken
+		} else {
+			filtered.AccessToken = tokens.AccessToken
+		}
+	}
+	if kept.ForEndSession {
+		filtered.IdToken = tokens.IdToken
+	}
+	return filtered
+}
+
+type logoutHandler struct {
+	userCacheProvider     UserAuthCachePort
+	sessionCacheProvider  SessionRemovalPort
+	PostLogoutRedirectUrl string `validate:"required"`
+	CookieName            string `validate:"required"`
+	CookiePath            string
+	CookieDomain          string
+	RevocationUrl         string
+	EndSessionUrl         string
+	ClientId              string
+	ClientSecret          string
+}
+
+// NewLogoutHandler creates the logout endpoint. sessionCacheProvider can be nil when sessions
+// are not stored in the same adapter, then only the session cookie is expired.
+func NewLogoutHandler(
+	userCacheProvider UserAuthCachePort,
+	sessionCacheProvider SessionRemovalPort,
+	postLogoutRedirectUrl string,
+	cookieName string,
+	cookiePath string,
+	cookieDomain string,
+	revocationUrl string,
+	endSessionUrl string,
+	clientId string,
+	clientSecret string,
+) *logoutHandler {
+	handler := &logoutHandler{
+		userCacheProvider:     userCacheProvider,
+		sessionCacheProvider:  sessionCacheProvider,
+		PostLogoutRedirectUrl: postLogoutRedirectUrl,
+		CookieName:            cookieName,
+		CookiePath:            cookiePath,
+		CookieDomain:          cookieDomain,
+		RevocationUrl:         revocationUrl,
+		EndSessionUrl:         endSessionUrl,
+		ClientId:              clientId,
+		ClientSecret:          clientSecret,
+	}
+	err := validate.Struct(handler)
+	if err != nil {
+		panic(err.Error())
+	}
+	return handler
+}
+
+// Handle logs out on POST only, otherwise any cross-site image or link could end the session.
+// Cross-site form posts are left to the CSRF filter of the route.
+func (handler *logoutHandler) Handle(log *logrus.Entry, writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		log.Debugf("Logout method not allowed: %v", request.Method)
+		writer.Header().Set("Allow", http.MethodPost)
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	handler.expireCookie(writer)
+
+	sessionNillable := request.Context().Value(common.SessionContextKey)
+	if sessionNillable == nil {
+		log.Warnf("Session not found in the request context. Only session cookie is expired.")
+		http.Redirect(writer, request, handler.PostLogoutRedirectUrl, 302)
+		return
+	}
+	session := sessionNillable.(*common.Session)
+
+	userData, found := handler.userCacheProvider.FindUserData(session)
+	handler.userCacheProvider.RemoveUserData(session)
+	if handler.sessionCacheProvider != nil {
+		handler.sessionCacheProvider.RemoveSession(session)
+	}
+	session.Removed = true
+	log.Debugf("User data and session removed. Session id: %v", session.Id)
+
+	if !found {
+		http.Redirect(writer, request, handler.PostLogoutRedirectUrl, 302)
+		return
+	}
+
+	if handler.RevocationUrl != "" {
+		if err := handler.revokeToken(&userData.Tokens); err != nil {
+			log.Warnf("Token revocation error. Reason: %v", err)
+		}
+	}
+
+	if handler.EndSessionUrl != "" && userData.Tokens.IdToken != "" {
+		endSessionUrl, err := handler.buildEndSessionUrl(userData.Tokens.IdToken)
+		if err != nil {
+			log.Warnf("Building end session url error. Reason: %v", err)
+		} else {
+			http.Redirect(writer, request, endSessionUrl, 302)
+			return
+		}
+	}
+	http.Redirect(writer, request, handler.PostLogoutRedirectUrl, 302)
+}
+
+func (handler *logoutHandler) expireCookie(writer http.ResponseWriter) {
+	http.SetCookie(writer, &http.Cookie{
+		Name:    handler.CookieName,
+		Value:   "",
+		Path:    handler.CookiePath,
+		Domain:  handler.CookieDomain,
+		Expires: time.Unix(0, 0),
+		MaxAge:  -1,
+	})
+}
+
+// revokeToken performs RFC 7009 revocation. Refresh token is preferred,
+// providers revoke the access tokens issued by it as well.
+func (handler *logoutHandler) revokeToken(tokens *common.ProviderTokens) error {
+	const stage = "Revoking token error."
+
+	form := url.Values{}
+	if tokens.RefreshToken != "" {
+		form.Set("token", tokens.RefreshToken)
+		form.Set("token_type_hint", "refresh_token")
+	} else if tokens.AccessToken != "" {
+		form.Set("token", tokens.AccessToken)
+		form.Set("token_type_hint", "access_token")
+	} else {
+		return nil
+	}
+	if handler.ClientId != "" {
+		form.Set("client_id", handler.ClientId)
+		form.Set("client_secret", handler.ClientSecret)
+	}
+
+	req, err := http.NewRequest("POST", handler.RevocationUrl, bytes.NewBufferString(form.Encode()))
+	if err != nil {
+		return newErr(stage, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if _, err := performObservedRequest("logout", "revocation", req); err != nil {
+		return newErr(stage, err)
+	}
+	return nil
+}
+
+func (handler *logoutHandler) buildEndSessionUrl(idToken string) (string, error) {
+	endSessionUrl, err := url.Parse(handler.EndSessionUrl)
+	if err != nil {
+		return "", err
+	}
+	query := endSessionUrl.Query()
+	query.Set("id_token_hint", idToken)
+	query.Set("post_logout_redirect_uri", handler.PostLogoutRedirectUrl)
+	if handler.ClientId != "" {
+		query.Set("client_id", handler.ClientId)
+	}
+	endSessionUrl.RawQuery = query.Encode()
+	return endSessionUrl.String(), nil
+}
@@ -0,0 +1,30 @@
+package auth
+
+import (
+	"github.com/Alcereo/ordinator/pkg/common"
+	"testing"
+)
+
+func TestKeptTokens(t *testing.T) {
+	tokens := common.ProviderTokens{AccessToken: "access", RefreshToken: "refresh", IdToken: "id"}
+	cases := []struct {
+		kept     KeptTokens
+		tokens   common.ProviderTokens
+		expected common.ProviderTokens
+	}{
+		{KeptTokens{}, tokens, common.ProviderTokens{}},
+		{KeptTokens{ForRevocation: true}, tokens, common.ProviderTokens{RefreshToken: "refresh"}},
+		{KeptTokens{ForRevocation: true}, common.ProviderTokens{AccessToken: "access"}, common.ProviderTokens{AccessToken: "access"}},
+		{KeptTokens{ForEndSession: true}, tokens, common.ProviderTokens{IdToken: "id"}},
+		{KeptTokens{ForRevocation: true, ForEndSession: true}, tokens, common.ProviderTokens{RefreshToken: "refresh", IdToken: "id"}},
+	}
+	for i, testCase := range cases {
+		// When
+		filtered := testCase.kept.filter(testCase.tokens)
+
+		// Then
+		if filtered != testCase.expected {
+			t.Fatalf("Case %v: expect %#v, got: %#v", i, testCase.expected, filtered)
+		}
+	}
+}
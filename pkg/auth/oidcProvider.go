@@ -0,0 +1,328 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"github.com/Alcereo/ordinator/pkg/common"
+	"github.com/Alcereo/ordinator/pkg/jwks"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JwksRefreshInterval limits how often remote key sets are fetched for unknown key ids
+const JwksRefreshInterval = 5 * time.Minute
+
+type oidcProvider struct {
+	cacheProvider   UserAuthCachePort
+	SuccessLoginUrl string `validate:"required"`
+	IssuerUrl       string `validate:"required,url"`
+	ClientId        string `validate:"required"`
+	ClientSecret    string `validate:"required"`
+	RedirectUrl     string `validate:"required,url"`
+	GrantType       string `validate:"required"`
+	Scopes          []string
+	keptTokens      KeptTokens
+
+	discoveryMutex sync.Mutex
+	discovery      *OidcDiscoveryDocument
+	keySource      jwks.KeySource
+}
+
+func NewOidcProvider(
+	cacheProvider UserAuthCachePort,
+	successLoginUrl string,
+	issuerUrl string,
+	clientId string,
+	clientSecret string,
+	redirectUrl string,
+	scopes []string,
+	keptTokens KeptTokens,
+) *oidcProvider {
+	provider := &oidcProvider{
+		cacheProvider:   cacheProvider,
+		SuccessLoginUrl: successLoginUrl,
+		IssuerUrl:       strings.TrimSuffix(issuerUrl, "/"),
+		ClientId:        clientId,
+		ClientSecret:    clientSecret,
+		RedirectUrl:     redirectUrl,
+		GrantType:       "authorization_code",
+		Scopes:          scopes,
+		keptTokens:      keptTokens,
+	}
+	err := validate.Struct(provider)
+	if err != nil {
+		panic(err.Error())
+	}
+	return provider
+}
+
+func (router *oidcProvider) Handle(log *logrus.Entry, writer http.ResponseWriter, request *http.Request) {
+	const stage = "Performing OpenID Connect authorisation error. Reason: %v"
+
+	sessionNillable := request.Context().Value(common.SessionContextKey)
+	if sessionNillable == nil {
+		log.Errorf(stage, "Session not found in the request context.")
+		writer.WriteHeader(501)
+		return
+	}
+
+	session := sessionNillable.(*common.Session)
+	_, found := router.cacheProvider.FindUserData(session)
+	if found {
+		log.Debugf("User data for session already exist. Skip authentication.")
+		http.Redirect(writer, request, router.SuccessLoginUrl, 302)
+		return
+	}
+
+	if !isLoginCallback(request) {
+		router.initiateLogin(log, writer, request, session)
+		return
+	}
+
+	loginState, err := takeLoginState(request, router.cacheProvider, session)
+	if err != nil {
+		log.Errorf(stage, err)
+		writer.WriteHeader(403)
+		return
+	}
+
+	accessCode, err := getAccessCode(request)
+	if err != nil {
+		log.Errorf(stage, err)
+		writer.WriteHeader(403)
+		return
+	}
+
+	userData, err := router.getUserData(log, accessCode, loginState)
+	if err != nil {
+		log.Errorf(stage, err)
+		writer.WriteHeader(403)
+		return
+	}
+
+	if err := router.cacheProvider.PutUserData(session, userData); err != nil {
+		log.Errorf(stage, err)
+		writer.WriteHeader(500)
+		return
+	}
+
+	log.Debugf("User data successful retrieved and stored to cache. %v", userData)
+	http.Redirect(writer, request, router.SuccessLoginUrl, 302)
+}
+
+func (router *oidcProvider) initiateLogin(log *logrus.Entry, writer http.ResponseWriter, request *http.Request, session *common.Session) {
+	discovery, err := router.resolveDiscovery()
+	if err != nil {
+		log.Errorf("Login initiation error. Reason: %v", err)
+		writer.WriteHeader(502)
+		return
+	}
+	initiateLogin(log, writer, request, router.cacheProvider, session, &authorizationRequest{
+		AuthorizationUrl: discovery.AuthorizationEndpoint,
+		ClientId:         router.ClientId,
+		RedirectUrl:      router.RedirectUrl,
+		Scopes:           router.Scopes,
+		WithNonce:        true,
+	})
+}
+
+func (router *oidcProvider) getUserData(log *logrus.Entry, accessCode *string, loginState *common.LoginState) (*common.UserData, error) {
+	const stage = "Getting user data error."
+
+	discovery, err := router.resolveDiscovery()
+	if err != nil {
+		return nil, newErr(stage, err)
+	}
+
+	token, err := router.retrieveToken(discovery, *accessCode, loginState.CodeVerifier)
+	if err != nil {
+		return nil, newErr(stage, err)
+	}
+
+	claims, err := router.verifyIdToken(discovery, token.IdToken, loginState.Nonce)
+	if err != nil {
+		return nil, newErr(stage, err)
+	}
+
+	log.Debugf("Authentication successful. %+v", claims)
+	userData := claims.toUserData()
+	userData.Tokens = router.keptTokens.filter(common.ProviderTokens{
+		AccessToken:  token.AccessToken,
+		RefreshToken: token.RefreshToken,
+		IdToken:      token.IdToken,
+	})
+	return userData, nil
+}
+
+// Discovery document is requested on the first authentication, so the provider
+// doesn't have to be available when the gateway starts.
+func (router *oidcProvider) resolveDiscovery() (*OidcDiscoveryDocument, error) {
+	const stage = "Resolving OpenID Connect discovery document error."
+
+	router.discoveryMutex.Lock()
+	defer router.discoveryMutex.Unlock()
+
+	if router.discovery != nil {
+		return router.discovery, nil
+	}
+
+	req, err := http.NewRequest("GET", router.IssuerUrl+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, newErr(stage, err)
+	}
+	responseBody, err := performObservedRequest("oidc", "discovery", req)
+	if err != nil {
+		return nil, newErr(stage, err)
+	}
+
+	var discovery OidcDiscoveryDocument
+	if err := json.Unmarshal(*responseBody, &discovery); err != nil {
+		return nil, newErr(stage, err)
+	}
+	if strings.TrimSuffix(discovery.Issuer, "/") != router.IssuerUrl {
+		return nil, newErr(stage, "issuer '"+discovery.Issuer+"' doesn't match configured issuer url '"+router.IssuerUrl+"'.")
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JwksUri == "" {
+		return nil, newErr(stage, "'authorization_endpoint', 'token_endpoint' and 'jwks_uri' are required.")
+	}
+
+	router.discovery = &discovery
+	router.keySource = jwks.NewRemoteKeySource(discovery.JwksUri, JwksRefreshInterval)
+	return router.discovery, nil
+}
+
+func (router *oidcProvider) retrieveToken(discovery *OidcDiscoveryDocument, accessCode string, codeVerifier string) (*OidcToken, error) {
+	const stage = "Retrieving token error."
+
+	form := url.Values{
+		"code":          {accessCode},
+		"client_id":     {router.ClientId},
+		"client_secret": {router.ClientSecret},
+		"redirect_uri":  {router.RedirectUrl},
+		"grant_type":    {router.GrantType},
+		"code_verifier": {codeVerifier},
+	}
+	req, err := http.NewRequest("POST", discovery.TokenEndpoint, bytes.NewBufferString(form.Encode()))
+	if err != nil {
+		return nil, newErr(stage, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	responseBody, err := performObservedRequest("oidc", "token", req)
+	if err != nil {
+		return nil, newErr(stage, err)
+	}
+
+	var token OidcToken
+	if err := json.Unmarshal(*responseBody, &token); err != nil {
+		return nil, newErr(stage, err)
+	}
+	if token.IdToken == "" {
+		return nil, newErr(stage, "'id_token' not found in the token response.")
+	}
+	return &token, nil
+}
+
+func (router *oidcProvider) verifyIdToken(discovery *OidcDiscoveryDocument, idToken string, nonce string) (*OidcClaims, error) {
+	const stage = "Verifying ID token error."
+
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(idToken, claims, jwks.Keyfunc(router.keySource)); err != nil {
+		return nil, newErr(stage, err)
+	}
+	if issuer, _ := claims["iss"].(string); issuer != discovery.Issuer {
+		return nil, newErr(stage, "unexpected issuer '"+issuer+"'.")
+	}
+	if !audienceContains(claims["aud"], router.ClientId) {
+		return nil, newErr(stage, "client id not found in the token audience.")
+	}
+	if _, found := claims["exp"]; !found {
+		return nil, newErr(stage, "'exp' claim is required.")
+	}
+	if tokenNonce, _ := claims["nonce"].(string); subtle.ConstantTimeCompare([]byte(tokenNonce), []byte(nonce)) != 1 {
+		return nil, newErr(stage, "'nonce' claim doesn't match the login state.")
+	}
+
+	var oidcClaims OidcClaims
+	if err := remarshal(claims, &oidcClaims); err != nil {
+		return nil, newErr(stage, err)
+	}
+	if oidcClaims.Subject == "" {
+		return nil, newErr(stage, "'sub' claim is required.")
+	}
+	oidcClaims.Claims = claims
+	return &oidcClaims, nil
+}
+
+// 'aud' can be either a single string or an array of strings
+func audienceContains(audience interface{}, expected string) bool {
+	switch aud := audience.(type) {
+	case string:
+		return aud == expected
+	case []interface{}:
+		for _, value := range aud {
+			if value == expected {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func remarshal(from interface{}, to interface{}) error {
+	data, err := json.Marshal(from)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, to)
+}
+
+type OidcDiscoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserInfoEndpoint      string `json:"userinfo_endpoint"`
+	JwksUri               string `json:"jwks_uri"`
+	EndSessionEndpoint    string `json:"end_session_endpoint"`
+}
+
+type OidcToken struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	IdToken      string `json:"id_token"`
+	ExpiresIn    int    `json:"expires_in"`
+	TokenType    string `json:"token_type"`
+}
+
+type OidcClaims struct {
+	Subject           string `json:"sub"`
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferred_username"`
+	Email             string `json:"email"`
+	Picture           string `json:"picture"`
+	Locale            string `json:"locale"`
+	// All the token claims
+	Claims map[string]interface{} `json:"-"`
+}
+
+func (claims *OidcClaims) toUserData() *common.UserData {
+	username := claims.Name
+	if username == "" {
+		username = claims.PreferredUsername
+	}
+	return &common.UserData{
+		Identifier: claims.Subject,
+		Username:   username,
+		Email:      claims.Email,
+		Picture:    claims.Picture,
+		Locale:     claims.Locale,
+		Groups:     claimGroups(claims.Claims),
+		Claims:     userClaims(claims.Claims),
+	}
+}
@@ -11,6 +11,10 @@ import (
 type UserAuthCachePort interface {
 	FindUserData(session *common.Session) (*common.UserData, bool)
 	PutUserData(session *common.Session, userData *common.UserData) error
+	RemoveUserData(session *common.Session)
+	PutLoginState(session *common.Session, loginState *common.LoginState) error
+	// TakeLoginState returns the stored login state and removes it, so it can be used only once.
+	TakeLoginState(session *common.Session) (*common.LoginState, bool)
 }
 
 type userAuthenticationFilter struct {
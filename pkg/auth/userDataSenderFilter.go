@@ -10,22 +10,19 @@ type userDataSenderFilter struct {
 	next               *common.RequestHandler
 	cacheProvider      UserAuthCachePort
 	Name               string
-	userDataSerializer UserDataSerializer
-	userDataHeader     string
+	userDataSerializer UserDataHeadersSerializer
 }
 
 func NewUserDataSenderFilter(
 	cacheProvider UserAuthCachePort,
 	name string,
-	userDataSerializer UserDataSerializer,
-	userDataHeader string,
+	userDataSerializer UserDataHeadersSerializer,
 ) *userDataSenderFilter {
 	return &userDataSenderFilter{
 		next:               nil,
 		cacheProvider:      cacheProvider,
 		Name:               name,
 		userDataSerializer: userDataSerializer,
-		userDataHeader:     userDataHeader,
 	}
 }
 
@@ -35,7 +32,7 @@ func (filter *userDataSenderFilter) SetNext(handler common.RequestHandler) {
 
 func (filter *userDataSenderFilter) Handle(log *log.Entry, writer http.ResponseWriter, request *http.Request) {
 	log = log.WithField("filterName", filter.Name)
-	enchantedRequest := filter.updateRequest(request)
+	enchantedRequest := filter.updateRequest(log, request)
 	if filter.next != nil {
 		(*filter.next).Handle(log, writer, enchantedRequest)
 	} else {
@@ -43,31 +40,79 @@ func (filter *userDataSenderFilter) Handle(log *log.Entry, writer http.ResponseW
 	}
 }
 
-func (filter *userDataSenderFilter) updateRequest(request *http.Request) *http.Request {
-	sessionNillable := request.Context().Value(common.SessionContextKey)
-	if sessionNillable == nil {
-		log.Warnf("Session not found in the request context. Skip User data sending.")
-		return request
+// updateRequest removes client copies of the user data headers first, so they can't be spoofed
+func (filter *userDataSenderFilter) updateRequest(log *log.Entry, request *http.Request) *http.Request {
+	for _, header := range filter.userDataSerializer.HeaderNames() {
+		if _, found := request.Header[http.CanonicalHeaderKey(header)]; found {
+			log.Warnf("Client request contains user data header %v. Header removed.", header)
+			request.Header.Del(header)
+		}
 	}
 
-	session := sessionNillable.(*common.Session)
-	userData, found := filter.cacheProvider.FindUserData(session)
-
+	userData, found := filter.resolveUserData(request)
 	if !found {
 		log.Warnf("User data not found in the request context. Skip user data sending.")
 		return request
 	}
 
-	jwtToken, err := filter.userDataSerializer.Serialize(userData)
+	headers, err := filter.userDataSerializer.Headers(userData)
 	if err != nil {
 		log.Errorf("User data serializing error. Skip user data sending. %+v", err)
 		return request
 	}
-
-	request.Header.Add(filter.userDataHeader, jwtToken)
+	for name, values := range headers {
+		request.Header[name] = values
+	}
 	return request
 }
 
+// resolveUserData takes user data put to the context by an authentication filter, like bearer
+// authentication, or finds it by the session
+func (filter *userDataSenderFilter) resolveUserData(request *http.Request) (*common.UserData, bool) {
+	if userData, found := request.Context().Value(common.UserDataContextKey).(*common.UserData); found && userData != nil {
+		return userData, true
+	}
+	session, found := request.Context().Value(common.SessionContextKey).(*common.Session)
+	if !found || session == nil || filter.cacheProvider == nil {
+		return nil, false
+	}
+	return filter.cacheProvider.FindUserData(session)
+}
+
 type UserDataSerializer interface {
 	Serialize(*common.UserData) (string, error)
 }
+
+// UserDataHeadersSerializer writes user data to request headers
+type UserDataHeadersSerializer interface {
+	Headers(*common.UserData) (http.Header, error)
+	// HeaderNames returns all the headers the serializer writes, they are never taken from clients
+	HeaderNames() []string
+}
+
+type singleHeaderSerializer struct {
+	header     string
+	serializer UserDataSerializer
+}
+
+// SingleHeader writes user data serialized to one value, like JWT, to the header
+func SingleHeader(header string, serializer UserDataSerializer) UserDataHeadersSerializer {
+	return &singleHeaderSerializer{
+		header:     header,
+		serializer: serializer,
+	}
+}
+
+func (serializer *singleHeaderSerializer) Headers(userData *common.UserData) (http.Header, error) {
+	value, err := serializer.serializer.Serialize(userData)
+	if err != nil {
+		return nil, err
+	}
+	headers := http.Header{}
+	headers.Set(serializer.header, value)
+	return headers, nil
+}
+
+func (serializer *singleHeaderSerializer) HeaderNames() []string {
+	return []string{serializer.header}
+}
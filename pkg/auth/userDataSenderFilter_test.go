@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"context"
+	"github.com/Alcereo/ordinator/pkg/common"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUserDataSentFromContext(t *testing.T) {
+	// Given
+	filter := NewUserDataSenderFilter(nil, "Filter name", SingleHeader("X-User-Data", stubSerializer{}))
+	next := &requestCapturingHandler{}
+	filter.SetNext(next)
+	request := httptest.NewRequest("GET", "/foo", nil)
+	request.Header.Add("X-User-Data", "forged")
+	request = request.WithContext(context.WithValue(request.Context(), common.UserDataContextKey, &common.UserData{Identifier: "client-1"}))
+
+	// When
+	filter.Handle(logrus.NewEntry(logrus.StandardLogger()), httptest.NewRecorder(), request)
+
+	// Then
+	if values := next.request.Header["X-User-Data"]; len(values) != 1 || values[0] != "client-1" {
+		t.Fatalf("Expect only user data from the context sent, got: %v", values)
+	}
+}
+
+type stubSerializer struct{}
+
+func (stubSerializer) Serialize(userData *common.UserData) (string, error) {
+	return userData.Identifier, nil
+}
+
+type requestCapturingHandler struct {
+	request *http.Request
+}
+
+func (handler *requestCapturingHandler) Handle(log *logrus.Entry, writer http.ResponseWriter, request *http.Request) {
+	handler.request = request
+}
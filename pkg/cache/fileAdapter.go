@@ -0,0 +1,312 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Alcereo/ordinator/pkg/common"
+	"github.com/Alcereo/ordinator/pkg/metrics"
+	"github.com/patrickmn/go-cache"
+	"github.com/satori/go.uuid"
+	log "github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+	"sync"
+	"time"
+)
+
+var (
+	sessionsBucket    = []byte("sessions")
+	userDataBucket    = []byte("user-data")
+	loginStatesBucket = []byte("login-states")
+	// Token buckets were stored in the file by the earlier versions
+	rateLimitsBucket = []byte("rate-limits")
+)
+
+// Entries are stored in an embedded bbolt file, so sessions survive restarts on a single node.
+// Expired entries are never returned and are removed by the background eviction.
+// Zero expiration keeps sessions and user data until removed, as GoCache and Redis adapters do.
+// Rate limit token buckets are per node anyway and are kept in memory: a file write transaction
+// per request would serialize all the rate limited requests.
+type fileCacheAdapter struct {
+	identifier     string
+	db             *bolt.DB
+	expiration     time.Duration
+	stop           chan struct{}
+	rateLimits     *cache.Cache
+	rateLimitMutex sync.Mutex
+}
+
+type fileCacheEntry struct {
+	// Zero time never expires
+	Expires time.Time
+	Value   json.RawMessage
+}
+
+func NewFileCacheAdapter(identifier string, path string, expirationTimeHours int, evictScheduleTimeHours int) (*fileCacheAdapter, error) {
+	return newFileCacheAdapter(
+		identifier,
+		path,
+		time.Hour*time.Duration(expirationTimeHours),
+		time.Hour*time.Duration(evictScheduleTimeHours),
+	)
+}
+
+func newFileCacheAdapter(identifier string, path string, expiration time.Duration, evictSchedule time.Duration) (*fileCacheAdapter, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("opening cache file %v error. Reason: %v", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{sessionsBucket, userDataBucket, loginStatesBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		if err := tx.DeleteBucket(rateLimitsBucket); err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("initializing cache file %v error. Reason: %v", path, err)
+	}
+
+	adapter := &fileCacheAdapter{
+		identifier: identifier,
+		db:         db,
+		expiration: expiration,
+		stop:       make(chan struct{}),
+		rateLimits: cache.New(cache.NoExpiration, evictSchedule),
+	}
+	if evictSchedule > 0 {
+		go adapter.evictExpiredPeriodically(evictSchedule)
+	}
+	return adapter, nil
+}
+
+// Close stops eviction and releases the file lock
+func (adapter *fileCacheAdapter) Close() error {
+	close(adapter.stop)
+	return adapter.db.Close()
+}
+
+func (adapter *fileCacheAdapter) PutSession(session *common.Session) error {
+	return adapter.add(sessionsBucket, string(session.Cookie), session, adapter.expires())
+}
+
+func (adapter *fileCacheAdapter) GetSession(cookie common.SessionCookie) (*common.Session, bool) {
+	var session common.Session
+	found := adapter.get(sessionsBucket, string(cookie), &session)
+	metrics.ObserveCacheLookup(adapter.identifier, "session", found)
+	if !found {
+		return nil, false
+	}
+	return &session, true
+}
+
+func (adapter *fileCacheAdapter) RemoveSession(session *common.Session) {
+	adapter.remove(sessionsBucket, string(session.Cookie))
+}
+
+func (*fileCacheAdapter) CreateNewIdentifier() common.SessionId {
+	return common.SessionId(uuid.NewV4().String())
+}
+
+func (*fileCacheAdapter) CreateNewCookie() common.SessionCookie {
+	return common.SessionCookie(uuid.NewV4().String())
+}
+
+// UserAuthenticationPort implementation
+
+func (adapter *fileCacheAdapter) FindUserData(session *common.Session) (*common.UserData, bool) {
+	var userData common.UserData
+	found := adapter.get(userDataBucket, string(session.Id), &userData)
+	metrics.ObserveCacheLookup(adapter.identifier, "user-data", found)
+	if !found {
+		return nil, false
+	}
+	return &userData, true
+}
+
+func (adapter *fileCacheAdapter) PutUserData(session *common.Session, userData *common.UserData) error {
+	return adapter.add(userDataBucket, string(session.Id), userData, adapter.expires())
+}
+
+func (adapter *fileCacheAdapter) RemoveUserData(session *common.Session) {
+	adapter.remove(userDataBucket, string(session.Id))
+}
+
+func (adapter *fileCacheAdapter) PutLoginState(session *common.Session, loginState *common.LoginState) error {
+	data, err := encodeEntry(loginState, loginState.Expires)
+	if err != nil {
+		return err
+	}
+	return adapter.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(loginStatesBucket).Put([]byte(session.Id), data)
+	})
+}
+
+func (adapter *fileCacheAdapter) TakeLoginState(session *common.Session) (*common.LoginState, bool) {
+	var loginState common.LoginState
+	found := false
+	err := adapter.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(loginStatesBucket)
+		data := bucket.Get([]byte(session.Id))
+		if data == nil {
+			return nil
+		}
+		var err error
+		found, err = decodeEntry(data, &loginState)
+		if err != nil {
+			return err
+		}
+		return bucket.Delete([]byte(session.Id))
+	})
+	if err != nil {
+		log.Errorf("Taking login state from cache file error. Reason: %v", err)
+		return nil, false
+	}
+	if !found {
+		return nil, false
+	}
+	return &loginState, true
+}
+
+// RateLimitCachePort implementation
+
+func (adapter *fileCacheAdapter) TakeToken(key string, rate float64, burst int) (bool, time.Duration, error) {
+	adapter.rateLimitMutex.Lock()
+	defer adapter.rateLimitMutex.Unlock()
+
+	bucket := &common.TokenBucket{}
+	if value, found := adapter.rateLimits.Get(key); found {
+		bucket = value.(*common.TokenBucket)
+	}
+	allowed, retryAfter := bucket.Take(time.Now(), rate, burst)
+	adapter.rateLimits.Set(key, bucket, common.TokenBucketTTL(rate, burst))
+	return allowed, retryAfter, nil
+}
+
+// Internal
+
+// add stores the value only if there is no live entry with the key, as the GoCache adapter does
+func (adapter *fileCacheAdapter) add(bucketName []byte, key string, value interface{}, expires time.Time) error {
+	data, err := encodeEntry(value, expires)
+	if err != nil {
+		return err
+	}
+	return adapter.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketName)
+		if existing := bucket.Get([]byte(key)); existing != nil {
+			var entry fileCacheEntry
+			if err := json.Unmarshal(existing, &entry); err == nil && !entry.expired(time.Now()) {
+				return fmt.Errorf("item %s already exists", key)
+			}
+		}
+		return bucket.Put([]byte(key), data)
+	})
+}
+
+func (adapter *fileCacheAdapter) get(bucketName []byte, key string, value interface{}) bool {
+	found := false
+	err := adapter.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(bucketName).Get([]byte(key))
+		if data == nil {
+			return nil
+		}
+		var err error
+		found, err = decodeEntry(data, value)
+		return err
+	})
+	if err != nil {
+		log.Errorf("Getting %v from cache file error. Reason: %v", key, err)
+		return false
+	}
+	return found
+}
+
+func (adapter *fileCacheAdapter) remove(bucketName []byte, key string) {
+	err := adapter.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketName).Delete([]byte(key))
+	})
+	if err != nil {
+		log.Errorf("Removing %v from cache file error. Reason: %v", key, err)
+	}
+}
+
+func (adapter *fileCacheAdapter) evictExpiredPeriodically(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := adapter.evictExpired(); err != nil {
+				log.Errorf("Evicting expired entries from cache file error. Reason: %v", err)
+			}
+		case <-adapter.stop:
+			return
+		}
+	}
+}
+
+func (adapter *fileCacheAdapter) evictExpired() error {
+	now := time.Now()
+	return adapter.db.Update(func(tx *bolt.Tx) error {
+		for _, bucketName := range [][]byte{sessionsBucket, userDataBucket, loginStatesBucket} {
+			var expiredKeys [][]byte
+			err := tx.Bucket(bucketName).ForEach(func(key []byte, data []byte) error {
+				var entry fileCacheEntry
+				if err := json.Unmarshal(data, &entry); err != nil || entry.expired(now) {
+					expiredKeys = append(expiredKeys, append([]byte(nil), key...))
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			for _, key := range expiredKeys {
+				if err := tx.Bucket(bucketName).Delete(key); err != nil {
+					return err
+				}
+			}
+			if len(expiredKeys) > 0 {
+				log.Debugf("Evicted %v expired entries from cache bucket %s", len(expiredKeys), bucketName)
+			}
+		}
+		return nil
+	})
+}
+
+func (adapter *fileCacheAdapter) expires() time.Time {
+	if adapter.expiration <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(adapter.expiration)
+}
+
+func (entry *fileCacheEntry) expired(now time.Time) bool {
+	return !entry.Expires.IsZero() && !entry.Expires.After(now)
+}
+
+func encodeEntry(value interface{}, expires time.Time) ([]byte, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(fileCacheEntry{
+		Expires: expires,
+		Value:   data,
+	})
+}
+
+// decodeEntry returns false for expired entries
+func decodeEntry(data []byte, value interface{}) (bool, error) {
+	var entry fileCacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return false, err
+	}
+	if entry.expired(time.Now()) {
+		return false, nil
+	}
+	return true, json.Unmarshal(entry.Value, value)
+}
@@ -0,0 +1,221 @@
+package cache
+
+import (
+	"github.com/Alcereo/ordinator/pkg/common"
+	bolt "go.etcd.io/bbolt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func createCacheFilePath(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "ordinator-cache")
+	if err != nil {
+		t.Fatalf("Creating temp dir error: %v", err)
+	}
+	return filepath.Join(dir, "cache.db"), func() { _ = os.RemoveAll(dir) }
+}
+
+func TestFileSessionSurvivesReopen(t *testing.T) {
+	path, cleanup := createCacheFilePath(t)
+	defer cleanup()
+
+	adapter, err := NewFileCacheAdapter("test-adapter", path, 1, 1)
+	if err != nil {
+		t.Fatalf("Opening cache file error: %v", err)
+	}
+	session := &common.Session{Id: "i1", Cookie: "c1", Expires: time.Now().Round(time.Second)}
+	if err := adapter.PutSession(session); err != nil {
+		t.Errorf("Saving session error: %v", err)
+	}
+	if err := adapter.PutUserData(session, &common.UserData{Identifier: "user-1"}); err != nil {
+		t.Errorf("Saving user data error: %v", err)
+	}
+	_ = adapter.Close()
+
+	reopened, err := NewFileCacheAdapter("test-adapter", path, 1, 1)
+	if err != nil {
+		t.Fatalf("Reopening cache file error: %v", err)
+	}
+	defer reopened.Close()
+
+	cachedSession, found := reopened.GetSession("c1")
+	if !found {
+		t.Fatalf("Session not found after reopen")
+	}
+	if cachedSession.Id != "i1" || !cachedSession.Expires.Equal(session.Expires) {
+		t.Fatalf("Cached session %+v not equal saved %+v", cachedSession, session)
+	}
+	userData, found := reopened.FindUserData(cachedSession)
+	if !found || userData.Identifier != "user-1" {
+		t.Fatalf("User data not found after reopen")
+	}
+}
+
+func TestFilePutNotUnique(t *testing.T) {
+	path, cleanup := createCacheFilePath(t)
+	defer cleanup()
+	adapter, err := NewFileCacheAdapter("test-adapter", path, 1, 1)
+	if err != nil {
+		t.Fatalf("Opening cache file error: %v", err)
+	}
+	defer adapter.Close()
+
+	if err := adapter.PutSession(&common.Session{Id: "i1", Cookie: "c1"}); err != nil {
+		t.Errorf("Saving session error: %v", err)
+	}
+	if err := adapter.PutSession(&common.Session{Id: "i2", Cookie: "c1"}); err == nil {
+		t.Errorf("Expect saving error")
+	}
+}
+
+func TestFileRemoveSession(t *testing.T) {
+	path, cleanup := createCacheFilePath(t)
+	defer cleanup()
+	adapter, err := NewFileCacheAdapter("test-adapter", path, 1, 1)
+	if err != nil {
+		t.Fatalf("Opening cache file error: %v", err)
+	}
+	defer adapter.Close()
+
+	session := &common.Session{Id: "i1", Cookie: "c1"}
+	if err := adapter.PutSession(session); err != nil {
+		t.Errorf("Saving session error: %v", err)
+	}
+	adapter.RemoveSession(session)
+
+	if _, found := adapter.GetSession("c1"); found {
+		t.Errorf("Expect not found")
+	}
+}
+
+func TestFileExpiredEntriesEvicted(t *testing.T) {
+	path, cleanup := createCacheFilePath(t)
+	defer cleanup()
+	adapter, err := newFileCacheAdapter("test-adapter", path, 50*time.Millisecond, 20*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Opening cache file error: %v", err)
+	}
+	defer adapter.Close()
+
+	if err := adapter.PutSession(&common.Session{Id: "i1", Cookie: "c1"}); err != nil {
+		t.Errorf("Saving session error: %v", err)
+	}
+	if _, found := adapter.GetSession("c1"); !found {
+		t.Fatalf("Session not found")
+	}
+
+	time.Sleep(150 * time.Millisecond)
+
+	if _, found := adapter.GetSession("c1"); found {
+		t.Errorf("Expect expired session not found")
+	}
+	entries := 0
+	_ = adapter.db.View(func(tx *bolt.Tx) error {
+		entries = tx.Bucket(sessionsBucket).Stats().KeyN
+		return nil
+	})
+	if entries != 0 {
+		t.Errorf("Expect expired entries evicted from file. Found: %v", entries)
+	}
+}
+
+func TestFileZeroExpirationNeverExpires(t *testing.T) {
+	path, cleanup := createCacheFilePath(t)
+	defer cleanup()
+	adapter, err := newFileCacheAdapter("test-adapter", path, 0, 20*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Opening cache file error: %v", err)
+	}
+	defer adapter.Close()
+
+	session := &common.Session{Id: "i1", Cookie: "c1"}
+	if err := adapter.PutSession(session); err != nil {
+		t.Errorf("Saving session error: %v", err)
+	}
+	if err := adapter.PutUserData(session, &common.UserData{Identifier: "user-1"}); err != nil {
+		t.Errorf("Saving user data error: %v", err)
+	}
+
+	// Let the eviction run a few times
+	time.Sleep(100 * time.Millisecond)
+
+	if _, found := adapter.GetSession("c1"); !found {
+		t.Errorf("Expect session without expiration found")
+	}
+	if _, found := adapter.FindUserData(session); !found {
+		t.Errorf("Expect user data without expiration found")
+	}
+	if err := adapter.PutSession(session); err == nil {
+		t.Errorf("Expect session without expiration can't be replaced")
+	}
+}
+
+func TestFileTakeLoginStateOnceConcurrently(t *testing.T) {
+	path, cleanup := createCacheFilePath(t)
+	defer cleanup()
+	adapter, err := NewFileCacheAdapter("test-adapter", path, 1, 1)
+	if err != nil {
+		t.Fatalf("Opening cache file error: %v", err)
+	}
+	defer adapter.Close()
+
+	session := &common.Session{Id: "i1", Cookie: "c1"}
+	err = adapter.PutLoginState(session, &common.LoginState{State: "state", Expires: time.Now().Add(time.Minute)})
+	if err != nil {
+		t.Errorf("Saving login state error: %v", err)
+	}
+
+	var taken int
+	var mutex sync.Mutex
+	var group sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			if _, found := adapter.TakeLoginState(session); found {
+				mutex.Lock()
+				taken++
+				mutex.Unlock()
+			}
+		}()
+	}
+	group.Wait()
+
+	if taken != 1 {
+		t.Errorf("Expect login state taken exactly once. Taken: %v", taken)
+	}
+}
+
+func TestFileTakeToken(t *testing.T) {
+	path, cleanup := createCacheFilePath(t)
+	defer cleanup()
+	adapter, err := NewFileCacheAdapter("test-adapter", path, 1, 1)
+	if err != nil {
+		t.Fatalf("Opening cache file error: %v", err)
+	}
+	defer adapter.Close()
+
+	for i := 0; i < 2; i++ {
+		allowed, _, err := adapter.TakeToken("filter:client-ip:10.0.0.1", 1, 2)
+		if err != nil || !allowed {
+			t.Fatalf("Expect token %v taken within burst, err: %v", i, err)
+		}
+	}
+	allowed, retryAfter, err := adapter.TakeToken("filter:client-ip:10.0.0.1", 1, 2)
+	if err != nil || allowed {
+		t.Fatalf("Expect token denied after burst, err: %v", err)
+	}
+	if retryAfter <= 0 || retryAfter > time.Second {
+		t.Fatalf("Expect retry after within a second, got: %v", retryAfter)
+	}
+	_ = adapter.db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(rateLimitsBucket) != nil {
+			t.Fatalf("Expect token buckets kept in memory, not in the file")
+		}
+		return nil
+	})
+}
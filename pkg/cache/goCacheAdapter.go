@@ -2,21 +2,27 @@ package cache
 
 import (
 	"github.com/Alcereo/ordinator/pkg/common"
+	"github.com/Alcereo/ordinator/pkg/metrics"
 	"github.com/patrickmn/go-cache"
 	"github.com/satori/go.uuid"
+	"sync"
 	"time"
 )
 
 type goCacheSessionCacheAdapter struct {
-	cookieCache *cache.Cache
+	identifier      string
+	cookieCache     *cache.Cache
+	loginStateMutex sync.Mutex
+	rateLimitMutex  sync.Mutex
 }
 
-func NewGoCacheSessionCacheProvider(expirationTimeHours int, evictScheduleTimeHours int) *goCacheSessionCacheAdapter {
+func NewGoCacheSessionCacheProvider(identifier string, expirationTimeHours int, evictScheduleTimeHours int) *goCacheSessionCacheAdapter {
 	cookieCache := cache.New(
 		time.Hour*time.Duration(expirationTimeHours),
 		time.Hour*time.Duration(evictScheduleTimeHours),
 	)
 	return &goCacheSessionCacheAdapter{
+		identifier:  identifier,
 		cookieCache: cookieCache,
 	}
 }
@@ -27,6 +33,7 @@ func (adapter *goCacheSessionCacheAdapter) PutSession(session *common.Session) e
 
 func (adapter *goCacheSessionCacheAdapter) GetSession(cookie common.SessionCookie) (*common.Session, bool) {
 	session, found := adapter.cookieCache.Get(string(cookie))
+	metrics.ObserveCacheLookup(adapter.identifier, "session", found)
 	if found {
 		return session.(*common.Session), true
 	} else {
@@ -50,6 +57,7 @@ func (*goCacheSessionCacheAdapter) CreateNewCookie() common.SessionCookie {
 
 func (adapter *goCacheSessionCacheAdapter) FindUserData(session *common.Session) (*common.UserData, bool) {
 	userData, found := adapter.cookieCache.Get(string(session.Id))
+	metrics.ObserveCacheLookup(adapter.identifier, "user-data", found)
 	if found {
 		return userData.(*common.UserData), true
 	} else {
@@ -60,3 +68,44 @@ func (adapter *goCacheSessionCacheAdapter) FindUserData(session *common.Session)
 func (adapter *goCacheSessionCacheAdapter) PutUserData(session *common.Session, userData *common.UserData) error {
 	return adapter.cookieCache.Add(string(session.Id), userData, cache.DefaultExpiration)
 }
+
+func (adapter *goCacheSessionCacheAdapter) RemoveUserData(session *common.Session) {
+	adapter.cookieCache.Delete(string(session.Id))
+}
+
+func (adapter *goCacheSessionCacheAdapter) PutLoginState(session *common.Session, loginState *common.LoginState) error {
+	adapter.cookieCache.Set(loginStateKey(session), loginState, time.Until(loginState.Expires))
+	return nil
+}
+
+func (adapter *goCacheSessionCacheAdapter) TakeLoginState(session *common.Session) (*common.LoginState, bool) {
+	adapter.loginStateMutex.Lock()
+	defer adapter.loginStateMutex.Unlock()
+
+	key := loginStateKey(session)
+	loginState, found := adapter.cookieCache.Get(key)
+	if !found {
+		return nil, false
+	}
+	adapter.cookieCache.Delete(key)
+	return loginState.(*common.LoginState), true
+}
+
+// RateLimitCachePort implementation
+
+func (adapter *goCacheSessionCacheAdapter) TakeToken(key string, rate float64, burst int) (bool, time.Duration, error) {
+	adapter.rateLimitMutex.Lock()
+	defer adapter.rateLimitMutex.Unlock()
+
+	bucket := &common.TokenBucket{}
+	if value, found := adapter.cookieCache.Get(rateLimitKeyPrefix + key); found {
+		bucket = value.(*common.TokenBucket)
+	}
+	allowed, retryAfter := bucket.Take(time.Now(), rate, burst)
+	adapter.cookieCache.Set(rateLimitKeyPrefix+key, bucket, common.TokenBucketTTL(rate, burst))
+	return allowed, retryAfter, nil
+}
+
+func loginStateKey(session *common.Session) string {
+	return loginStateKeyPrefix + string(session.Id)
+}
@@ -7,7 +7,7 @@ import (
 )
 
 func TestPutNew(t *testing.T) {
-	adapter := NewGoCacheSessionCacheProvider(1, 1)
+	adapter := NewGoCacheSessionCacheProvider("test-adapter", 1, 1)
 
 	session := &common.Session{
 		Id:      "i1",
@@ -32,7 +32,7 @@ func TestPutNew(t *testing.T) {
 }
 
 func TestPutNotUnique(t *testing.T) {
-	adapter := NewGoCacheSessionCacheProvider(1, 1)
+	adapter := NewGoCacheSessionCacheProvider("test-adapter", 1, 1)
 
 	sessionFirst := &common.Session{
 		Id:      "i1",
@@ -56,7 +56,7 @@ func TestPutNotUnique(t *testing.T) {
 }
 
 func TestGetNotFound(t *testing.T) {
-	adapter := NewGoCacheSessionCacheProvider(1, 1)
+	adapter := NewGoCacheSessionCacheProvider("test-adapter", 1, 1)
 
 	sessionFirst := &common.Session{
 		Id:      "i1",
@@ -78,7 +78,7 @@ func TestGetNotFound(t *testing.T) {
 }
 
 func TestRemoveSession(t *testing.T) {
-	adapter := NewGoCacheSessionCacheProvider(1, 1)
+	adapter := NewGoCacheSessionCacheProvider("test-adapter", 1, 1)
 
 	session := &common.Session{
 		Id:      "i1",
@@ -102,7 +102,7 @@ func TestRemoveSession(t *testing.T) {
 }
 
 func TestIdentifiersCreating(t *testing.T) {
-	adapter := NewGoCacheSessionCacheProvider(1, 1)
+	adapter := NewGoCacheSessionCacheProvider("test-adapter", 1, 1)
 
 	identifier := adapter.CreateNewIdentifier()
 	if identifier == "" {
@@ -114,3 +114,56 @@ func TestIdentifiersCreating(t *testing.T) {
 		t.Errorf("Expect valid identifier")
 	}
 }
+
+func TestTakeLoginStateOnce(t *testing.T) {
+	adapter := NewGoCacheSessionCacheProvider("test-adapter", 1, 1)
+
+	session := &common.Session{
+		Id:      "i1",
+		Cookie:  "c1",
+		Expires: time.Now(),
+	}
+	loginState := &common.LoginState{
+		State:        "state",
+		CodeVerifier: "verifier",
+		Expires:      time.Now().Add(time.Minute),
+	}
+	err := adapter.PutLoginState(session, loginState)
+	if err != nil {
+		t.Errorf("Saving login state error: %v", err)
+	}
+
+	takenState, found := adapter.TakeLoginState(session)
+	if !found {
+		t.Fatalf("Login state not found")
+	}
+	if takenState != loginState {
+		t.Fatalf("Taken login state not equal saved")
+	}
+
+	_, found = adapter.TakeLoginState(session)
+	if found {
+		t.Errorf("Expect login state removed after take")
+	}
+}
+
+func TestTakeToken(t *testing.T) {
+	adapter := NewGoCacheSessionCacheProvider("test-adapter", 1, 1)
+
+	for i := 0; i < 2; i++ {
+		allowed, _, err := adapter.TakeToken("filter:client-ip:10.0.0.1", 1, 2)
+		if err != nil || !allowed {
+			t.Fatalf("Expect token %v taken within burst, err: %v", i, err)
+		}
+	}
+	allowed, retryAfter, err := adapter.TakeToken("filter:client-ip:10.0.0.1", 1, 2)
+	if err != nil || allowed {
+		t.Fatalf("Expect token denied after burst, err: %v", err)
+	}
+	if retryAfter <= 0 || retryAfter > time.Second {
+		t.Fatalf("Expect retry after within a second, got: %v", retryAfter)
+	}
+	if allowed, _, _ := adapter.TakeToken("filter:client-ip:10.0.0.2", 1, 2); !allowed {
+		t.Fatalf("Expect other keys limited separately")
+	}
+}
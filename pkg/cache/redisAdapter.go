@@ -0,0 +1,237 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Alcereo/ordinator/pkg/common"
+	"github.com/Alcereo/ordinator/pkg/metrics"
+	"github.com/go-redis/redis"
+	"github.com/satori/go.uuid"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+const (
+	sessionKeyPrefix    = "session:"
+	userDataKeyPrefix   = "user-data:"
+	loginStateKeyPrefix = "login-state:"
+	rateLimitKeyPrefix  = "rate-limit:"
+)
+
+// takeTokenScript refills and takes from the token bucket atomically, see common.TokenBucket.
+// Time is taken from the Redis server, gateway clocks skew would hand out extra tokens.
+var takeTokenScript = redis.NewScript(`
+redis.replicate_commands()
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local ttl = tonumber(ARGV[3])
+local time = redis.call("TIME")
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local state = redis.call("HMGET", KEYS[1], "tokens", "updated")
+local tokens = tonumber(state[1])
+local updated = tonumber(state[2])
+if tokens == nil or updated == nil then
+	tokens = burst
+elseif now > updated then
+	tokens = tokens + (now - updated) / 1000 * rate
+end
+if tokens > burst then
+	tokens = burst
+end
+local allowed = 0
+local retryAfter = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	retryAfter = math.ceil((1 - tokens) / rate * 1000)
+end
+redis.call("HMSET", KEYS[1], "tokens", tostring(tokens), "updated", tostring(now))
+redis.call("PEXPIRE", KEYS[1], ttl)
+return {allowed, retryAfter}
+`)
+
+// Sessions, user data and login states are stored as JSON under '<key-prefix><type>:<id>' keys
+type redisCacheAdapter struct {
+	identifier string
+	client     *redis.Client
+	keyPrefix  string
+	expiration time.Duration
+}
+
+func NewRedisCacheAdapter(
+	identifier string,
+	address string,
+	password string,
+	database int,
+	keyPrefix string,
+	expirationTimeHours int,
+) *redisCacheAdapter {
+	client := redis.NewClient(&redis.Options{
+		Addr:     address,
+		Password: password,
+		DB:       database,
+	})
+	if err := client.Ping().Err(); err != nil {
+		log.Warnf("Redis %v is not available. Reason: %v", address, err)
+	}
+	return &redisCacheAdapter{
+		identifier: identifier,
+		client:     client,
+		keyPrefix:  keyPrefix,
+		expiration: time.Hour * time.Duration(expirationTimeHours),
+	}
+}
+
+// Close releases the connections of the client
+func (adapter *redisCacheAdapter) Close() error {
+	return adapter.client.Close()
+}
+
+func (adapter *redisCacheAdapter) PutSession(session *common.Session) error {
+	return adapter.add(sessionKeyPrefix+string(session.Cookie), session, adapter.expiration)
+}
+
+func (adapter *redisCacheAdapter) GetSession(cookie common.SessionCookie) (*common.Session, bool) {
+	var session common.Session
+	found := adapter.get(sessionKeyPrefix+string(cookie), &session)
+	metrics.ObserveCacheLookup(adapter.identifier, "session", found)
+	if !found {
+		return nil, false
+	}
+	return &session, true
+}
+
+func (adapter *redisCacheAdapter) RemoveSession(session *common.Session) {
+	adapter.remove(sessionKeyPrefix + string(session.Cookie))
+}
+
+func (*redisCacheAdapter) CreateNewIdentifier() common.SessionId {
+	return common.SessionId(uuid.NewV4().String())
+}
+
+func (*redisCacheAdapter) CreateNewCookie() common.SessionCookie {
+	return common.SessionCookie(uuid.NewV4().String())
+}
+
+// UserAuthenticationPort implementation
+
+func (adapter *redisCacheAdapter) FindUserData(session *common.Session) (*common.UserData, bool) {
+	var userData common.UserData
+	found := adapter.get(userDataKeyPrefix+string(session.Id), &userData)
+	metrics.ObserveCacheLookup(adapter.identifier, "user-data", found)
+	if !found {
+		return nil, false
+	}
+	return &userData, true
+}
+
+func (adapter *redisCacheAdapter) PutUserData(session *common.Session, userData *common.UserData) error {
+	return adapter.add(userDataKeyPrefix+string(session.Id), userData, adapter.expiration)
+}
+
+func (adapter *redisCacheAdapter) RemoveUserData(session *common.Session) {
+	adapter.remove(userDataKeyPrefix + string(session.Id))
+}
+
+func (adapter *redisCacheAdapter) PutLoginState(session *common.Session, loginState *common.LoginState) error {
+	data, err := json.Marshal(loginState)
+	if err != nil {
+		return err
+	}
+	return adapter.client.Set(adapter.key(loginStateKeyPrefix+string(session.Id)), data, time.Until(loginState.Expires)).Err()
+}
+
+func (adapter *redisCacheAdapter) TakeLoginState(session *common.Session) (*common.LoginState, bool) {
+	key := adapter.key(loginStateKeyPrefix + string(session.Id))
+
+	var get *redis.StringCmd
+	_, err := adapter.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		get = pipe.Get(key)
+		pipe.Del(key)
+		return nil
+	})
+	if err != nil {
+		if err != redis.Nil {
+			log.Errorf("Taking login state from redis error. Reason: %v", err)
+		}
+		return nil, false
+	}
+
+	var loginState common.LoginState
+	if err := unmarshal(get, &loginState); err != nil {
+		log.Errorf("Taking login state from redis error. Reason: %v", err)
+		return nil, false
+	}
+	return &loginState, true
+}
+
+// Internal
+
+func (adapter *redisCacheAdapter) key(key string) string {
+	return adapter.keyPrefix + key
+}
+
+// add stores the value only if the key doesn't exist yet, as the GoCache adapter does
+func (adapter *redisCacheAdapter) add(key string, value interface{}, expiration time.Duration) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	added, err := adapter.client.SetNX(adapter.key(key), data, expiration).Result()
+	if err != nil {
+		return err
+	}
+	if !added {
+		return fmt.Errorf("item %s already exists", key)
+	}
+	return nil
+}
+
+func (adapter *redisCacheAdapter) get(key string, value interface{}) bool {
+	cmd := adapter.client.Get(adapter.key(key))
+	if cmd.Err() == redis.Nil {
+		return false
+	}
+	if err := unmarshal(cmd, value); err != nil {
+		log.Errorf("Getting %v from redis error. Reason: %v", key, err)
+		return false
+	}
+	return true
+}
+
+func (adapter *redisCacheAdapter) remove(key string) {
+	if err := adapter.client.Del(adapter.key(key)).Err(); err != nil {
+		log.Errorf("Removing %v from redis error. Reason: %v", key, err)
+	}
+}
+
+func unmarshal(cmd *redis.StringCmd, value interface{}) error {
+	data, err := cmd.Bytes()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, value)
+}
+
+// RateLimitCachePort implementation
+
+func (adapter *redisCacheAdapter) TakeToken(key string, rate float64, burst int) (bool, time.Duration, error) {
+	result, err := takeTokenScript.Run(
+		adapter.client,
+		[]string{adapter.key(rateLimitKeyPrefix + key)},
+		rate,
+		burst,
+		common.TokenBucketTTL(rate, burst).Nanoseconds()/int64(time.Millisecond),
+	).Result()
+	if err != nil {
+		return false, 0, err
+	}
+	values, ok := result.([]interface{})
+	if !ok || len(values) != 2 {
+		return false, 0, fmt.Errorf("unexpected rate limit script result: %v", result)
+	}
+	allowed, _ := values[0].(int64)
+	retryAfter, _ := values[1].(int64)
+	return allowed == 1, time.Duration(retryAfter) * time.Millisecond, nil
+}
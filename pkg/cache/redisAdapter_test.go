@@ -0,0 +1,221 @@
+package cache
+
+import (
+	"github.com/Alcereo/ordinator/pkg/common"
+	"github.com/alicebob/miniredis/v2"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func createRedisAdapter(t *testing.T) (*redisCacheAdapter, *miniredis.Miniredis) {
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("Starting redis stand-in error: %v", err)
+	}
+	return NewRedisCacheAdapter("test-adapter", server.Addr(), "", 0, "ordinator:", 1), server
+}
+
+func TestRedisPutNew(t *testing.T) {
+	adapter, server := createRedisAdapter(t)
+	defer server.Close()
+
+	session := &common.Session{
+		Id:      "i1",
+		Cookie:  "c1",
+		Expires: time.Now().Round(time.Second),
+	}
+	err := adapter.PutSession(session)
+	if err != nil {
+		t.Errorf("Saving session error: %v", err)
+	}
+
+	cachedSession, found := adapter.GetSession("c1")
+	if !found {
+		t.Fatalf("Session not found")
+	}
+	if cachedSession.Id != session.Id || cachedSession.Cookie != session.Cookie || !cachedSession.Expires.Equal(session.Expires) {
+		t.Fatalf("Cached session %+v not equal saved %+v", cachedSession, session)
+	}
+	if !server.Exists("ordinator:session:c1") {
+		t.Fatalf("Session must be stored with key prefix")
+	}
+}
+
+func TestRedisPutNotUnique(t *testing.T) {
+	adapter, server := createRedisAdapter(t)
+	defer server.Close()
+
+	err := adapter.PutSession(&common.Session{Id: "i1", Cookie: "c1", Expires: time.Now()})
+	if err != nil {
+		t.Errorf("Saving session error: %v", err)
+	}
+
+	err = adapter.PutSession(&common.Session{Id: "i2", Cookie: "c1", Expires: time.Now()})
+	if err == nil {
+		t.Errorf("Expect saving error")
+	}
+}
+
+func TestRedisSessionExpiration(t *testing.T) {
+	adapter, server := createRedisAdapter(t)
+	defer server.Close()
+
+	err := adapter.PutSession(&common.Session{Id: "i1", Cookie: "c1", Expires: time.Now()})
+	if err != nil {
+		t.Errorf("Saving session error: %v", err)
+	}
+
+	server.FastForward(time.Hour + time.Second)
+
+	_, found := adapter.GetSession("c1")
+	if found {
+		t.Errorf("Expect session evicted after evict-time-hours")
+	}
+}
+
+func TestRedisRemoveSession(t *testing.T) {
+	adapter, server := createRedisAdapter(t)
+	defer server.Close()
+
+	session := &common.Session{Id: "i1", Cookie: "c1", Expires: time.Now()}
+	err := adapter.PutSession(session)
+	if err != nil {
+		t.Errorf("Saving session error: %v", err)
+	}
+
+	adapter.RemoveSession(session)
+
+	cachedSession, found := adapter.GetSession("c1")
+	if found {
+		t.Errorf("Expect not found")
+	}
+	if cachedSession != nil {
+		t.Errorf("Expect nil session")
+	}
+}
+
+func TestRedisUserData(t *testing.T) {
+	adapter, server := createRedisAdapter(t)
+	defer server.Close()
+
+	session := &common.Session{Id: "i1", Cookie: "c1", Expires: time.Now()}
+	userData := &common.UserData{
+		Identifier: "user-1",
+		Username:   "User",
+		Email:      "user@mail.com",
+		Groups:     []string{"admins"},
+		Claims:     map[string]interface{}{"hd": "mail.com"},
+		Tokens:     common.ProviderTokens{RefreshToken: "refresh-token"},
+	}
+	err := adapter.PutUserData(session, userData)
+	if err != nil {
+		t.Errorf("Saving user data error: %v", err)
+	}
+
+	cachedUserData, found := adapter.FindUserData(session)
+	if !found {
+		t.Fatalf("User data not found")
+	}
+	if !reflect.DeepEqual(cachedUserData, userData) {
+		t.Fatalf("Cached user data %+v not equal saved %+v", cachedUserData, userData)
+	}
+
+	adapter.RemoveUserData(session)
+	_, found = adapter.FindUserData(session)
+	if found {
+		t.Errorf("Expect user data removed")
+	}
+}
+
+func TestRedisTakeLoginStateOnce(t *testing.T) {
+	adapter, server := createRedisAdapter(t)
+	defer server.Close()
+
+	session := &common.Session{Id: "i1", Cookie: "c1", Expires: time.Now()}
+	err := adapter.PutLoginState(session, &common.LoginState{
+		State:        "state",
+		CodeVerifier: "verifier",
+		Expires:      time.Now().Add(time.Minute),
+	})
+	if err != nil {
+		t.Errorf("Saving login state error: %v", err)
+	}
+
+	loginState, found := adapter.TakeLoginState(session)
+	if !found {
+		t.Fatalf("Login state not found")
+	}
+	if loginState.State != "state" || loginState.CodeVerifier != "verifier" {
+		t.Fatalf("Unexpected login state %+v", loginState)
+	}
+
+	_, found = adapter.TakeLoginState(session)
+	if found {
+		t.Errorf("Expect login state removed after take")
+	}
+}
+
+func TestRedisTakeToken(t *testing.T) {
+	adapter, server := createRedisAdapter(t)
+	defer server.Close()
+	// Second adapter stands for another gateway replica
+	replica := NewRedisCacheAdapter("test-adapter", server.Addr(), "", 0, "ordinator:", 1)
+
+	allowed, _, err := adapter.TakeToken("filter:client-ip:10.0.0.1", 1, 2)
+	if err != nil || !allowed {
+		t.Fatalf("Expect first token taken, err: %v", err)
+	}
+	allowed, _, err = replica.TakeToken("filter:client-ip:10.0.0.1", 1, 2)
+	if err != nil || !allowed {
+		t.Fatalf("Expect second token taken on replica, err: %v", err)
+	}
+	allowed, retryAfter, err := adapter.TakeToken("filter:client-ip:10.0.0.1", 1, 2)
+	if err != nil || allowed {
+		t.Fatalf("Expect token denied after burst shared by replicas, err: %v", err)
+	}
+	if retryAfter <= 0 || retryAfter > time.Second {
+		t.Fatalf("Expect retry after within a second, got: %v", retryAfter)
+	}
+	if !server.Exists("ordinator:rate-limit:filter:client-ip:10.0.0.1") {
+		t.Fatalf("Token bucket must be stored with key prefix")
+	}
+	if ttl := server.TTL("ordinator:rate-limit:filter:client-ip:10.0.0.1"); ttl <= 0 {
+		t.Fatalf("Token bucket must expire, ttl: %v", ttl)
+	}
+}
+
+func TestRedisTakeTokenByServerTime(t *testing.T) {
+	adapter, server := createRedisAdapter(t)
+	defer server.Close()
+	start := time.Now().Add(-time.Hour)
+	server.SetTime(start)
+
+	for i := 0; i < 2; i++ {
+		if allowed, _, err := adapter.TakeToken("filter:client-ip:10.0.0.1", 1, 2); err != nil || !allowed {
+			t.Fatalf("Expect token %v taken within burst, err: %v", i, err)
+		}
+	}
+	if allowed, _, err := adapter.TakeToken("filter:client-ip:10.0.0.1", 1, 2); err != nil || allowed {
+		t.Fatalf("Expect token denied after burst, err: %v", err)
+	}
+
+	// Gateway clock is an hour ahead, refill follows the server clock only
+	server.SetTime(start.Add(time.Second))
+
+	if allowed, _, err := adapter.TakeToken("filter:client-ip:10.0.0.1", 1, 2); err != nil || !allowed {
+		t.Fatalf("Expect token refilled by the server time, err: %v", err)
+	}
+	if allowed, _, err := adapter.TakeToken("filter:client-ip:10.0.0.1", 1, 2); err != nil || allowed {
+		t.Fatalf("Expect single token refilled in a second of the server time, err: %v", err)
+	}
+}
+
+func TestRedisTakeTokenUnavailable(t *testing.T) {
+	adapter, server := createRedisAdapter(t)
+	server.Close()
+
+	if _, _, err := adapter.TakeToken("filter:client-ip:10.0.0.1", 1, 2); err == nil {
+		t.Fatalf("Expect error when redis is not available")
+	}
+}
@@ -0,0 +1,59 @@
+package cache
+
+import (
+	"github.com/Alcereo/ordinator/pkg/common"
+	"github.com/Alcereo/ordinator/pkg/metrics"
+)
+
+// sessionStorageAdapter keeps user data and login state inside the session itself.
+// It is meant for stateless cookie sessions, where the whole session is sealed into the cookie.
+type sessionStorageAdapter struct {
+	identifier string
+}
+
+func NewSessionStorageAdapter(identifier string) *sessionStorageAdapter {
+	return &sessionStorageAdapter{
+		identifier: identifier,
+	}
+}
+
+// UserAuthenticationPort implementation
+
+func (adapter *sessionStorageAdapter) FindUserData(session *common.Session) (*common.UserData, bool) {
+	metrics.ObserveCacheLookup(adapter.identifier, "user-data", session.UserData != nil)
+	if session.UserData == nil {
+		return nil, false
+	}
+	return session.UserData, true
+}
+
+func (*sessionStorageAdapter) PutUserData(session *common.Session, userData *common.UserData) error {
+	session.UserData = userData
+	session.Modified = true
+	return nil
+}
+
+func (*sessionStorageAdapter) RemoveUserData(session *common.Session) {
+	if session.UserData != nil {
+		session.UserData = nil
+		session.Modified = true
+	}
+}
+
+func (*sessionStorageAdapter) PutLoginState(session *common.Session, loginState *common.LoginState) error {
+	session.LoginState = loginState
+	session.Modified = true
+	return nil
+}
+
+// TakeLoginState can't prevent a replay of an older cookie which still holds the state,
+// but the state keeps binding the callback to the browser which initiated login.
+func (*sessionStorageAdapter) TakeLoginState(session *common.Session) (*common.LoginState, bool) {
+	loginState := session.LoginState
+	if loginState == nil {
+		return nil, false
+	}
+	session.LoginState = nil
+	session.Modified = true
+	return loginState, true
+}
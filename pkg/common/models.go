@@ -12,6 +12,23 @@ type UserData struct {
 	Email      string
 	Picture    string
 	Locale     string
+	// Groups or roles of the user given by the provider
+	Groups []string `json:",omitempty"`
+	// Claims about the user given by the provider, like 'hd' or 'email_verified'
+	Claims map[string]interface{} `json:",omitempty"`
+	Tokens ProviderTokens
+}
+
+// ProviderTokens are kept to end the provider session on logout
+type ProviderTokens struct {
+	AccessToken  string
+	RefreshToken string
+	IdToken      string
+}
+
+// String keeps tokens out of the logs
+func (ProviderTokens) String() string {
+	return "{redacted}"
 }
 
 // Session
@@ -22,7 +39,57 @@ type Session struct {
 	Id      SessionId
 	Cookie  SessionCookie
 	Expires time.Time
+	// Kept in the session itself only with stateless cookie sessions
+	UserData   *UserData   `json:",omitempty"`
+	LoginState *LoginState `json:",omitempty"`
+	// Modified marks that the session must be written to the cookie again
+	Modified bool `json:"-"`
+	// Removed marks that the session was ended and its cookie expired, it must not be written again
+	Removed bool `json:"-"`
 }
 
 type SessionId string
 type SessionCookie string
+
+// Login state
+
+// LoginState binds an OAuth2 authorization request to the session which started it.
+type LoginState struct {
+	State        string
+	CodeVerifier string
+	// OpenID Connect 'nonce', expected back in the ID token
+	Nonce   string
+	Expires time.Time
+}
+
+// Rate limiting
+
+// TokenBucket is refilled with rate tokens per second up to the burst, zero value is a full bucket
+type TokenBucket struct {
+	Tokens  float64
+	Updated time.Time
+}
+
+// Take consumes a token, or returns the time until a token is available
+func (bucket *TokenBucket) Take(now time.Time, rate float64, burst int) (bool, time.Duration) {
+	if bucket.Updated.IsZero() {
+		bucket.Tokens = float64(burst)
+	} else if elapsed := now.Sub(bucket.Updated).Seconds(); elapsed > 0 {
+		bucket.Tokens += elapsed * rate
+	}
+	if bucket.Tokens > float64(burst) {
+		bucket.Tokens = float64(burst)
+	}
+	bucket.Updated = now
+
+	if bucket.Tokens >= 1 {
+		bucket.Tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - bucket.Tokens) / rate * float64(time.Second))
+}
+
+// TokenBucketTTL is the time a bucket needs to be refilled, after it the bucket can be forgotten
+func TokenBucketTTL(rate float64, burst int) time.Duration {
+	return time.Duration(float64(burst)/rate*float64(time.Second)) + time.Second
+}
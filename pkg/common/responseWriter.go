@@ -0,0 +1,72 @@
+package common
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// ResponseWriter passes the response through to the wrapped writer and calls beforeHeader once,
+// right before the header is written, flushed or the connection is hijacked, so the filters can
+// complete the header with what the chain has done. Flush and Hijack are kept working through it
+// for streamed responses and protocol upgrades.
+type ResponseWriter struct {
+	http.ResponseWriter
+	// beforeHeader returns the status to write, the status is ignored for hijacked connections
+	beforeHeader  func(statusCode int) int
+	headerWritten bool
+}
+
+func WrapResponseWriter(writer http.ResponseWriter, beforeHeader func(statusCode int) int) *ResponseWriter {
+	return &ResponseWriter{
+		ResponseWriter: writer,
+		beforeHeader:   beforeHeader,
+	}
+}
+
+func (writer *ResponseWriter) WriteHeader(statusCode int) {
+	if !writer.headerWritten {
+		writer.headerWritten = true
+		statusCode = writer.beforeHeader(statusCode)
+	}
+	writer.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (writer *ResponseWriter) Write(bytes []byte) (int, error) {
+	if !writer.headerWritten {
+		writer.WriteHeader(http.StatusOK)
+	}
+	return writer.ResponseWriter.Write(bytes)
+}
+
+func (writer *ResponseWriter) Flush() {
+	if !writer.headerWritten {
+		writer.WriteHeader(http.StatusOK)
+	}
+	if flusher, ok := writer.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack completes the header first, the upgrade response is written from the header
+func (writer *ResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := writer.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer %T doesn't support hijacking", writer.ResponseWriter)
+	}
+	if !writer.headerWritten {
+		writer.headerWritten = true
+		writer.beforeHeader(http.StatusSwitchingProtocols)
+	}
+	return hijacker.Hijack()
+}
+
+// Unwrap gives http.ResponseController access to the wrapped writer
+func (writer *ResponseWriter) Unwrap() http.ResponseWriter {
+	return writer.ResponseWriter
+}
+
+func (writer *ResponseWriter) HeaderWritten() bool {
+	return writer.headerWritten
+}
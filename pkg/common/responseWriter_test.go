@@ -0,0 +1,50 @@
+package common
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBeforeHeaderCalledOnce(t *testing.T) {
+	// Given
+	calls := 0
+	recorder := httptest.NewRecorder()
+	writer := WrapResponseWriter(recorder, func(statusCode int) int {
+		calls++
+		recorder.Header().Set("X-Status", http.StatusText(statusCode))
+		return http.StatusInternalServerError
+	})
+
+	// When
+	_, _ = writer.Write([]byte("body"))
+	writer.Flush()
+	_, _ = writer.Write([]byte("body"))
+
+	// Then
+	if calls != 1 {
+		t.Fatalf("Expect the header completed once, got calls: %v", calls)
+	}
+	if recorder.Code != http.StatusInternalServerError || recorder.Header().Get("X-Status") != "OK" {
+		t.Fatalf("Expect the status replaced, got status: %v, header: %v", recorder.Code, recorder.Header())
+	}
+	if !recorder.Flushed {
+		t.Fatalf("Expect flush passed through")
+	}
+}
+
+func TestHijackNotSupported(t *testing.T) {
+	// Given
+	writer := WrapResponseWriter(httptest.NewRecorder(), func(statusCode int) int {
+		t.Fatalf("Expect the header not completed for a failed hijack")
+		return statusCode
+	})
+
+	// When
+	_, _, err := writer.Hijack()
+
+	// Then
+	if err == nil || writer.HeaderWritten() {
+		t.Fatalf("Expect hijacking rejected by the wrapped writer")
+	}
+}
@@ -4,7 +4,12 @@ type RouterType string
 
 const (
 	ReverseProxy              RouterType = "ReverseProxy"
+	UpstreamHealthStatus      RouterType = "UpstreamHealthStatus"
 	GoogleOauth2Authorization RouterType = "GoogleOauth2Authorization"
+	OidcAuthorization         RouterType = "OidcAuthorization"
+	Logout                    RouterType = "Logout"
+	// Publishes public keys of the user data serializers
+	UserDataJwks RouterType = "UserDataJwks"
 )
 
 type FilterType string
@@ -15,32 +20,156 @@ const (
 	UserAuthenticationFilter FilterType = "UserAuthenticationFilter"
 	UserDataSenderFilter     FilterType = "UserDataSenderFilter"
 	CsrfFilter               FilterType = "CsrfFilter"
+	RateLimitFilter          FilterType = "RateLimitFilter"
+	// Always performed first in the router, so preflights don't reach session and csrf filters
+	CorsFilter FilterType = "CorsFilter"
+	// Authenticates machine clients by 'Authorization: Bearer' JWT
+	BearerAuthenticationFilter FilterType = "BearerAuthenticationFilter"
+	// Restricts the route to users matching the authorization rule
+	AuthorizationFilter FilterType = "AuthorizationFilter"
 )
 
 type CacheAdapterType string
 
 const (
 	GoCache CacheAdapterType = "GoCache"
+	Redis   CacheAdapterType = "Redis"
+	File    CacheAdapterType = "File"
+	// Keeps user data inside the session, for the Cookie session mode
+	Session CacheAdapterType = "Session"
 )
 
 type CacheAdapter struct {
 	Identifier             string
 	Type                   CacheAdapterType
-	ExpirationTimeHours    int `mapstructure:"evict-time-hours"`
-	EvictScheduleTimeHours int `mapstructure:"evict-schedule-time-hours"`
+	ExpirationTimeHours    int    `mapstructure:"evict-time-hours"`
+	EvictScheduleTimeHours int    `mapstructure:"evict-schedule-time-hours"`
+	RedisAddress           string `mapstructure:"redis-address"`
+	RedisPassword          string `mapstructure:"redis-password"`
+	RedisDatabase          int    `mapstructure:"redis-database"`
+	KeyPrefix              string `mapstructure:"key-prefix"`
+	FilePath               string `mapstructure:"file-path"`
 }
 
 type UserDataSerializerType string
 
 const (
 	JwtUserDataSerializer UserDataSerializerType = "JwtUserDataSerializer"
+	// Writes each user data field to its own header, like 'X-User-Id', for backends not parsing JWT
+	HeaderUserDataSerializer UserDataSerializerType = "HeaderUserDataSerializer"
 )
 
+// UserDataSerializer signs with the secret by HS256, or with the private key file
+// by RS256, ES256 or EdDSA algorithm. Key id defaults to the public key thumbprint.
 type UserDataSerializer struct {
 	Type   UserDataSerializerType
 	Secret string
+
+	// JWT signing key and claims
+	Algorithm       string
+	PrivateKeyFile  string `mapstructure:"private-key-file"`
+	KeyId           string `mapstructure:"key-id"`
+	Issuer          string
+	Audience        []string
+	LifetimeSeconds int `mapstructure:"lifetime-seconds"`
+	// User data field -> header of the header serializer, overrides the default headers
+	Headers map[string]string
+}
+
+type LoadBalancingType string
+
+const (
+	RoundRobin       LoadBalancingType = "RoundRobin"
+	LeastConnections LoadBalancingType = "LeastConnections"
+	// Pins session to a target, requires a session filter on the router
+	ConsistentHash LoadBalancingType = "ConsistentHash"
+)
+
+// Active health check is enabled when the probe path is set
+type HealthCheck struct {
+	Path               string
+	IntervalSeconds    int `mapstructure:"interval-seconds"`
+	TimeoutSeconds     int `mapstructure:"timeout-seconds"`
+	HealthyThreshold   int `mapstructure:"healthy-threshold"`
+	UnhealthyThreshold int `mapstructure:"unhealthy-threshold"`
+}
+
+// Passive health check is enabled when consecutive failures are set
+type PassiveHealthCheck struct {
+	ConsecutiveFailures int `mapstructure:"consecutive-failures"`
+	EjectionSeconds     int `mapstructure:"ejection-seconds"`
+}
+
+// Upstream transport settings, defaults are used for zero values
+type Transport struct {
+	DialTimeoutSeconds           int `mapstructure:"dial-timeout-seconds"`
+	TLSHandshakeTimeoutSeconds   int `mapstructure:"tls-handshake-timeout-seconds"`
+	ResponseHeaderTimeoutSeconds int `mapstructure:"response-header-timeout-seconds"`
+	IdleConnTimeoutSeconds       int `mapstructure:"idle-conn-timeout-seconds"`
+	MaxIdleConnsPerHost          int `mapstructure:"max-idle-conns-per-host"`
 }
 
+// Header or query parameter condition of the router, empty value matches any value
+type ValueMatch struct {
+	Name  string
+	Value string
+}
+
+// RequestHeaders are sanitized before the router filters. User data headers of all
+// the user data sender filters are always removed, the same as the remove list.
+type RequestHeaders struct {
+	Remove []string
+	Set    []HeaderValue
+}
+
+type HeaderValue struct {
+	Name  string
+	Value string
+}
+
+// Regex replacement of the upstream path, replacement may refer capture groups as $1
+type RewriteRule struct {
+	Pattern     string
+	Replacement string
+}
+
+type RateLimitKey string
+
+const (
+	ClientIpRateLimitKey RateLimitKey = "ClientIp"
+	// Requires a session filter before, requests without session are limited by client ip
+	SessionRateLimitKey RateLimitKey = "Session"
+	// Requires a user authentication filter before, anonymous requests are limited by client ip
+	UserRateLimitKey RateLimitKey = "User"
+)
+
+type CsrfMode string
+
+const (
+	// Encrypted token bound to the session, requires a session filter before
+	HeaderCsrfMode CsrfMode = "Header"
+	// Encrypted token in the cookie is sent back in the header or the form field, works without session.
+	// Cookie is configured by the 'cookie-name', 'cookie-path' and 'cookie-domain'.
+	DoubleSubmitCookieCsrfMode CsrfMode = "DoubleSubmitCookie"
+	// Origin or Referer of unsafe requests is checked against the 'csrf-allowed-origins'
+	OriginCsrfMode CsrfMode = "Origin"
+)
+
+type CsrfTokenScope string
+
+const (
+	SessionCsrfTokenScope CsrfTokenScope = "Session"
+	// Token issued on a page is accepted only for unsafe requests to the same path, like form posts
+	PathCsrfTokenScope CsrfTokenScope = "Path"
+)
+
+type SessionMode string
+
+const (
+	CacheSessionMode  SessionMode = "Cache"
+	CookieSessionMode SessionMode = "Cookie"
+)
+
 type Filter struct {
 	Type                    FilterType
 	Name                    string
@@ -54,21 +183,97 @@ type Filter struct {
 	UserDataTypeSerializer  UserDataSerializer `mapstructure:"user-data-serializer"`
 	UserDataHeader          string             `mapstructure:"user-data-header"`
 	UserDataRequired        bool               `mapstructure:"user-data-required"`
+	CsrfMode                CsrfMode           `mapstructure:"csrf-mode"`
 	CsrfHeader              string             `mapstructure:"csrf-header"`
 	CsrfSafeMethods         []string           `mapstructure:"csrf-safe-methods"`
 	CsrfEncryptorPrivateKey string             `mapstructure:"csrf-encryptor-private-key"`
+	CsrfTokenMaxAgeSeconds  int                `mapstructure:"csrf-token-max-age-seconds"`
+	CsrfTokenScope          CsrfTokenScope     `mapstructure:"csrf-token-scope"`
+	CsrfFormField           string             `mapstructure:"csrf-form-field"`
+	CsrfAllowedOrigins      []string           `mapstructure:"csrf-allowed-origins"`
 	RedirectPage            string             `mapstructure:"redirect-page"`
+	SessionMode             SessionMode        `mapstructure:"session-mode"`
+	SessionKeys             []string           `mapstructure:"session-keys"`
+	SessionCookieMaxBytes   int                `mapstructure:"session-cookie-max-bytes"`
+	RateLimitKey            RateLimitKey       `mapstructure:"rate-limit-key"`
+	RateLimitRate           float64            `mapstructure:"rate-limit-rate"`
+	RateLimitBurst          int                `mapstructure:"rate-limit-burst"`
+	TrustForwardedFor       bool               `mapstructure:"trust-forwarded-for"`
+	CorsAllowedOrigins      []string           `mapstructure:"cors-allowed-origins"`
+	CorsAllowedMethods      []string           `mapstructure:"cors-allowed-methods"`
+	CorsAllowedHeaders      []string           `mapstructure:"cors-allowed-headers"`
+	CorsExposedHeaders      []string           `mapstructure:"cors-exposed-headers"`
+	CorsAllowCredentials    bool               `mapstructure:"cors-allow-credentials"`
+	CorsMaxAgeSeconds       int                `mapstructure:"cors-max-age-seconds"`
+	BearerSecret            string             `mapstructure:"bearer-secret"`
+	BearerJwksFile          string             `mapstructure:"bearer-jwks-file"`
+	BearerJwksUrl           string             `mapstructure:"bearer-jwks-url"`
+	BearerIssuer            string             `mapstructure:"bearer-issuer"`
+	BearerAudience          []string           `mapstructure:"bearer-audience"`
+	AuthorizationRule       AuthorizationRule  `mapstructure:"authorization-rule"`
+
+	// Tokens sealed with the retired keys are still accepted, so the CSRF private key can be rotated
+	CsrfEncryptorRetiredKeys []string `mapstructure:"csrf-encryptor-retired-keys"`
+}
+
+// AuthorizationRule allows when all of its conditions hold. Conditions with several values
+// hold when one of the values matches. 'all' and 'any' combine nested rules with AND and OR.
+type AuthorizationRule struct {
+	All          []AuthorizationRule
+	Any          []AuthorizationRule
+	EmailDomains []string `mapstructure:"email-domains"`
+	Emails       []string
+	Identifiers  []string
+	Groups       []string
+	Claims       []ValueMatch
 }
 
 type Router struct {
-	TargetUrl              string `mapstructure:"target-url"`
-	Type                   RouterType
-	Pattern                string
-	Filters                []Filter
-	CacheAdapterIdentifier string `mapstructure:"cache-adapter-identifier"`
-	SuccessLoginUrl        string `mapstructure:"success-login-url"`
-	AccessTokenRequestUrl  string `mapstructure:"access-toke-request-url"`
-	UserInfoRequestUrl     string `mapstructure:"user-info-request-url"`
+	TargetUrl               string             `mapstructure:"target-url"`
+	TargetUrls              []string           `mapstructure:"target-urls"`
+	LoadBalancing           LoadBalancingType  `mapstructure:"load-balancing"`
+	HealthCheck             HealthCheck        `mapstructure:"health-check"`
+	PassiveHealthCheck      PassiveHealthCheck `mapstructure:"passive-health-check"`
+	Transport               Transport
+	StripPrefix             string        `mapstructure:"strip-prefix"`
+	AddPrefix               string        `mapstructure:"add-prefix"`
+	RewriteRules            []RewriteRule `mapstructure:"rewrite-rules"`
+	Type                    RouterType
+	Pattern                 string
+	Hosts                   []string
+	Methods                 []string
+	Headers                 []ValueMatch
+	Query                   []ValueMatch
+	RequestHeaders          RequestHeaders `mapstructure:"request-headers"`
+	Filters                 []Filter
+	CacheAdapterIdentifier  string `mapstructure:"cache-adapter-identifier"`
+	SuccessLoginUrl         string `mapstructure:"success-login-url"`
+	AuthorizationRequestUrl string `mapstructure:"authorization-request-url"`
+	AccessTokenRequestUrl   string `mapstructure:"access-toke-request-url"`
+	UserInfoRequestUrl      string `mapstructure:"user-info-request-url"`
+	IssuerUrl               string `mapstructure:"issuer-url"`
+	ClientId                string `mapstructure:"client-id"`
+	ClientSecret            string `mapstructure:"client-secret"`
+	RedirectUrl             string `mapstructure:"redirect-url"`
+	Scopes                  []string
+	PostLogoutRedirectUrl   string `mapstructure:"post-logout-redirect-url"`
+	RevocationUrl           string `mapstructure:"revocation-url"`
+	EndSessionUrl           string `mapstructure:"end-session-url"`
+	CookieDomain            string `mapstructure:"cookie-domain"`
+	CookiePath              string `mapstructure:"cookie-path"`
+	CookieName              string `mapstructure:"cookie-name"`
+
+	// Streamed responses and protocol upgrades
+	FlushIntervalMilliseconds int `mapstructure:"flush-interval-milliseconds"`
+	UpgradeIdleTimeoutSeconds int `mapstructure:"upgrade-idle-timeout-seconds"`
+}
+
+// targetUrls joins single 'target-url' with the 'target-urls' list
+func (router *Router) targetUrls() []string {
+	if router.TargetUrl == "" {
+		return router.TargetUrls
+	}
+	return append([]string{router.TargetUrl}, router.TargetUrls...)
 }
 
 type LogLevel string
@@ -84,9 +289,16 @@ type GoogleSecret struct {
 	ClientSecret string `mapstructure:"client-secret"`
 }
 
+type Metrics struct {
+	Enabled bool
+	Port    int
+	Path    string
+}
+
 type ProxyConfiguration struct {
 	GoogleSecret  GoogleSecret `mapstructure:"google-secret"`
 	LogLevel      LogLevel     `mapstructure:"log-level"`
 	Routers       []Router
 	CacheAdapters []CacheAdapter `mapstructure:"cache-adapters"`
+	Metrics       Metrics
 }
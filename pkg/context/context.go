@@ -5,117 +5,469 @@ import (
 	"github.com/Alcereo/ordinator/pkg/auth"
 	"github.com/Alcereo/ordinator/pkg/cache"
 	"github.com/Alcereo/ordinator/pkg/common"
+	"github.com/Alcereo/ordinator/pkg/crypt"
 	"github.com/Alcereo/ordinator/pkg/filters"
+	"github.com/Alcereo/ordinator/pkg/jwks"
+	"github.com/Alcereo/ordinator/pkg/metrics"
 	"github.com/Alcereo/ordinator/pkg/proxy"
+	"github.com/Alcereo/ordinator/pkg/routing"
 	"github.com/Alcereo/ordinator/pkg/serializers"
 	uuid "github.com/satori/go.uuid"
 	log "github.com/sirupsen/logrus"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"net/url"
+	"time"
 )
 
 type context struct {
-	sessionCacheAdapters  map[string]filters.SessionCachePort
-	userAuthCacheAdapters map[string]auth.UserAuthCachePort
-	serverMultiplexer     *http.ServeMux
+	sessionCacheAdapters   map[string]filters.SessionCachePort
+	userAuthCacheAdapters  map[string]auth.UserAuthCachePort
+	rateLimitCacheAdapters map[string]filters.RateLimitCachePort
+	cacheAdapterConfigs    map[string]CacheAdapter
+	cacheAdapterClosers    map[string]io.Closer
+	userDataKeys           []jwks.JsonWebKey
+	userDataHeaders        []string
+	serverMultiplexer      *routing.Multiplexer
+	healthCheckers         []*proxy.HealthChecker
+	transports             []*http.Transport
+	keptTokens             map[string]auth.KeptTokens
+	// Configuration problems found by the builders, a context with errors isn't served
+	errors ConfigErrors
+	// Validation only, cache adapters aren't opened and health checks aren't started
+	dryRun bool
 }
 
 func NewContext() *context {
 	return &context{
-		sessionCacheAdapters:  make(map[string]filters.SessionCachePort),
-		userAuthCacheAdapters: make(map[string]auth.UserAuthCachePort),
-		serverMultiplexer:     http.NewServeMux(),
+		sessionCacheAdapters:   make(map[string]filters.SessionCachePort),
+		userAuthCacheAdapters:  make(map[string]auth.UserAuthCachePort),
+		rateLimitCacheAdapters: make(map[string]filters.RateLimitCachePort),
+		cacheAdapterConfigs:    make(map[string]CacheAdapter),
+		cacheAdapterClosers:    make(map[string]io.Closer),
+		userDataKeys:           make([]jwks.JsonWebKey, 0),
+		serverMultiplexer:      routing.NewMultiplexer(),
 	}
 }
 
-func (ctx *context) SetupCache(adapters []CacheAdapter) {
-	for _, adapter := range adapters {
+// build takes over the cache adapters of the previous context and collects all the configuration problems.
+// Routers and filters failing to build are left out, so a context with errors must not be served.
+func (ctx *context) build(previous *context, config *ProxyConfiguration) ConfigErrors {
+	ctx.validLogLevel(config.LogLevel)
+	ctx.setupCache(previous, config.CacheAdapters)
+	ctx.SetupRouters(config.Routers, config.GoogleSecret)
+	return ctx.errors
+}
+
+// failedSince tells whether any problem was found after the errors count mark
+func (ctx *context) failedSince(mark int) bool {
+	return len(ctx.errors) > mark
+}
+
+func (ctx *context) SetupCache(adapters []CacheAdapter) ConfigErrors {
+	ctx.setupCache(nil, adapters)
+	return ctx.errors
+}
+
+// setupCache takes the adapters keeping their entries in the same storage from the previous context instead of creating them
+func (ctx *context) setupCache(previous *context, adapters []CacheAdapter) {
+	for i, adapter := range adapters {
+		path := fmt.Sprintf("cache-adapters[%v]", i)
+		if !ctx.validCacheAdapter(path, adapter) || ctx.reuseCacheAdapter(previous, adapter) {
+			continue
+		}
+		ctx.cacheAdapterConfigs[adapter.Identifier] = adapter
+		if ctx.dryRun {
+			continue
+		}
 		switch adapter.Type {
 		case GoCache:
 			provider := cache.NewGoCacheSessionCacheProvider(
+				adapter.Identifier,
 				adapter.ExpirationTimeHours,
 				adapter.EvictScheduleTimeHours,
 			)
 			// GoCache can be both
 			ctx.sessionCacheAdapters[adapter.Identifier] = provider
 			ctx.userAuthCacheAdapters[adapter.Identifier] = provider
-		default:
-			panic(fmt.Errorf("Undefined session filter cache adapter type: %v.\n", adapter.Type))
+			ctx.rateLimitCacheAdapters[adapter.Identifier] = provider
+		case Redis:
+			log.Debugf("Adding Redis cache adapter. Identifier: %s; Address: %s", adapter.Identifier, adapter.RedisAddress)
+			provider := cache.NewRedisCacheAdapter(
+				adapter.Identifier,
+				adapter.RedisAddress,
+				adapter.RedisPassword,
+				adapter.RedisDatabase,
+				adapter.KeyPrefix,
+				adapter.ExpirationTimeHours,
+			)
+			ctx.sessionCacheAdapters[adapter.Identifier] = provider
+			ctx.userAuthCacheAdapters[adapter.Identifier] = provider
+			ctx.rateLimitCacheAdapters[adapter.Identifier] = provider
+			ctx.cacheAdapterClosers[adapter.Identifier] = provider
+		case File:
+			log.Debugf("Adding File cache adapter. Identifier: %s; Path: %s", adapter.Identifier, adapter.FilePath)
+			provider, err := cache.NewFileCacheAdapter(
+				adapter.Identifier,
+				adapter.FilePath,
+				adapter.ExpirationTimeHours,
+				adapter.EvictScheduleTimeHours,
+			)
+			if err != nil {
+				// The adapter stays configured, so its references aren't reported as missing too
+				ctx.fail(path+".file-path", "cache file opening error: %v", err)
+				continue
+			}
+			ctx.sessionCacheAdapters[adapter.Identifier] = provider
+			ctx.userAuthCacheAdapters[adapter.Identifier] = provider
+			ctx.rateLimitCacheAdapters[adapter.Identifier] = provider
+			ctx.cacheAdapterClosers[adapter.Identifier] = provider
+		case Session:
+			log.Debugf("Adding Session cache adapter. Identifier: %s", adapter.Identifier)
+			// User data only, sessions are kept by the Cookie session mode itself
+			ctx.userAuthCacheAdapters[adapter.Identifier] = cache.NewSessionStorageAdapter(adapter.Identifier)
 		}
 	}
 }
 
-func (ctx *context) SetupRouters(routers []Router, secret GoogleSecret) {
+// reuseCacheAdapter keeps sessions and user data of in-memory and file adapters across configuration reloads.
+// Other settings of a reused adapter, like expiration, take effect after restart.
+func (ctx *context) reuseCacheAdapter(previous *context, adapter CacheAdapter) bool {
+	if previous == nil {
+		return false
+	}
+	previousAdapter, found := previous.cacheAdapterConfigs[adapter.Identifier]
+	if !found {
+		return false
+	}
+	if !sameCacheStorage(previousAdapter, adapter) {
+		log.Warnf("Cache adapter '%v' storage changed. Adapter is created again.", adapter.Identifier)
+		return false
+	}
+	if previousAdapter != adapter {
+		log.Warnf("Cache adapter '%v' settings changed. Running adapter is kept, settings take effect after restart.", adapter.Identifier)
+	}
+	log.Debugf("Reusing cache adapter. Identifier: %s", adapter.Identifier)
+	// Running settings are kept, so the next reload compares with them
+	ctx.cacheAdapterConfigs[adapter.Identifier] = previousAdapter
+	if provider, found := previous.sessionCacheAdapters[adapter.Identifier]; found {
+		ctx.sessionCacheAdapters[adapter.Identifier] = provider
+	}
+	if provider, found := previous.userAuthCacheAdapters[adapter.Identifier]; found {
+		ctx.userAuthCacheAdapters[adapter.Identifier] = provider
+	}
+	if provider, found := previous.rateLimitCacheAdapters[adapter.Identifier]; found {
+		ctx.rateLimitCacheAdapters[adapter.Identifier] = provider
+	}
+	if closer, found := previous.cacheAdapterClosers[adapter.Identifier]; found {
+		ctx.cacheAdapterClosers[adapter.Identifier] = closer
+	}
+	return true
+}
+
+// sameCacheStorage tells whether the adapter keeps its entries where the previous one does.
+// File can't be opened twice, Redis and Session adapters keep nothing themselves and are cheap to create again.
+func sameCacheStorage(previous CacheAdapter, adapter CacheAdapter) bool {
+	if previous.Type != adapter.Type {
+		return false
+	}
+	switch adapter.Type {
+	case GoCache:
+		return true
+	case File:
+		return previous.FilePath == adapter.FilePath
+	default:
+		return previous == adapter
+	}
+}
+
+func (ctx *context) SetupRouters(routers []Router, secret GoogleSecret) ConfigErrors {
+	ctx.keptTokens = logoutKeptTokens(routers)
+	for i, router := range routers {
+		ctx.setupRouter(fmt.Sprintf("routers[%v]", i), router, secret)
+	}
+	return ctx.errors
+}
+
+// logoutKeptTokens are the provider tokens the logout routers use by user cache adapter,
+// login routers store only them, tokens nothing uses don't end up in caches and cookies
+func logoutKeptTokens(routers []Router) map[string]auth.KeptTokens {
+	keptTokens := make(map[string]auth.KeptTokens)
 	for _, router := range routers {
-		switch router.Type {
-		case ReverseProxy:
-			log.Debugf(
-				"Adding Reverse proxy router. Pattern: %s; Target: %s",
-				router.Pattern,
-				router.TargetUrl,
-			)
+		if router.Type != Logout {
+			continue
+		}
+		kept := keptTokens[router.CacheAdapterIdentifier]
+		kept.ForRevocation = kept.ForRevocation || router.RevocationUrl != ""
+		kept.ForEndSession = kept.ForEndSession || router.EndSessionUrl != ""
+		keptTokens[router.CacheAdapterIdentifier] = kept
+	}
+	return keptTokens
+}
 
-			targetUrl, _ := new(url.URL).Parse(router.TargetUrl)
-			handler := proxy.ReverseProxyHandler{
-				TargetAddress: *targetUrl,
-			}
+func (ctx *context) setupRouter(path string, router Router, secret GoogleSecret) {
+	var handler common.RequestHandler
+	mark := len(ctx.errors)
+	switch router.Type {
+	case ReverseProxy:
+		log.Debugf(
+			"Adding Reverse proxy router. Pattern: %s; Targets: %s; Load balancing: %s",
+			router.Pattern,
+			router.targetUrls(),
+			router.LoadBalancing,
+		)
+		balancer := ctx.buildLoadBalancer(path, &router)
+		rewriter := ctx.buildPathRewriter(path, &router)
+		if ctx.failedSince(mark) {
+			break
+		}
+		transport := proxy.NewTransport(proxy.TransportSettings{
+			DialTimeout:           time.Second * time.Duration(router.Transport.DialTimeoutSeconds),
+			TLSHandshakeTimeout:   time.Second * time.Duration(router.Transport.TLSHandshakeTimeoutSeconds),
+			ResponseHeaderTimeout: time.Second * time.Duration(router.Transport.ResponseHeaderTimeoutSeconds),
+			IdleConnTimeout:       time.Second * time.Duration(router.Transport.IdleConnTimeoutSeconds),
+			MaxIdleConnsPerHost:   router.Transport.MaxIdleConnsPerHost,
+		})
+		ctx.transports = append(ctx.transports, transport)
+		handler = proxy.NewReverseProxyHandler(
+			balancer,
+			ctx.buildHealthChecker(&router, balancer),
+			rewriter,
+			transport,
+			proxy.StreamingSettings{
+				FlushInterval:      time.Millisecond * time.Duration(router.FlushIntervalMilliseconds),
+				UpgradeIdleTimeout: time.Second * time.Duration(router.UpgradeIdleTimeoutSeconds),
+			},
+		)
+	case UpstreamHealthStatus:
+		log.Debugf(
+			"Adding upstream health status endpoint. Pattern: %s;",
+			router.Pattern,
+		)
+		handler = proxy.NewHealthStatusHandler(func() []*proxy.HealthChecker {
+			return ctx.healthCheckers
+		})
+	case UserDataJwks:
+		log.Debugf(
+			"Adding user data JWKS endpoint. Pattern: %s;",
+			router.Pattern,
+		)
+		handler = jwks.NewKeySetHandler(func() *jwks.JsonWebKeySet {
+			return &jwks.JsonWebKeySet{Keys: ctx.userDataKeys}
+		})
+	case GoogleOauth2Authorization:
+		log.Debugf(
+			"Adding Google Oauth2 authorization endpoint. Pattern: %s;",
+			router.Pattern,
+		)
+		ctx.validCacheAdapterReference(path+".cache-adapter-identifier", router.CacheAdapterIdentifier, "user")
+		ctx.required(path+".success-login-url", router.SuccessLoginUrl)
+		// Google endpoint is the default
+		if router.AuthorizationRequestUrl != "" {
+			ctx.parseUrl(path+".authorization-request-url", router.AuthorizationRequestUrl)
+		}
+		ctx.required(path+".access-toke-request-url", router.AccessTokenRequestUrl)
+		ctx.required(path+".user-info-request-url", router.UserInfoRequestUrl)
+		ctx.requiredEnv("GOOGLE_CLIENT_ID", secret.ClientId, path)
+		ctx.requiredEnv("GOOGLE_CLIENT_SECRET", secret.ClientSecret, path)
+		if ctx.failedSince(mark) {
+			break
+		}
+		handler = auth.NewGoogleOAuth2Provider(
+			ctx.userAuthCacheAdapters[router.CacheAdapterIdentifier],
+			router.SuccessLoginUrl,
+			secret.ClientId,
+			secret.ClientSecret,
+			router.AuthorizationRequestUrl,
+			router.AccessTokenRequestUrl,
+			router.UserInfoRequestUrl,
+			router.RedirectUrl,
+			router.Scopes,
+			ctx.keptTokens[router.CacheAdapterIdentifier],
+		)
+	case OidcAuthorization:
+		log.Debugf(
+			"Adding OpenID Connect authorization endpoint. Pattern: %s; Issuer: %s",
+			router.Pattern,
+			router.IssuerUrl,
+		)
+		ctx.validCacheAdapterReference(path+".cache-adapter-identifier", router.CacheAdapterIdentifier, "user")
+		ctx.required(path+".success-login-url", router.SuccessLoginUrl)
+		ctx.parseUrl(path+".issuer-url", router.IssuerUrl)
+		ctx.required(path+".client-id", router.ClientId)
+		ctx.required(path+".client-secret", router.ClientSecret)
+		ctx.parseUrl(path+".redirect-url", router.RedirectUrl)
+		if ctx.failedSince(mark) {
+			break
+		}
+		handler = auth.NewOidcProvider(
+			ctx.userAuthCacheAdapters[router.CacheAdapterIdentifier],
+			router.SuccessLoginUrl,
+			router.IssuerUrl,
+			router.ClientId,
+			router.ClientSecret,
+			router.RedirectUrl,
+			router.Scopes,
+			ctx.keptTokens[router.CacheAdapterIdentifier],
+		)
+	case Logout:
+		log.Debugf(
+			"Adding logout endpoint. Pattern: %s;",
+			router.Pattern,
+		)
+		ctx.validCacheAdapterReference(path+".cache-adapter-identifier", router.CacheAdapterIdentifier, "user")
+		if router.EndSessionUrl != "" {
+			ctx.parseUrl(path+".end-session-url", router.EndSessionUrl)
+			// Sent to the provider, which accepts absolute registered urls only
+			ctx.parseUrl(path+".post-logout-redirect-url", router.PostLogoutRedirectUrl)
+		} else {
+			ctx.required(path+".post-logout-redirect-url", router.PostLogoutRedirectUrl)
+		}
+		ctx.required(path+".cookie-name", router.CookieName)
+		if ctx.failedSince(mark) {
+			break
+		}
+		var sessionCacheAdapter auth.SessionRemovalPort
+		if adapter, found := ctx.sessionCacheAdapters[router.CacheAdapterIdentifier]; found {
+			sessionCacheAdapter = adapter
+		}
+		clientId, clientSecret := router.ClientId, router.ClientSecret
+		if clientId == "" {
+			clientId, clientSecret = secret.ClientId, secret.ClientSecret
+		}
+		handler = auth.NewLogoutHandler(
+			ctx.userAuthCacheAdapters[router.CacheAdapterIdentifier],
+			sessionCacheAdapter,
+			router.PostLogoutRedirectUrl,
+			router.CookieName,
+			router.CookiePath,
+			router.CookieDomain,
+			router.RevocationUrl,
+			router.EndSessionUrl,
+			clientId,
+			clientSecret,
+		)
+	default:
+		ctx.fail(path+".type", "undefined router type '%v'", router.Type)
+	}
+	// Router failing to build is still registered, so its pattern and filters are checked too
+	ctx.handleRouter(path, router, handler)
+}
 
-			rootFilterHandler := ctx.BuildFilterHandlers(router.Filters, &handler)
-			ctx.serverMultiplexer.HandleFunc(router.Pattern, func(writer http.ResponseWriter, request *http.Request) {
-				rootFilterHandler.Handle(
-					log.WithField("requestId", uuid.NewV4()),
-					writer,
-					request,
-				)
-			})
-		case GoogleOauth2Authorization:
-			log.Debugf(
-				"Adding Google Oauth2 authorization endpoint. Pattern: %s;",
-				router.Pattern,
-			)
-			cacheAdapter := ctx.userAuthCacheAdapters[router.CacheAdapterIdentifier]
-			if cacheAdapter == nil {
-				panic(fmt.Errorf("User cache adapter with identifier '%v' not found.\n", router.CacheAdapterIdentifier))
-			}
-			handler := auth.NewGoogleOAuth2Provider(
-				cacheAdapter,
-				router.SuccessLoginUrl,
-				secret.ClientId,
-				secret.ClientSecret,
-				router.AccessTokenRequestUrl,
-				router.UserInfoRequestUrl,
+func (ctx *context) handleRouter(path string, router Router, mainHandler common.RequestHandler) {
+	for i, header := range router.RequestHeaders.Set {
+		ctx.required(fmt.Sprintf("%v.request-headers.set[%v].name", path, i), header.Name)
+	}
+	rootFilterHandler := filters.NewRequestHeadersSanitizer(
+		router.RequestHeaders.Remove,
+		func() []string {
+			return ctx.userDataHeaders
+		},
+		toHeader(router.RequestHeaders.Set),
+		ctx.BuildFilterHandlers(path, router.Filters, mainHandler),
+	)
+	err := ctx.serverMultiplexer.Handle(routing.Route{
+		Pattern: router.Pattern,
+		Hosts:   router.Hosts,
+		Methods: routeMethods(router),
+		Headers: toRoutingMatches(router.Headers),
+		Query:   toRoutingMatches(router.Query),
+		Handler: metrics.InstrumentRouter(router.Pattern, router.Hosts, func(writer http.ResponseWriter, request *http.Request) {
+			rootFilterHandler.Handle(
+				log.WithField("requestId", uuid.NewV4()),
+				writer,
+				request,
 			)
+		}),
+	})
+	if err != nil {
+		ctx.fail(path+".pattern", "%v", err)
+	}
+}
 
-			rootFilterHandler := ctx.BuildFilterHandlers(router.Filters, handler)
-			ctx.serverMultiplexer.HandleFunc(router.Pattern, func(writer http.ResponseWriter, request *http.Request) {
-				rootFilterHandler.Handle(
-					log.WithField("requestId", uuid.NewV4()),
-					writer,
-					request,
-				)
-			})
-		default:
-			panic(fmt.Errorf("Undefined router type: %v.\n", router.Type))
+// routeMethods lets preflight requests reach the cors filter of method restricted routes
+func routeMethods(router Router) []string {
+	if len(router.Methods) == 0 || !hasFilter(router.Filters, CorsFilter) {
+		return router.Methods
+	}
+	if containsString(router.Methods, http.MethodOptions) {
+		return router.Methods
+	}
+	return append(append([]string(nil), router.Methods...), http.MethodOptions)
+}
+
+func hasFilter(filters []Filter, filterType FilterType) bool {
+	for _, filter := range filters {
+		if filter.Type == filterType {
+			return true
 		}
 	}
+	return false
 }
 
-func (ctx *context) BuildFilterHandlers(filters []Filter, mainHandler common.RequestHandler) (rootHandler common.RequestHandler) {
-	if filters == nil {
-		return mainHandler
+func containsString(values []string, expected string) bool {
+	for _, value := range values {
+		if value == expected {
+			return true
+		}
 	}
+	return false
+}
 
-	currentHandler := mainHandler
+// corsFiltersFirst orders the filter indexes keeping the configured order of the rest filters
+func corsFiltersFirst(filters []Filter) []int {
+	ordered := make([]int, 0, len(filters))
+	for i, filter := range filters {
+		if filter.Type == CorsFilter {
+			ordered = append(ordered, i)
+		}
+	}
+	for i, filter := range filters {
+		if filter.Type != CorsFilter {
+			ordered = append(ordered, i)
+		}
+	}
+	return ordered
+}
+
+func toHeader(values []HeaderValue) http.Header {
+	header := http.Header{}
+	for _, value := range values {
+		header.Set(value.Name, value.Value)
+	}
+	return header
+}
+
+func toRoutingMatches(matches []ValueMatch) []routing.ValueMatch {
+	var routingMatches []routing.ValueMatch
+	for _, match := range matches {
+		routingMatches = append(routingMatches, routing.ValueMatch{
+			Name:  match.Name,
+			Value: match.Value,
+		})
+	}
+	return routingMatches
+}
 
-	for i := len(filters) - 1; i >= 0; i-- {
-		filter := filters[i]
+func (ctx *context) BuildFilterHandlers(path string, filters []Filter, mainHandler common.RequestHandler) (rootHandler common.RequestHandler) {
+	// Built in the configured order, so the problems are reported in it
+	handlers := make([]common.RequestChainedHandler, len(filters))
+	for i, filter := range filters {
+		handlers[i] = ctx.BuildFilterHandler(fmt.Sprintf("%v.filters[%v]", path, i), filter)
+	}
+
+	order := corsFiltersFirst(filters)
+	currentHandler := mainHandler
 
-		handler := ctx.BuildFilterHandler(filter)
+	for i := len(order) - 1; i >= 0; i-- {
+		handler := handlers[order[i]]
 
 		if handler == nil {
 			continue
 		}
 
+		handler = metrics.InstrumentFilter(filters[order[i]].Name, handler)
 		handler.SetNext(currentHandler)
 		currentHandler = handler
 	}
@@ -123,21 +475,35 @@ func (ctx *context) BuildFilterHandlers(filters []Filter, mainHandler common.Req
 	return currentHandler
 }
 
-func (ctx *context) BuildFilterHandler(filter Filter) common.RequestChainedHandler {
+// BuildFilterHandler returns nil when the filter fails to build, the problems are kept with the path
+func (ctx *context) BuildFilterHandler(path string, filter Filter) common.RequestChainedHandler {
+	mark := len(ctx.errors)
 	switch filter.Type {
 	case LogFilter:
 		log.Debugf("Adding Log filter. Name: %s", filter.Name)
-		return filters.CreateLogFilter(filter.Name, filter.Template, nil)
+		logFilter, err := filters.CreateLogFilter(filter.Name, filter.Template, nil)
+		if err != nil {
+			ctx.fail(path+".template", "%v", err)
+			return nil
+		}
+		return logFilter
 	case SessionFilter:
 		log.Debugf("Adding session filter. Name: %s", filter.Name)
-		cacheAdapter := ctx.sessionCacheAdapters[filter.CacheAdapterIdentifier]
-		if cacheAdapter == nil {
-			panic(fmt.Errorf("Session cache adapter with identifier '%v' not found.\n", filter.CacheAdapterIdentifier))
+		switch filter.SessionMode {
+		case CookieSessionMode:
+			return ctx.buildSealedSessionFilter(path, &filter)
+		case "", CacheSessionMode:
+		default:
+			ctx.fail(path+".session-mode", "undefined session mode '%v'", filter.SessionMode)
+			return nil
+		}
+		if !ctx.validCacheAdapterReference(path+".cache-adapter-identifier", filter.CacheAdapterIdentifier, "session") {
+			return nil
 		}
 		return filters.CreateSessionFilter(
 			filter.Name,
 			filter.CookieName,
-			cacheAdapter,
+			ctx.sessionCacheAdapters[filter.CacheAdapterIdentifier],
 			filter.CookieTTLHours,
 			filter.CookieRenewBeforeHours,
 			filter.CookiePath,
@@ -145,50 +511,452 @@ func (ctx *context) BuildFilterHandler(filter Filter) common.RequestChainedHandl
 		)
 	case UserAuthenticationFilter:
 		log.Debugf("Adding user authentication filter. Name: %s", filter.Name)
-		cacheAdapter := ctx.userAuthCacheAdapters[filter.CacheAdapterIdentifier]
-		if cacheAdapter == nil {
-			panic(fmt.Errorf("User cache adapter with identifier '%v' not found.\n", filter.CacheAdapterIdentifier))
+		if !ctx.validCacheAdapterReference(path+".cache-adapter-identifier", filter.CacheAdapterIdentifier, "user") {
+			return nil
 		}
 		return auth.NewUserAuthenticationFilter(
-			cacheAdapter,
+			ctx.userAuthCacheAdapters[filter.CacheAdapterIdentifier],
 			filter.Name,
 			filter.UserDataRequired,
 			filter.RedirectPage,
 		)
 	case UserDataSenderFilter:
 		log.Debugf("Adding user data sending filter. Name: %s", filter.Name)
-		cacheAdapter := ctx.userAuthCacheAdapters[filter.CacheAdapterIdentifier]
-		if cacheAdapter == nil {
-			panic(fmt.Errorf("User cache adapter with identifier '%v' not found.\n", filter.CacheAdapterIdentifier))
+		ctx.validCacheAdapterReference(path+".cache-adapter-identifier", filter.CacheAdapterIdentifier, "user")
+		serializer := ctx.buildUserDataSerializer(path, &filter)
+		if ctx.failedSince(mark) {
+			return nil
 		}
-		serializer := buildUserDataSerializer(&filter)
+		ctx.protectUserDataHeaders(serializer.HeaderNames())
 		return auth.NewUserDataSenderFilter(
-			cacheAdapter,
+			ctx.userAuthCacheAdapters[filter.CacheAdapterIdentifier],
 			filter.Name,
 			serializer,
-			filter.UserDataHeader,
 		)
 	case CsrfFilter:
 		log.Debugf("Adding csrf filter. Name: %s", filter.Name)
-		return filters.NewCsrfFilter(
+		return ctx.buildCsrfFilter(path, &filter)
+	case RateLimitFilter:
+		log.Debugf("Adding rate limit filter. Name: %s", filter.Name)
+		ctx.validCacheAdapterReference(path+".cache-adapter-identifier", filter.CacheAdapterIdentifier, "rate limit")
+		if filter.RateLimitRate <= 0 {
+			ctx.fail(path+".rate-limit-rate", "rate must be positive: %v", filter.RateLimitRate)
+		}
+		key := ctx.buildRateLimitKey(path, &filter)
+		if ctx.failedSince(mark) {
+			return nil
+		}
+		return filters.CreateRateLimitFilter(
+			filter.Name,
+			ctx.rateLimitCacheAdapters[filter.CacheAdapterIdentifier],
+			key,
+			filter.RateLimitRate,
+			filter.RateLimitBurst,
+			filter.TrustForwardedFor,
+		)
+	case CorsFilter:
+		log.Debugf("Adding cors filter. Name: %s", filter.Name)
+		if len(filter.CorsAllowedOrigins) == 0 {
+			ctx.fail(path+".cors-allowed-origins", "allowed origins are required")
+		}
+		if filter.CorsAllowCredentials && containsString(filter.CorsAllowedOrigins, "*") {
+			ctx.fail(path+".cors-allow-credentials", "credentials can't be allowed for any origin")
+		}
+		if ctx.failedSince(mark) {
+			return nil
+		}
+		return filters.NewCorsFilter(
+			filter.Name,
+			filter.CorsAllowedOrigins,
+			filter.CorsAllowedMethods,
+			filter.CorsAllowedHeaders,
+			filter.CorsExposedHeaders,
+			filter.CorsAllowCredentials,
+			filter.CorsMaxAgeSeconds,
+		)
+	case BearerAuthenticationFilter:
+		log.Debugf("Adding bearer authentication filter. Name: %s", filter.Name)
+		verifier := ctx.buildBearerVerifier(path, &filter)
+		if verifier == nil {
+			return nil
+		}
+		return auth.NewBearerAuthenticationFilter(
+			filter.Name,
+			verifier,
+			filter.UserDataRequired,
+		)
+	case AuthorizationFilter:
+		log.Debugf("Adding authorization filter. Name: %s", filter.Name)
+		rule := ctx.buildAuthorizationRule(path+".authorization-rule", filter.AuthorizationRule)
+		if rule == nil {
+			return nil
+		}
+		return auth.NewAuthorizationFilter(
 			filter.Name,
-			filter.CsrfHeader,
-			filter.CsrfSafeMethods,
-			filter.CsrfEncryptorPrivateKey,
+			rule,
+			filter.RedirectPage,
 		)
 	default:
-		panic(fmt.Errorf("Undefined filter type: %v.\n", filter.Type))
+		ctx.fail(path+".type", "undefined filter type '%v'", filter.Type)
+		return nil
+	}
+}
+
+func (ctx *context) buildAuthorizationRule(path string, rule AuthorizationRule) auth.AuthorizationRule {
+	mark := len(ctx.errors)
+	var conditions auth.AllRule
+	if len(rule.All) > 0 {
+		var allRule auth.AllRule
+		for i, nested := range rule.All {
+			allRule = append(allRule, ctx.buildAuthorizationRule(fmt.Sprintf("%v.all[%v]", path, i), nested))
+		}
+		conditions = append(conditions, allRule)
+	}
+	if len(rule.Any) > 0 {
+		var anyRule auth.AnyRule
+		for i, nested := range rule.Any {
+			anyRule = append(anyRule, ctx.buildAuthorizationRule(fmt.Sprintf("%v.any[%v]", path, i), nested))
+		}
+		conditions = append(conditions, anyRule)
+	}
+	if len(rule.EmailDomains) > 0 {
+		conditions = append(conditions, auth.EmailDomainRule(rule.EmailDomains))
+	}
+	if len(rule.Emails) > 0 {
+		conditions = append(conditions, auth.EmailRule(rule.Emails))
+	}
+	if len(rule.Identifiers) > 0 {
+		conditions = append(conditions, auth.IdentifierRule(rule.Identifiers))
+	}
+	if len(rule.Groups) > 0 {
+		conditions = append(conditions, auth.GroupRule(rule.Groups))
+	}
+	for i, claim := range rule.Claims {
+		ctx.required(fmt.Sprintf("%v.claims[%v].name", path, i), claim.Name)
+		conditions = append(conditions, auth.ClaimRule{Name: claim.Name, Value: claim.Value})
+	}
+	if len(conditions) == 0 {
+		ctx.fail(path, "authorization rule without conditions")
+	}
+	if ctx.failedSince(mark) {
+		return nil
+	}
+	if len(conditions) == 1 {
+		return conditions[0]
+	}
+	return conditions
+}
+
+func (ctx *context) buildBearerVerifier(path string, filter *Filter) *auth.BearerVerifier {
+	sources := 0
+	for _, source := range []string{filter.BearerSecret, filter.BearerJwksFile, filter.BearerJwksUrl} {
+		if source != "" {
+			sources++
+		}
+	}
+	if sources != 1 {
+		ctx.fail(path, "exactly one of bearer-secret, bearer-jwks-file or bearer-jwks-url is required")
+		return nil
+	}
+	if filter.BearerSecret != "" {
+		return auth.NewHmacBearerVerifier(filter.BearerSecret, filter.BearerIssuer, filter.BearerAudience)
+	}
+	// Keys of a JWKS, like the Google ones, sign tokens of other clients and tenants too
+	mark := len(ctx.errors)
+	ctx.required(path+".bearer-issuer", filter.BearerIssuer)
+	if len(filter.BearerAudience) == 0 {
+		ctx.fail(path+".bearer-audience", "audience is required for the JWKS keys")
+	}
+	for i, audience := range filter.BearerAudience {
+		ctx.required(fmt.Sprintf("%v.bearer-audience[%v]", path, i), audience)
+	}
+	var keySource jwks.KeySource
+	if filter.BearerJwksFile != "" {
+		fileKeySource, err := jwks.NewFileKeySource(filter.BearerJwksFile)
+		if err != nil {
+			ctx.fail(path+".bearer-jwks-file", "%v", err)
+		}
+		keySource = fileKeySource
+	} else if ctx.parseUrl(path+".bearer-jwks-url", filter.BearerJwksUrl) != nil {
+		keySource = jwks.NewRemoteKeySource(filter.BearerJwksUrl, auth.JwksRefreshInterval)
+	}
+	if ctx.failedSince(mark) {
+		return nil
+	}
+	return auth.NewJwksBearerVerifier(keySource, filter.BearerIssuer, filter.BearerAudience)
+}
+
+func (ctx *context) buildRateLimitKey(path string, filter *Filter) filters.RateLimitKeyFunc {
+	switch filter.RateLimitKey {
+	case ClientIpRateLimitKey, "":
+		return filters.ClientIpRateLimitKey(filter.TrustForwardedFor)
+	case SessionRateLimitKey:
+		return filters.SessionRateLimitKey
+	case UserRateLimitKey:
+		return filters.UserRateLimitKey
+	default:
+		ctx.fail(path+".rate-limit-key", "undefined rate limit key '%v'", filter.RateLimitKey)
+		return nil
+	}
+}
+
+// buildCsrfFilter checks the settings the filter constructor requires of the mode
+func (ctx *context) buildCsrfFilter(path string, filter *Filter) common.RequestChainedHandler {
+	mark := len(ctx.errors)
+	ctx.required(path+".name", filter.Name)
+	scope := ctx.buildCsrfTokenScope(path, filter)
+	mode := ctx.buildCsrfMode(path, filter)
+	if ctx.failedSince(mark) {
+		return nil
+	}
+	csrfFilter, err := filters.NewCsrfFilter(filter.Name, filters.CsrfSettings{
+		Mode:                 mode,
+		HeaderName:           filter.CsrfHeader,
+		FormField:            filter.CsrfFormField,
+		SafeMethods:          filter.CsrfSafeMethods,
+		EncryptorPrivateKey:  filter.CsrfEncryptorPrivateKey,
+		EncryptorRetiredKeys: filter.CsrfEncryptorRetiredKeys,
+		TokenMaxAge:          time.Duration(filter.CsrfTokenMaxAgeSeconds) * time.Second,
+		TokenScope:           scope,
+		CookieName:           filter.CookieName,
+		CookiePath:           filter.CookiePath,
+		CookieDomain:         filter.CookieDomain,
+		AllowedOrigins:       filter.CsrfAllowedOrigins,
+	})
+	if err != nil {
+		ctx.fail(path, "%v", err)
+		return nil
+	}
+	return csrfFilter
+}
+
+func (ctx *context) buildCsrfMode(path string, filter *Filter) filters.CsrfMode {
+	switch filter.CsrfMode {
+	case "", HeaderCsrfMode:
+		return filters.HeaderCsrfMode
+	case DoubleSubmitCookieCsrfMode:
+		return filters.DoubleSubmitCookieCsrfMode
+	case OriginCsrfMode:
+		return filters.OriginCsrfMode
+	default:
+		ctx.fail(path+".csrf-mode", "undefined CSRF mode '%v'", filter.CsrfMode)
+		return ""
+	}
+}
+
+func (ctx *context) buildCsrfTokenScope(path string, filter *Filter) filters.CsrfTokenScope {
+	switch filter.CsrfTokenScope {
+	case "", SessionCsrfTokenScope:
+		return filters.SessionCsrfTokenScope
+	case PathCsrfTokenScope:
+		return filters.PathCsrfTokenScope
+	default:
+		ctx.fail(path+".csrf-token-scope", "undefined CSRF token scope '%v'", filter.CsrfTokenScope)
+		return ""
+	}
+}
+
+func (ctx *context) buildSealedSessionFilter(path string, filter *Filter) common.RequestChainedHandler {
+	if len(filter.SessionKeys) == 0 {
+		ctx.fail(path+".session-keys", "session keys are required for the '%v' session mode", CookieSessionMode)
+		return nil
+	}
+	keyring, err := crypt.NewKeyring(filter.SessionKeys[0], filter.SessionKeys[1:]...)
+	if err != nil {
+		ctx.fail(path+".session-keys", "%v", err)
+		return nil
+	}
+	return filters.CreateSealedSessionFilter(
+		filter.Name,
+		filter.CookieName,
+		keyring,
+		filter.CookieTTLHours,
+		filter.CookieRenewBeforeHours,
+		filter.CookiePath,
+		filter.CookieDomain,
+		filter.SessionCookieMaxBytes,
+	)
+}
+
+func (ctx *context) buildLoadBalancer(path string, router *Router) proxy.LoadBalancer {
+	mark := len(ctx.errors)
+	var targets []url.URL
+	if router.TargetUrl != "" {
+		if target := ctx.parseUrl(path+".target-url", router.TargetUrl); target != nil {
+			targets = append(targets, *target)
+		}
+	}
+	for i, targetUrl := range router.TargetUrls {
+		if target := ctx.parseUrl(fmt.Sprintf("%v.target-urls[%v]", path, i), targetUrl); target != nil {
+			targets = append(targets, *target)
+		}
+	}
+	if len(router.targetUrls()) == 0 {
+		ctx.fail(path+".target-url", "target url is required for the reverse proxy router")
+	}
+	switch router.LoadBalancing {
+	case RoundRobin, "", LeastConnections, ConsistentHash:
+	default:
+		ctx.fail(path+".load-balancing", "undefined load balancing type '%v'", router.LoadBalancing)
 	}
+	if ctx.failedSince(mark) {
+		return nil
+	}
+
+	switch router.LoadBalancing {
+	case LeastConnections:
+		return proxy.NewLeastConnectionsBalancer(targets)
+	case ConsistentHash:
+		return proxy.NewConsistentHashBalancer(targets)
+	default:
+		return proxy.NewRoundRobinBalancer(targets)
+	}
+}
+
+func (ctx *context) buildHealthChecker(router *Router, balancer proxy.LoadBalancer) *proxy.HealthChecker {
+	var active *proxy.ActiveHealthCheck
+	if router.HealthCheck.Path != "" {
+		active = &proxy.ActiveHealthCheck{
+			Path:               router.HealthCheck.Path,
+			Interval:           time.Second * time.Duration(router.HealthCheck.IntervalSeconds),
+			Timeout:            time.Second * time.Duration(router.HealthCheck.TimeoutSeconds),
+			HealthyThreshold:   router.HealthCheck.HealthyThreshold,
+			UnhealthyThreshold: router.HealthCheck.UnhealthyThreshold,
+		}
+	}
+	var passive *proxy.PassiveHealthCheck
+	if router.PassiveHealthCheck.ConsecutiveFailures > 0 {
+		passive = &proxy.PassiveHealthCheck{
+			ConsecutiveFailures: router.PassiveHealthCheck.ConsecutiveFailures,
+			Ejection:            time.Second * time.Duration(router.PassiveHealthCheck.EjectionSeconds),
+		}
+	}
+	if (active == nil && passive == nil) || ctx.dryRun {
+		return nil
+	}
+	checker := proxy.NewHealthChecker(router.Pattern, balancer, active, passive)
+	ctx.healthCheckers = append(ctx.healthCheckers, checker)
+	return checker
+}
+
+func (ctx *context) buildPathRewriter(path string, router *Router) *proxy.PathRewriter {
+	if router.StripPrefix == "" && router.AddPrefix == "" && len(router.RewriteRules) == 0 {
+		return nil
+	}
+	rewriter := &proxy.PathRewriter{
+		StripPrefix: router.StripPrefix,
+		AddPrefix:   router.AddPrefix,
+	}
+	for i, rule := range router.RewriteRules {
+		compiled, err := proxy.NewRewriteRule(rule.Pattern, rule.Replacement)
+		if err != nil {
+			ctx.fail(fmt.Sprintf("%v.rewrite-rules[%v].pattern", path, i), "%v", err)
+			continue
+		}
+		rewriter.Rules = append(rewriter.Rules, compiled)
+	}
+	return rewriter
 }
 
-func buildUserDataSerializer(filter *Filter) auth.UserDataSerializer {
-	switch filter.UserDataTypeSerializer.Type {
+func (ctx *context) buildUserDataSerializer(path string, filter *Filter) auth.UserDataHeadersSerializer {
+	config := filter.UserDataTypeSerializer
+	switch config.Type {
 	case JwtUserDataSerializer:
-		return serializers.NewJwtUserDataSerializer(
-			filter.UserDataTypeSerializer.Secret,
-		)
+		validHeader := ctx.required(path+".user-data-header", filter.UserDataHeader)
+		signer := ctx.buildJwtSigner(path+".user-data-serializer", &config)
+		if !validHeader || signer == nil {
+			return nil
+		}
+		if signer.Asymmetric() && !ctx.publishUserDataKey(path+".user-data-serializer", signer) {
+			return nil
+		}
+		return auth.SingleHeader(filter.UserDataHeader, serializers.NewJwtUserDataSerializer(signer, serializers.JwtClaimsSettings{
+			Issuer:   config.Issuer,
+			Audience: config.Audience,
+			Lifetime: time.Second * time.Duration(config.LifetimeSeconds),
+		}))
+	case HeaderUserDataSerializer:
+		serializer, err := serializers.NewHeaderUserDataSerializer(config.Headers)
+		if err != nil {
+			ctx.fail(path+".user-data-serializer.headers", "%v", err)
+			return nil
+		}
+		return serializer
 	default:
-		panic(fmt.Errorf("Undefined user data serializer type: %v.\n", filter.UserDataTypeSerializer.Type))
+		ctx.fail(path+".user-data-serializer.type", "undefined user data serializer type '%v'", config.Type)
+		return nil
+	}
+}
+
+func (ctx *context) buildJwtSigner(path string, config *UserDataSerializer) *serializers.JwtSigner {
+	if config.Algorithm == "" || config.Algorithm == "HS256" {
+		if !ctx.required(path+".secret", config.Secret) {
+			return nil
+		}
+		return serializers.NewHmacSigner(config.Secret, config.KeyId)
+	}
+	if !ctx.required(path+".private-key-file", config.PrivateKeyFile) {
+		return nil
+	}
+	pemData, err := ioutil.ReadFile(config.PrivateKeyFile)
+	if err != nil {
+		ctx.fail(path+".private-key-file", "%v", err)
+		return nil
+	}
+	signer, err := serializers.NewPemSigner(config.Algorithm, pemData, config.KeyId)
+	if err != nil {
+		ctx.fail(path+".algorithm", "%v", err)
+		return nil
+	}
+	return signer
+}
+
+// protectUserDataHeaders makes routes remove the headers from client requests, so backends
+// can trust them on any route, not only on the routes with the user data sender filter
+func (ctx *context) protectUserDataHeaders(headers []string) {
+	for _, header := range headers {
+		if !containsString(ctx.userDataHeaders, http.CanonicalHeaderKey(header)) {
+			ctx.userDataHeaders = append(ctx.userDataHeaders, http.CanonicalHeaderKey(header))
+		}
+	}
+}
+
+// publishUserDataKey skips keys already published by other filters sharing the key
+func (ctx *context) publishUserDataKey(path string, signer *serializers.JwtSigner) bool {
+	key, err := signer.PublicKey()
+	if err != nil {
+		ctx.fail(path+".private-key-file", "public key error: %v", err)
+		return false
+	}
+	for _, published := range ctx.userDataKeys {
+		if published.KeyId == key.KeyId {
+			return true
+		}
+	}
+	ctx.userDataKeys = append(ctx.userDataKeys, *key)
+	return true
+}
+
+// Close stops the health checkers, drops idle upstream connections and releases the cache adapters
+func (ctx *context) Close() {
+	ctx.closeExcept(nil)
+}
+
+// closeExcept keeps the cache adapters the other context took over
+func (ctx *context) closeExcept(other *context) {
+	for _, checker := range ctx.healthCheckers {
+		checker.Close()
+	}
+	for _, transport := range ctx.transports {
+		transport.CloseIdleConnections()
+	}
+	for identifier, closer := range ctx.cacheAdapterClosers {
+		if other != nil && other.cacheAdapterClosers[identifier] == closer {
+			continue
+		}
+		if err := closer.Close(); err != nil {
+			log.Warnf("Closing cache adapter '%v' error: %v", identifier, err)
+		}
 	}
 }
 
@@ -198,3 +966,21 @@ func (ctx *context) BuildServer(port int) *http.Server {
 		Handler: ctx.serverMultiplexer,
 	}
 }
+
+func (ctx *context) BuildMetricsServer(config Metrics) *http.Server {
+	return BuildMetricsServer(config)
+}
+
+// BuildMetricsServer serves metrics of all the configurations, it isn't reloaded with them
+func BuildMetricsServer(config Metrics) *http.Server {
+	path := config.Path
+	if path == "" {
+		path = "/metrics"
+	}
+	multiplexer := http.NewServeMux()
+	multiplexer.Handle(path, metrics.Handler())
+	return &http.Server{
+		Addr:    fmt.Sprintf(":%v", config.Port),
+		Handler: multiplexer,
+	}
+}
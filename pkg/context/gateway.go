@@ -0,0 +1,83 @@
+package context
+
+import (
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// Gateway serves the routers of the last applied configuration. Each configuration is built
+// into its own context, which is swapped in atomically: requests in flight finish on the old one.
+type Gateway struct {
+	mutex  sync.Mutex
+	active atomic.Value
+}
+
+func NewGateway() *Gateway {
+	return &Gateway{}
+}
+
+// Apply builds the configuration next to the running one and starts serving it. Cache adapters
+// keeping the same storage are taken over by the new configuration. A configuration failing to build
+// is rejected with ConfigErrors, the running one keeps serving.
+func (gateway *Gateway) Apply(config *ProxyConfiguration) (err error) {
+	// Checked first, so an invalid configuration doesn't open cache adapters and start health checks
+	if errors := Validate(config); len(errors) > 0 {
+		return errors
+	}
+	gateway.mutex.Lock()
+	defer gateway.mutex.Unlock()
+
+	previous := gateway.current()
+	next := NewContext()
+	defer func() {
+		// Builders check the settings the constructors require, a panic is a missed check
+		if reason := recover(); reason != nil {
+			next.closeExcept(previous)
+			err = fmt.Errorf("configuration rejected: %v", reason)
+		}
+	}()
+	if errors := next.build(previous, config); len(errors) > 0 {
+		next.closeExcept(previous)
+		return errors
+	}
+
+	gateway.active.Store(next)
+	if previous != nil {
+		log.Infof("Configuration reloaded")
+		previous.closeExcept(next)
+	}
+	return nil
+}
+
+// Close releases the running configuration
+func (gateway *Gateway) Close() {
+	gateway.mutex.Lock()
+	defer gateway.mutex.Unlock()
+	if current := gateway.current(); current != nil {
+		current.Close()
+	}
+}
+
+func (gateway *Gateway) current() *context {
+	current, _ := gateway.active.Load().(*context)
+	return current
+}
+
+func (gateway *Gateway) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	current := gateway.current()
+	if current == nil {
+		writer.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	current.serverMultiplexer.ServeHTTP(writer, request)
+}
+
+func (gateway *Gateway) BuildServer(port int) *http.Server {
+	return &http.Server{
+		Addr:    fmt.Sprintf(":%v", port),
+		Handler: gateway,
+	}
+}
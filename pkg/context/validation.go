@@ -0,0 +1,130 @@
+package context
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ConfigError is a configuration problem with its path in the YAML, like 'routers[2].filters[1].type',
+// or with the environment variable, like '$GOOGLE_CLIENT_ID', for the settings taken from the environment
+type ConfigError struct {
+	Path    string
+	Message string
+}
+
+func (err ConfigError) Error() string {
+	return err.Path + ": " + err.Message
+}
+
+// ConfigErrors are all the problems of a configuration, one per line
+type ConfigErrors []ConfigError
+
+func (errors ConfigErrors) Error() string {
+	lines := make([]string, 0, len(errors))
+	for _, err := range errors {
+		lines = append(lines, err.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Validate builds the whole configuration without opening cache adapters and starting health checks,
+// and collects all the problems, so a bad configuration is reported at once instead of failing on
+// the first one. Nil means valid.
+func Validate(config *ProxyConfiguration) ConfigErrors {
+	ctx := NewContext()
+	ctx.dryRun = true
+	return ctx.build(nil, config)
+}
+
+func (ctx *context) fail(path string, format string, args ...interface{}) {
+	ctx.errors = append(ctx.errors, ConfigError{
+		Path:    path,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (ctx *context) required(path string, value string) bool {
+	if value == "" {
+		ctx.fail(path, "value is required")
+		return false
+	}
+	return true
+}
+
+// parseUrl returns nil for a missing or not absolute url
+func (ctx *context) parseUrl(path string, value string) *url.URL {
+	if !ctx.required(path, value) {
+		return nil
+	}
+	parsed, err := url.Parse(value)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		ctx.fail(path, "invalid url '%v'", value)
+		return nil
+	}
+	return parsed
+}
+
+func (ctx *context) validLogLevel(logLevel LogLevel) bool {
+	switch logLevel {
+	case "", Debug, Trace, Info:
+		return true
+	default:
+		ctx.fail("log-level", "undefined log level '%v'", logLevel)
+		return false
+	}
+}
+
+func (ctx *context) validCacheAdapter(path string, adapter CacheAdapter) bool {
+	valid := ctx.required(path+".identifier", adapter.Identifier)
+	if _, found := ctx.cacheAdapterConfigs[adapter.Identifier]; valid && found {
+		ctx.fail(path+".identifier", "cache adapter identifier '%v' is duplicated", adapter.Identifier)
+		valid = false
+	}
+	switch adapter.Type {
+	case GoCache, Session:
+	case Redis:
+		valid = ctx.required(path+".redis-address", adapter.RedisAddress) && valid
+	case File:
+		valid = ctx.required(path+".file-path", adapter.FilePath) && valid
+	default:
+		ctx.fail(path+".type", "undefined cache adapter type '%v'", adapter.Type)
+		valid = false
+	}
+	return valid
+}
+
+// cacheAdapterKinds of the adapter types, 'Session' adapter keeps only user data
+var cacheAdapterKinds = map[CacheAdapterType][]string{
+	GoCache: {"session", "user", "rate limit"},
+	Redis:   {"session", "user", "rate limit"},
+	File:    {"session", "user", "rate limit"},
+	Session: {"user"},
+}
+
+// validCacheAdapterReference checks the adapter is configured and can keep the data of the kind
+func (ctx *context) validCacheAdapterReference(path string, identifier string, kind string) bool {
+	if !ctx.required(path, identifier) {
+		return false
+	}
+	adapter, found := ctx.cacheAdapterConfigs[identifier]
+	if !found {
+		ctx.fail(path, "cache adapter with identifier '%v' not found", identifier)
+		return false
+	}
+	if !containsString(cacheAdapterKinds[adapter.Type], kind) {
+		ctx.fail(path, "%v cache adapter '%v' can't be used as %v cache", adapter.Type, identifier, kind)
+		return false
+	}
+	return true
+}
+
+// requiredEnv reports the settings taken from the environment with the variable name,
+// there is nothing to fix in the YAML
+func (ctx *context) requiredEnv(variable string, value string, requiredBy string) bool {
+	if value == "" {
+		ctx.fail("$"+variable, "environment variable is required by %v", requiredBy)
+		return false
+	}
+	return true
+}
@@ -1,73 +1,49 @@
 package crypt
 
 import (
-	"crypto/aes"
-	"crypto/cipher"
-	"crypto/md5"
-	"crypto/rand"
 	"encoding/hex"
-	"gopkg.in/go-playground/validator.v9"
-	"io"
+	"fmt"
 )
 
+// Encryptor encrypts short facts, like session ids, to hex tokens. Each token is sealed
+// with a fresh random nonce and carries the key id, so tokens issued before a key rotation
+// are still decrypted while the previous key is kept among the retired ones.
 type Encryptor struct {
-	Gsm   cipher.AEAD
-	nonce []byte
+	keyring *Keyring
 }
 
-var validate = validator.New()
-
-func NewEncryptor(privateKey string) *Encryptor {
+func NewEncryptor(privateKey string, retiredKeys ...string) *Encryptor {
 	if privateKey == "" {
 		panic("PrivateKey is required to create Encryptor")
 	}
-	gcm, nonce := generateEncryptEntities(privateKey)
-
-	encryptor := &Encryptor{
-		Gsm:   gcm,
-		nonce: nonce,
-	}
-
-	if err := validate.Struct(encryptor); err != nil {
-		panic(err.Error())
+	keyring, err := NewKeyring(privateKey, retiredKeys...)
+	if err != nil {
+		panic(fmt.Sprintf("Encryptor keyring creation error. Reason: %v", err))
 	}
-	return encryptor
+	return NewKeyringEncryptor(keyring)
 }
 
-func generateEncryptEntities(privateKey string) (cipher.AEAD, []byte) {
-	block, _ := aes.NewCipher(createHash(privateKey))
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		panic(err.Error())
+// NewKeyringEncryptor is for the callers reporting keyring creation errors themselves
+func NewKeyringEncryptor(keyring *Keyring) *Encryptor {
+	return &Encryptor{
+		keyring: keyring,
 	}
-	nonce := make([]byte, gcm.NonceSize())
-	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
-		panic(err.Error())
-	}
-	return gcm, nonce
 }
 
 func (encryptor *Encryptor) EncryptFact(fact string) (string, error) {
-	factBytes := []byte(fact)
-	encryptedText := encryptor.Gsm.Seal(encryptor.nonce, encryptor.nonce, factBytes, nil)
-	hexString := hex.EncodeToString(encryptedText)
-	return hexString, nil
-}
-
-func createHash(value string) []byte {
-	hasher := md5.New()
-	hasher.Write([]byte(value))
-	return hasher.Sum(nil)
+	sealed, err := encryptor.keyring.Seal([]byte(fact), nil)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(sealed), nil
 }
 
 func (encryptor *Encryptor) DecryptFact(encryptedFact string) (string, error) {
-	encryptedBytes, err := hex.DecodeString(encryptedFact)
+	sealed, err := hex.DecodeString(encryptedFact)
 	if err != nil {
 		return "", err
 	}
-	nonceSize := encryptor.Gsm.NonceSize()
-	nonce, ciphertext := encryptedBytes[:nonceSize], encryptedBytes[nonceSize:]
-	plaintext, err := encryptor.Gsm.Open(nil, nonce, ciphertext, nil)
+	plaintext, _, err := encryptor.keyring.Open(sealed, nil)
 	if err != nil {
 		return "", err
 	}
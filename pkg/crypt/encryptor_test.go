@@ -70,3 +70,35 @@ func TestEncryptor_anotherEncryptorFail(t *testing.T) {
 	_, err = anotherEncryptor.DecryptFact(encryptedFact)
 	gomega.Expect(err).NotTo(gomega.BeNil())
 }
+
+func TestEncryptor_freshNonces(t *testing.T) {
+	gomega.RegisterFailHandler(func(message string, callerSkip ...int) {
+		t.Errorf(message)
+	})
+
+	encryptor := NewEncryptor("some-private-key")
+
+	first, err := encryptor.EncryptFact("some-fact")
+	gomega.Expect(err).To(gomega.BeNil())
+	second, err := encryptor.EncryptFact("some-fact")
+	gomega.Expect(err).To(gomega.BeNil())
+
+	gomega.Expect(first).NotTo(gomega.Equal(second))
+	gomega.Expect(first[:2*keyIdSize]).To(gomega.Equal(second[:2*keyIdSize]), "Both tokens carry the same key id")
+}
+
+func TestEncryptor_rotation(t *testing.T) {
+	gomega.RegisterFailHandler(func(message string, callerSkip ...int) {
+		t.Errorf(message)
+	})
+
+	encryptedFact, err := NewEncryptor("old-private-key").EncryptFact("some-fact")
+	gomega.Expect(err).To(gomega.BeNil())
+
+	actualFact, err := NewEncryptor("new-private-key", "old-private-key").DecryptFact(encryptedFact)
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(actualFact).To(gomega.Equal("some-fact"))
+
+	_, err = NewEncryptor("new-private-key").DecryptFact(encryptedFact)
+	gomega.Expect(err).NotTo(gomega.BeNil())
+}
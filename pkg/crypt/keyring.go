@@ -0,0 +1,124 @@
+package crypt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/hkdf"
+	"io"
+)
+
+const keyIdSize = 4
+
+var (
+	hkdfSalt      = []byte("ordinator keyring v2")
+	hkdfKeyIdInfo = []byte("ordinator keyring key id")
+	hkdfKeyInfo   = []byte("ordinator keyring aes-256-gcm")
+)
+
+// Keyring seals values with the active key and opens values sealed with any of its keys,
+// so keys can be rotated without invalidating everything issued before.
+// Sealed format: key id (4 bytes) | nonce | AES-256-GCM ciphertext.
+type Keyring struct {
+	active *keyringKey
+	keys   []*keyringKey
+}
+
+type keyringKey struct {
+	id   []byte
+	aead cipher.AEAD
+}
+
+func NewKeyring(activeKey string, retiredKeys ...string) (*Keyring, error) {
+	if activeKey == "" {
+		return nil, errors.New("active key is required")
+	}
+	keyring := &Keyring{}
+	secrets := make(map[string]string)
+	for i, secret := range append([]string{activeKey}, retiredKeys...) {
+		key, err := deriveKey(secret)
+		if err != nil {
+			return nil, fmt.Errorf("deriving key #%v error. Reason: %v", i, err)
+		}
+		// Values are opened by the key id, different keys sharing it would shadow each other
+		if other, found := secrets[string(key.id)]; found {
+			if other == secret {
+				continue
+			}
+			return nil, fmt.Errorf("key #%v id collides with another key, choose a different key", i)
+		}
+		secrets[string(key.id)] = secret
+		keyring.keys = append(keyring.keys, key)
+	}
+	keyring.active = keyring.keys[0]
+	return keyring, nil
+}
+
+// Key id and key material are derived with HKDF-SHA256, the id doesn't disclose the key.
+// Key material is bound to the key id through the HKDF info.
+func deriveKey(secret string) (*keyringKey, error) {
+	if secret == "" {
+		return nil, errors.New("key is empty")
+	}
+	id := make([]byte, keyIdSize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, []byte(secret), hkdfSalt, hkdfKeyIdInfo), id); err != nil {
+		return nil, err
+	}
+	material := make([]byte, 32)
+	info := append(append([]byte(nil), hkdfKeyInfo...), id...)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, []byte(secret), hkdfSalt, info), material); err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(material)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &keyringKey{
+		id:   id,
+		aead: aead,
+	}, nil
+}
+
+// Seal encrypts plaintext with a fresh random nonce. additionalData is authenticated but not encrypted.
+func (keyring *Keyring) Seal(plaintext []byte, additionalData []byte) ([]byte, error) {
+	key := keyring.active
+	nonce := make([]byte, key.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	sealed := make([]byte, 0, keyIdSize+len(nonce)+len(plaintext)+key.aead.Overhead())
+	sealed = append(sealed, key.id...)
+	sealed = append(sealed, nonce...)
+	return key.aead.Seal(sealed, nonce, plaintext, additionalData), nil
+}
+
+// Open decrypts a sealed value. rotated reports that the value was sealed with a retired key.
+func (keyring *Keyring) Open(sealed []byte, additionalData []byte) (plaintext []byte, rotated bool, err error) {
+	if len(sealed) < keyIdSize {
+		return nil, false, errors.New("sealed value is too short")
+	}
+	keyId, payload := sealed[:keyIdSize], sealed[keyIdSize:]
+	for _, key := range keyring.keys {
+		if !bytes.Equal(key.id, keyId) {
+			continue
+		}
+		nonceSize := key.aead.NonceSize()
+		if len(payload) < nonceSize {
+			return nil, false, errors.New("sealed value is too short")
+		}
+		plaintext, err := key.aead.Open(nil, payload[:nonceSize], payload[nonceSize:], additionalData)
+		if err != nil {
+			return nil, false, err
+		}
+		return plaintext, key != keyring.active, nil
+	}
+	return nil, false, errors.New("sealed with unknown key")
+}
@@ -0,0 +1,85 @@
+package crypt
+
+import (
+	"bytes"
+	"github.com/onsi/gomega"
+	"testing"
+)
+
+func TestKeyring_SealOpen(t *testing.T) {
+	gomega.RegisterFailHandler(func(message string, callerSkip ...int) {
+		t.Errorf(message)
+	})
+
+	keyring, err := NewKeyring("active-key")
+	gomega.Expect(err).To(gomega.BeNil())
+
+	sealed, err := keyring.Seal([]byte("some-value"), []byte("context"))
+	gomega.Expect(err).To(gomega.BeNil())
+
+	plaintext, rotated, err := keyring.Open(sealed, []byte("context"))
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(rotated).To(gomega.BeFalse())
+	gomega.Expect(string(plaintext)).To(gomega.Equal("some-value"))
+
+	_, _, err = keyring.Open(sealed, []byte("another-context"))
+	gomega.Expect(err).NotTo(gomega.BeNil())
+}
+
+func TestKeyring_freshNonces(t *testing.T) {
+	keyring, _ := NewKeyring("active-key")
+
+	first, _ := keyring.Seal([]byte("some-value"), nil)
+	second, _ := keyring.Seal([]byte("some-value"), nil)
+	if bytes.Equal(first, second) {
+		t.Fatalf("Sealing the same value twice must produce different output")
+	}
+}
+
+func TestKeyring_rotation(t *testing.T) {
+	gomega.RegisterFailHandler(func(message string, callerSkip ...int) {
+		t.Errorf(message)
+	})
+
+	oldKeyring, _ := NewKeyring("old-key")
+	sealed, _ := oldKeyring.Seal([]byte("some-value"), nil)
+
+	rotatedKeyring, _ := NewKeyring("new-key", "old-key")
+	plaintext, rotated, err := rotatedKeyring.Open(sealed, nil)
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(rotated).To(gomega.BeTrue())
+	gomega.Expect(string(plaintext)).To(gomega.Equal("some-value"))
+
+	newKeyring, _ := NewKeyring("new-key")
+	_, _, err = newKeyring.Open(sealed, nil)
+	gomega.Expect(err).NotTo(gomega.BeNil())
+}
+
+func TestKeyring_duplicateKey(t *testing.T) {
+	gomega.RegisterFailHandler(func(message string, callerSkip ...int) {
+		t.Errorf(message)
+	})
+
+	keyring, err := NewKeyring("active-key", "old-key", "active-key")
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(keyring.keys).To(gomega.HaveLen(2))
+
+	sealed, _ := keyring.Seal([]byte("some-value"), nil)
+	_, rotated, err := keyring.Open(sealed, nil)
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(rotated).To(gomega.BeFalse())
+}
+
+func TestKeyring_keysDiffer(t *testing.T) {
+	first, _ := deriveKey("active-key")
+	second, _ := deriveKey("old-key")
+	if bytes.Equal(first.id, second.id) {
+		t.Fatalf("Different keys must have different key ids")
+	}
+
+	sealed, _ := (&Keyring{active: first, keys: []*keyringKey{first}}).Seal([]byte("some-value"), nil)
+	copy(sealed, second.id)
+	if _, _, err := (&Keyring{active: second, keys: []*keyringKey{second}}).Open(sealed, nil); err == nil {
+		t.Fatalf("Value sealed with another key must not be opened")
+	}
+}
@@ -1,12 +1,22 @@
 package filters
 
 import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"github.com/Alcereo/ordinator/pkg/common"
 	"github.com/Alcereo/ordinator/pkg/crypt"
 	"github.com/sirupsen/logrus"
 	"gopkg.in/go-playground/validator.v9"
+	"io"
+	"io/ioutil"
+	"mime"
 	"net/http"
+	"net/url"
+	"time"
 )
 
 type methodsSet struct {
@@ -25,28 +35,150 @@ func (set *methodsSet) Contains(method string) bool {
 	return set.methodsMap[method] == true
 }
 
+// CsrfMode is the way unsafe requests are proved to come from the application pages
+type CsrfMode string
+
+const (
+	// Token bound to the session is issued in the header, requires a session filter before
+	HeaderCsrfMode CsrfMode = "Header"
+	// Token is issued in a cookie and must be sent back in the header or the form field,
+	// doesn't need a session
+	DoubleSubmitCookieCsrfMode CsrfMode = "DoubleSubmitCookie"
+	// Origin or Referer header of unsafe requests must be one of the allowed origins
+	OriginCsrfMode CsrfMode = "Origin"
+)
+
+// CsrfTokenScope limits the requests a CSRF token is accepted for
+type CsrfTokenScope string
+
+const (
+	// Token is accepted for any unsafe request of the session
+	SessionCsrfTokenScope CsrfTokenScope = "Session"
+	// Token is accepted only for unsafe requests to the path it was issued on
+	PathCsrfTokenScope CsrfTokenScope = "Path"
+)
+
+const (
+	DefaultCsrfTokenMaxAge = 12 * time.Hour
+	DefaultCsrfCookieName  = "csrf_token"
+	// Limits the body buffered to find the form field token
+	maxCsrfFormBytes = 10 << 20
+)
+
+// csrfToken is encrypted to the token value, the issue time limits the token age.
+// Header mode tokens are bound to the session, cookie mode tokens carry a random nonce instead.
+type csrfToken struct {
+	SessionId string `json:"sid,omitempty"`
+	Nonce     string `json:"nonce,omitempty"`
+	IssuedAt  int64  `json:"iat"`
+	Path      string `json:"path,omitempty"`
+}
+
+// CsrfSettings of the filter, zero values mean the defaults
+type CsrfSettings struct {
+	Mode        CsrfMode
+	HeaderName  string
+	FormField   string
+	SafeMethods []string
+	// Token modes only
+	EncryptorPrivateKey  string
+	EncryptorRetiredKeys []string
+	TokenMaxAge          time.Duration
+	TokenScope           CsrfTokenScope
+	// Double submit cookie mode only
+	CookieName   string
+	CookiePath   string
+	CookieDomain string
+	// Origin mode only
+	AllowedOrigins []string
+}
+
 type CsrfFilter struct {
 	next           *common.RequestHandler
-	Name           string           `validate:"required"`
-	HeaderName     string           `validate:"required"`
-	SafeMethodsSet *methodsSet      `validate:"required"`
-	Encryptor      *crypt.Encryptor `validate:"required"`
+	Name           string   `validate:"required"`
+	Mode           CsrfMode `validate:"oneof=Header DoubleSubmitCookie Origin"`
+	HeaderName     string
+	FormField      string
+	SafeMethodsSet *methodsSet `validate:"required"`
+	Encryptor      *crypt.Encryptor
+	MaxAge         time.Duration
+	Scope          CsrfTokenScope `validate:"oneof=Session Path"`
+	CookieName     string
+	CookiePath     string
+	CookieDomain   string
+	origins        *originList
+	now            func() time.Time
 }
 
 var validate = validator.New()
 
-func NewCsrfFilter(name string, headerName string, safeMethods []string, encryptorPrivateKey string) *CsrfFilter {
+// NewCsrfFilter issues tokens with the private key and still accepts tokens issued
+// with the retired keys, so the key can be rotated without failing open pages
+func NewCsrfFilter(name string, settings CsrfSettings) (*CsrfFilter, error) {
+	if settings.Mode == "" {
+		settings.Mode = HeaderCsrfMode
+	}
+	if settings.TokenMaxAge == 0 {
+		settings.TokenMaxAge = DefaultCsrfTokenMaxAge
+	}
+	if settings.TokenScope == "" {
+		settings.TokenScope = SessionCsrfTokenScope
+	}
+	if settings.CookieName == "" {
+		settings.CookieName = DefaultCsrfCookieName
+	}
+	if settings.CookiePath == "" {
+		settings.CookiePath = "/"
+	}
 	filter := &CsrfFilter{
 		Name:           name,
-		HeaderName:     headerName,
-		SafeMethodsSet: newMethodsSet(safeMethods),
-		Encryptor:      crypt.NewEncryptor(encryptorPrivateKey),
+		Mode:           settings.Mode,
+		HeaderName:     settings.HeaderName,
+		FormField:      settings.FormField,
+		SafeMethodsSet: newMethodsSet(settings.SafeMethods),
+		MaxAge:         settings.TokenMaxAge,
+		Scope:          settings.TokenScope,
+		CookieName:     settings.CookieName,
+		CookiePath:     settings.CookiePath,
+		CookieDomain:   settings.CookieDomain,
+		now:            time.Now,
 	}
-	err := validate.Struct(filter)
-	if err != nil {
-		panic(err.Error())
+	if err := validate.Struct(filter); err != nil {
+		return nil, fmt.Errorf("CSRF filter settings error. Reason: %v", err)
 	}
-	return filter
+	if filter.MaxAge < 0 {
+		return nil, fmt.Errorf("CSRF token max age must be positive: %v", filter.MaxAge)
+	}
+	switch settings.Mode {
+	case OriginCsrfMode:
+		if len(settings.AllowedOrigins) == 0 {
+			return nil, fmt.Errorf("allowed origins are required for the %v CSRF mode", OriginCsrfMode)
+		}
+		for _, origin := range settings.AllowedOrigins {
+			if origin == "*" {
+				return nil, fmt.Errorf("any origin '*' can't be allowed for the %v CSRF mode", OriginCsrfMode)
+			}
+		}
+		filter.origins = newOriginList(settings.AllowedOrigins)
+	case DoubleSubmitCookieCsrfMode:
+		if settings.TokenScope == PathCsrfTokenScope {
+			return nil, fmt.Errorf("%v token scope isn't supported by the %v CSRF mode", PathCsrfTokenScope, DoubleSubmitCookieCsrfMode)
+		}
+		fallthrough
+	default:
+		if settings.HeaderName == "" {
+			return nil, fmt.Errorf("CSRF header is required for the %v CSRF mode", settings.Mode)
+		}
+		if settings.EncryptorPrivateKey == "" {
+			return nil, fmt.Errorf("CSRF encryptor private key is required for the %v CSRF mode", settings.Mode)
+		}
+		keyring, err := crypt.NewKeyring(settings.EncryptorPrivateKey, settings.EncryptorRetiredKeys...)
+		if err != nil {
+			return nil, fmt.Errorf("CSRF encryptor keys error. Reason: %v", err)
+		}
+		filter.Encryptor = crypt.NewKeyringEncryptor(keyring)
+	}
+	return filter, nil
 }
 
 func (filter *CsrfFilter) SetNext(nextHandler common.RequestHandler) {
@@ -57,35 +189,32 @@ func (filter *CsrfFilter) Handle(log *logrus.Entry, writer http.ResponseWriter,
 	const stage = "Csrf filter error. Reason: %v"
 	log = log.WithField("filterName", filter.Name)
 
-	session, err := resolveSession(request)
-	if err != nil {
-		log.Errorf(stage, err)
-		writer.WriteHeader(500)
-		_, _ = fmt.Fprintf(writer, stage, err.Error())
-		return
-	}
-
-	if !filter.methodIsSafe(request.Method) {
-		csrfHeader, err := filter.resolveCsrfHeader(request.Header)
+	var session *common.Session
+	if filter.Mode == HeaderCsrfMode {
+		var err error
+		session, err = resolveSession(request)
 		if err != nil {
-			writer.WriteHeader(403)
-			_, _ = fmt.Fprintf(writer, err.Error())
+			log.Errorf(stage, err)
+			writer.WriteHeader(500)
+			_, _ = fmt.Fprintf(writer, stage, err.Error())
 			return
 		}
-		if err := filter.checkCsrfHeader(csrfHeader, session); err != nil {
+	}
+
+	if !filter.methodIsSafe(request.Method) {
+		if err := filter.checkRequest(session, request); err != nil {
+			log.Debugf("CSRF check failed. Reason: %v", err)
 			writer.WriteHeader(403)
 			_, _ = fmt.Fprintf(writer, err.Error())
 			return
 		}
-	} else {
-		newCsrfToken, err := filter.generateNewCsrfToken(session)
-		if err != nil {
+	} else if filter.Mode != OriginCsrfMode {
+		if err := filter.issueCsrfToken(writer, session, request); err != nil {
 			log.Errorf(stage, err.Error())
 			writer.WriteHeader(500)
 			_, _ = fmt.Fprintf(writer, stage, err.Error())
 			return
 		}
-		writer.Header().Add(filter.HeaderName, newCsrfToken)
 	}
 	(*filter.next).Handle(log, writer, request)
 }
@@ -94,31 +223,175 @@ func (filter *CsrfFilter) methodIsSafe(method string) bool {
 	return filter.SafeMethodsSet.Contains(method)
 }
 
-func (filter *CsrfFilter) checkCsrfHeader(csrfHeader string, session *common.Session) error {
-	value, err := filter.Encryptor.DecryptFact(csrfHeader)
+func (filter *CsrfFilter) checkRequest(session *common.Session, request *http.Request) error {
+	if filter.Mode == OriginCsrfMode {
+		return filter.checkOrigin(request)
+	}
+	submitted, err := filter.resolveSubmittedToken(request)
 	if err != nil {
-		return fmt.Errorf("decrypt CSRF header error. Reason: %v", err.Error())
+		return err
 	}
-	if value != string(session.Id) {
+	if filter.Mode == DoubleSubmitCookieCsrfMode {
+		cookie, err := request.Cookie(filter.CookieName)
+		if err != nil || cookie.Value == "" {
+			return fmt.Errorf("resolving CSRF cookie error. CSRF cookie: %v is empty", filter.CookieName)
+		}
+		if subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(submitted)) != 1 {
+			return fmt.Errorf("invalid CSRF token")
+		}
+	}
+	return filter.checkCsrfToken(submitted, session, request)
+}
+
+// checkOrigin takes Referer when Origin isn't sent, browsers omit Origin for some same origin requests
+func (filter *CsrfFilter) checkOrigin(request *http.Request) error {
+	origin := request.Header.Get("Origin")
+	if origin == "" {
+		referer := request.Header.Get("Referer")
+		if referer == "" {
+			return fmt.Errorf("CSRF origin check error. Origin and Referer headers are empty")
+		}
+		refererUrl, err := url.Parse(referer)
+		if err != nil || refererUrl.Scheme == "" || refererUrl.Host == "" {
+			return fmt.Errorf("CSRF origin check error. Invalid Referer: %v", referer)
+		}
+		origin = refererUrl.Scheme + "://" + refererUrl.Host
+	}
+	if !filter.origins.Contains(origin) {
+		return fmt.Errorf("CSRF origin check error. Origin is not allowed: %v", origin)
+	}
+	return nil
+}
+
+func (filter *CsrfFilter) checkCsrfToken(submitted string, session *common.Session, request *http.Request) error {
+	token, err := filter.decryptCsrfToken(submitted)
+	if err != nil {
+		return err
+	}
+	if session != nil && token.SessionId != string(session.Id) {
 		return fmt.Errorf("invalid CSRF token")
 	}
+	if age := filter.now().Sub(time.Unix(token.IssuedAt, 0)); age > filter.MaxAge {
+		return fmt.Errorf("CSRF token expired. Token age: %v, max age: %v", age.Truncate(time.Second), filter.MaxAge)
+	}
+	if token.Path != "" && token.Path != request.URL.Path {
+		return fmt.Errorf("CSRF token is not issued for the path: %v", request.URL.Path)
+	}
 	return nil
 }
 
-func (filter *CsrfFilter) generateNewCsrfToken(session *common.Session) (string, error) {
-	token, err := filter.Encryptor.EncryptFact(string(session.Id))
+func (filter *CsrfFilter) decryptCsrfToken(value string) (*csrfToken, error) {
+	decrypted, err := filter.Encryptor.DecryptFact(value)
 	if err != nil {
-		return "", fmt.Errorf("generation new CSRF token error. Reason: %v", err.Error())
+		return nil, fmt.Errorf("decrypt CSRF header error. Reason: %v", err.Error())
+	}
+	token := &csrfToken{}
+	if err := json.Unmarshal([]byte(decrypted), token); err != nil {
+		return nil, fmt.Errorf("invalid CSRF token")
 	}
 	return token, nil
 }
 
-func (filter *CsrfFilter) resolveCsrfHeader(headers http.Header) (string, error) {
-	header := headers.Get(filter.HeaderName)
-	if header == "" {
+// issueCsrfToken writes a new token to the header. In the cookie mode the valid cookie token
+// is kept, so several open pages share it, and only a missing or expired one is replaced.
+func (filter *CsrfFilter) issueCsrfToken(writer http.ResponseWriter, session *common.Session, request *http.Request) error {
+	if filter.Mode == DoubleSubmitCookieCsrfMode {
+		if cookie, err := request.Cookie(filter.CookieName); err == nil && filter.checkCsrfToken(cookie.Value, nil, request) == nil {
+			writer.Header().Add(filter.HeaderName, cookie.Value)
+			return nil
+		}
+	}
+	newCsrfToken, err := filter.generateNewCsrfToken(session, request)
+	if err != nil {
+		return err
+	}
+	if filter.Mode == DoubleSubmitCookieCsrfMode {
+		// Not HttpOnly, page scripts read the cookie to send the token back
+		http.SetCookie(writer, &http.Cookie{
+			Name:     filter.CookieName,
+			Value:    newCsrfToken,
+			Expires:  filter.now().Add(filter.MaxAge),
+			Path:     filter.CookiePath,
+			Domain:   filter.CookieDomain,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+	writer.Header().Add(filter.HeaderName, newCsrfToken)
+	return nil
+}
+
+func (filter *CsrfFilter) generateNewCsrfToken(session *common.Session, request *http.Request) (string, error) {
+	token := &csrfToken{
+		IssuedAt: filter.now().Unix(),
+	}
+	if session != nil {
+		token.SessionId = string(session.Id)
+	} else {
+		nonce := make([]byte, 16)
+		if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+			return "", fmt.Errorf("generation new CSRF token error. Reason: %v", err.Error())
+		}
+		token.Nonce = hex.EncodeToString(nonce)
+	}
+	if filter.Scope == PathCsrfTokenScope {
+		token.Path = request.URL.Path
+	}
+	value, err := json.Marshal(token)
+	if err != nil {
+		return "", fmt.Errorf("generation new CSRF token error. Reason: %v", err.Error())
+	}
+	encrypted, err := filter.Encryptor.EncryptFact(string(value))
+	if err != nil {
+		return "", fmt.Errorf("generation new CSRF token error. Reason: %v", err.Error())
+	}
+	return encrypted, nil
+}
+
+// resolveSubmittedToken takes the header first and then the form field of HTML form posts
+func (filter *CsrfFilter) resolveSubmittedToken(request *http.Request) (string, error) {
+	if header := request.Header.Get(filter.HeaderName); header != "" {
+		return header, nil
+	}
+	if filter.FormField == "" {
 		return "", fmt.Errorf("resolving CSRF header error. CSRF header: %v is empty", filter.HeaderName)
 	}
-	return header, nil
+	value, err := filter.resolveFormField(request)
+	if err != nil {
+		return "", fmt.Errorf("resolving CSRF form field error. Reason: %v", err)
+	}
+	if value == "" {
+		return "", fmt.Errorf("resolving CSRF token error. CSRF header: %v and form field: %v are empty", filter.HeaderName, filter.FormField)
+	}
+	return value, nil
+}
+
+// resolveFormField parses a copy of the body and restores it, so the upstream gets the whole form
+func (filter *CsrfFilter) resolveFormField(request *http.Request) (string, error) {
+	if request.Body == nil {
+		return "", nil
+	}
+	mediaType, _, _ := mime.ParseMediaType(request.Header.Get("Content-Type"))
+	if mediaType != "application/x-www-form-urlencoded" && mediaType != "multipart/form-data" {
+		return "", nil
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(request.Body, maxCsrfFormBytes+1))
+	_ = request.Body.Close()
+	request.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	if len(body) > maxCsrfFormBytes {
+		return "", fmt.Errorf("form is larger than %v bytes", maxCsrfFormBytes)
+	}
+
+	form := request.WithContext(request.Context())
+	form.Body = ioutil.NopCloser(bytes.NewReader(body))
+	form.Form, form.PostForm, form.MultipartForm = nil, nil, nil
+	value := form.PostFormValue(filter.FormField)
+	if form.MultipartForm != nil {
+		_ = form.MultipartForm.RemoveAll()
+	}
+	return value, nil
 }
 
 func resolveSession(request *http.Request) (*common.Session, error) {
@@ -0,0 +1,215 @@
+package filters
+
+import (
+	"context"
+	"github.com/Alcereo/ordinator/pkg/common"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const csrfHeader = "X-CSRF-TOKEN"
+
+func TestCsrfTokenExpired(t *testing.T) {
+	// Given
+	filter, err := NewCsrfFilter("csrf", CsrfSettings{
+		HeaderName:          csrfHeader,
+		SafeMethods:         []string{"GET"},
+		EncryptorPrivateKey: "some-private-key",
+		TokenMaxAge:         time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("CSRF filter creation error: %v", err)
+	}
+	filter.SetNext(&StubHandler{})
+	issued := time.Now()
+	filter.now = func() time.Time { return issued }
+	token := issueCsrfToken(t, filter, "/form")
+
+	// When
+	filter.now = func() time.Time { return issued.Add(time.Hour + time.Minute) }
+	w := postWithCsrfToken(filter, "/form", token)
+
+	// Then
+	if w.Code != 403 {
+		t.Fatalf("Expect expired token rejected, got status: %v", w.Code)
+	}
+	if !strings.HasPrefix(w.Body.String(), "CSRF token expired") {
+		t.Fatalf("Expect expiration reason, got: %v", w.Body.String())
+	}
+
+	filter.now = func() time.Time { return issued.Add(time.Hour - time.Minute) }
+	if w := postWithCsrfToken(filter, "/form", token); w.Code != 200 {
+		t.Fatalf("Expect token accepted before max age, got status: %v", w.Code)
+	}
+}
+
+func TestCsrfTokenPathScope(t *testing.T) {
+	// Given
+	filter, err := NewCsrfFilter("csrf", CsrfSettings{
+		HeaderName:          csrfHeader,
+		SafeMethods:         []string{"GET"},
+		EncryptorPrivateKey: "some-private-key",
+		TokenScope:          PathCsrfTokenScope,
+	})
+	if err != nil {
+		t.Fatalf("CSRF filter creation error: %v", err)
+	}
+	filter.SetNext(&StubHandler{})
+	token := issueCsrfToken(t, filter, "/form")
+
+	// When
+	w := postWithCsrfToken(filter, "/another-form", token)
+
+	// Then
+	if w.Code != 403 {
+		t.Fatalf("Expect token rejected for another path, got status: %v", w.Code)
+	}
+	if w := postWithCsrfToken(filter, "/form", token); w.Code != 200 {
+		t.Fatalf("Expect token accepted for the issuing path, got status: %v", w.Code)
+	}
+}
+
+func TestCsrfDoubleSubmitCookie(t *testing.T) {
+	// Given
+	filter, err := NewCsrfFilter("csrf", CsrfSettings{
+		Mode:                DoubleSubmitCookieCsrfMode,
+		HeaderName:          csrfHeader,
+		FormField:           "csrf_token",
+		SafeMethods:         []string{"GET"},
+		EncryptorPrivateKey: "some-private-key",
+	})
+	if err != nil {
+		t.Fatalf("CSRF filter creation error: %v", err)
+	}
+	filter.SetNext(&StubHandler{})
+	w := httptest.NewRecorder()
+	filter.Handle(logrus.NewEntry(logrus.StandardLogger()), w, httptest.NewRequest("GET", "/form", nil))
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != DefaultCsrfCookieName || cookies[0].Value != w.Header().Get(csrfHeader) {
+		t.Fatalf("Expect the same token in the cookie and the header, got cookies: %v", cookies)
+	}
+	cookie := cookies[0]
+
+	// When
+	form := "name=value&csrf_token=" + cookie.Value
+	request := httptest.NewRequest("POST", "/form", strings.NewReader(form))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.AddCookie(cookie)
+	w = httptest.NewRecorder()
+	filter.Handle(logrus.NewEntry(logrus.StandardLogger()), w, request)
+
+	// Then
+	if w.Code != 200 {
+		t.Fatalf("Expect form with the cookie token accepted, got status: %v, body: %v", w.Code, w.Body.String())
+	}
+	body, _ := ioutil.ReadAll(nextChainRequest.Body)
+	if string(body) != form {
+		t.Fatalf("Expect form body restored for the next handler, got: %v", string(body))
+	}
+
+	request = httptest.NewRequest("POST", "/form", nil)
+	request.Header.Set(csrfHeader, cookie.Value)
+	if w := handleCsrf(filter, request); w.Code != 403 {
+		t.Fatalf("Expect token without the cookie rejected, got status: %v", w.Code)
+	}
+
+	forgingFilter, err := NewCsrfFilter("forged", CsrfSettings{
+		Mode:                DoubleSubmitCookieCsrfMode,
+		HeaderName:          csrfHeader,
+		EncryptorPrivateKey: "another-private-key",
+	})
+	if err != nil {
+		t.Fatalf("CSRF filter creation error: %v", err)
+	}
+	forged, _ := forgingFilter.generateNewCsrfToken(nil, request)
+	request = httptest.NewRequest("POST", "/form", nil)
+	request.Header.Set(csrfHeader, forged)
+	request.AddCookie(&http.Cookie{Name: DefaultCsrfCookieName, Value: forged})
+	if w := handleCsrf(filter, request); w.Code != 403 {
+		t.Fatalf("Expect cookie token not issued by the filter rejected, got status: %v", w.Code)
+	}
+}
+
+func TestCsrfOrigin(t *testing.T) {
+	filter, err := NewCsrfFilter("csrf", CsrfSettings{
+		Mode:           OriginCsrfMode,
+		SafeMethods:    []string{"GET"},
+		AllowedOrigins: []string{"https://app.example.com", "https://*.example.org"},
+	})
+	if err != nil {
+		t.Fatalf("CSRF filter creation error: %v", err)
+	}
+	filter.SetNext(&StubHandler{})
+	cases := []struct {
+		header   string
+		value    string
+		expected int
+	}{
+		{"Origin", "https://app.example.com", 200},
+		{"Origin", "https://admin.example.org", 200},
+		{"Origin", "https://evil.example.net", 403},
+		{"Origin", "null", 403},
+		{"Referer", "https://app.example.com/orders?page=2", 200},
+		{"Referer", "https://app.example.com.evil.net/orders", 403},
+		{"", "", 403},
+	}
+	for _, testCase := range cases {
+		request := httptest.NewRequest("POST", "/orders", nil)
+		if testCase.header != "" {
+			request.Header.Set(testCase.header, testCase.value)
+		}
+		if w := handleCsrf(filter, request); w.Code != testCase.expected {
+			t.Fatalf("%v: %v. Expect status: %v, got: %v", testCase.header, testCase.value, testCase.expected, w.Code)
+		}
+	}
+}
+
+var csrfTestSession = &common.Session{Id: "session-id"}
+
+func withCsrfTestSession(request *http.Request) *http.Request {
+	return request.WithContext(context.WithValue(request.Context(), common.SessionContextKey, csrfTestSession))
+}
+
+func issueCsrfToken(t *testing.T, filter *CsrfFilter, path string) string {
+	w := httptest.NewRecorder()
+	filter.Handle(logrus.NewEntry(logrus.StandardLogger()), w, withCsrfTestSession(httptest.NewRequest("GET", path, nil)))
+	token := w.Header().Get(csrfHeader)
+	if token == "" {
+		t.Fatalf("CSRF token must be issued on safe method")
+	}
+	return token
+}
+
+func postWithCsrfToken(filter *CsrfFilter, path string, token string) *httptest.ResponseRecorder {
+	request := withCsrfTestSession(httptest.NewRequest("POST", path, nil))
+	request.Header.Set(csrfHeader, token)
+	return handleCsrf(filter, request)
+}
+
+func handleCsrf(filter *CsrfFilter, request *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	filter.Handle(logrus.NewEntry(logrus.StandardLogger()), w, request)
+	return w
+}
+
+func TestInvalidCsrfSettings(t *testing.T) {
+	cases := []CsrfSettings{
+		{Mode: OriginCsrfMode},
+		{Mode: OriginCsrfMode, AllowedOrigins: []string{"*"}},
+		{Mode: DoubleSubmitCookieCsrfMode, HeaderName: csrfHeader, EncryptorPrivateKey: "some-private-key", TokenScope: PathCsrfTokenScope},
+		{HeaderName: csrfHeader},
+		{EncryptorPrivateKey: "some-private-key"},
+		{HeaderName: csrfHeader, EncryptorPrivateKey: "some-private-key", TokenMaxAge: -time.Hour},
+		{Mode: "Unknown", HeaderName: csrfHeader, EncryptorPrivateKey: "some-private-key"},
+	}
+	for _, settings := range cases {
+		if _, err := NewCsrfFilter("csrf", settings); err == nil {
+			t.Fatalf("Expect CSRF settings rejected: %+v", settings)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package filters
+
+import (
+	"github.com/Alcereo/ordinator/pkg/common"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var defaultCorsMethods = []string{"GET", "HEAD", "POST"}
+
+type CorsFilter struct {
+	Name             string
+	next             *common.RequestHandler
+	AllowedOrigins   []string
+	origins          *originList
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAgeSeconds    int
+}
+
+// NewCorsFilter answers preflight requests itself and adds CORS headers to the rest.
+// Origins are exact, like 'https://app.example.com', or patterns with '*' matching any part,
+// like 'https://*.example.com'. Single '*' allows any origin. Headers '*' allows any request header.
+func NewCorsFilter(
+	name string,
+	allowedOrigins []string,
+	allowedMethods []string,
+	allowedHeaders []string,
+	exposedHeaders []string,
+	allowCredentials bool,
+	maxAgeSeconds int,
+) *CorsFilter {
+	if len(allowedMethods) == 0 {
+		allowedMethods = defaultCorsMethods
+	}
+	return &CorsFilter{
+		Name:             name,
+		next:             nil,
+		AllowedOrigins:   allowedOrigins,
+		origins:          newOriginList(allowedOrigins),
+		AllowedMethods:   allowedMethods,
+		AllowedHeaders:   allowedHeaders,
+		ExposedHeaders:   exposedHeaders,
+		AllowCredentials: allowCredentials,
+		MaxAgeSeconds:    maxAgeSeconds,
+	}
+}
+
+func (filter *CorsFilter) SetNext(nextHandler common.RequestHandler) {
+	filter.next = &nextHandler
+}
+
+func (filter *CorsFilter) Handle(log *logrus.Entry, writer http.ResponseWriter, request *http.Request) {
+	log = log.WithField("filterName", filter.Name)
+
+	origin := request.Header.Get("Origin")
+	if isPreflight(request) {
+		filter.handlePreflight(log, writer, request, origin)
+		return
+	}
+
+	// The filter owns CORS of the route, upstream CORS headers are replaced with its own
+	corsWriter := newCorsResponseWriter(writer)
+	if origin != "" {
+		if filter.originAllowed(origin) {
+			filter.writeOriginHeaders(corsWriter.corsHeaders, origin)
+			if len(filter.ExposedHeaders) > 0 {
+				corsWriter.corsHeaders.Set("Access-Control-Expose-Headers", strings.Join(filter.ExposedHeaders, ", "))
+			}
+		} else {
+			log.Debugf("Cors origin is not allowed: %v", origin)
+		}
+	}
+
+	if filter.next != nil {
+		(*filter.next).Handle(log, corsWriter, request)
+	} else {
+		log.Debugf("Cors filter error: %+v. Next handler is empty", filter.Name)
+	}
+	if !corsWriter.HeaderWritten() {
+		corsWriter.WriteHeader(http.StatusOK)
+	}
+}
+
+func (filter *CorsFilter) handlePreflight(log *logrus.Entry, writer http.ResponseWriter, request *http.Request, origin string) {
+	headers := writer.Header()
+	headers.Add("Vary", "Origin")
+	headers.Add("Vary", "Access-Control-Request-Method")
+	headers.Add("Vary", "Access-Control-Request-Headers")
+
+	if !filter.originAllowed(origin) {
+		log.Debugf("Cors preflight denied. Origin is not allowed: %v", origin)
+		writer.WriteHeader(http.StatusForbidden)
+		return
+	}
+	method := request.Header.Get("Access-Control-Request-Method")
+	if !filter.methodAllowed(method) {
+		log.Debugf("Cors preflight denied. Method is not allowed: %v", method)
+		writer.WriteHeader(http.StatusForbidden)
+		return
+	}
+	requestHeaders := parseHeaderList(request.Header.Get("Access-Control-Request-Headers"))
+	if !filter.headersAllowed(requestHeaders) {
+		log.Debugf("Cors preflight denied. Headers are not allowed: %v", requestHeaders)
+		writer.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	filter.writeOriginHeaders(headers, origin)
+	headers.Set("Access-Control-Allow-Methods", strings.Join(filter.AllowedMethods, ", "))
+	if len(requestHeaders) > 0 {
+		headers.Set("Access-Control-Allow-Headers", strings.Join(requestHeaders, ", "))
+	}
+	if filter.MaxAgeSeconds > 0 {
+		headers.Set("Access-Control-Max-Age", strconv.Itoa(filter.MaxAgeSeconds))
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// writeOriginHeaders echoes the origin instead of '*', browsers reject '*' for requests with credentials
+func (filter *CorsFilter) writeOriginHeaders(headers http.Header, origin string) {
+	headers.Set("Access-Control-Allow-Origin", origin)
+	if filter.AllowCredentials {
+		headers.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+func (filter *CorsFilter) originAllowed(origin string) bool {
+	return filter.origins.Contains(origin)
+}
+
+func (filter *CorsFilter) methodAllowed(method string) bool {
+	for _, allowed := range filter.AllowedMethods {
+		if allowed == method {
+			return true
+		}
+	}
+	return false
+}
+
+func (filter *CorsFilter) headersAllowed(requestHeaders []string) bool {
+	for _, header := range requestHeaders {
+		allowed := false
+		for _, allowedHeader := range filter.AllowedHeaders {
+			if allowedHeader == "*" || strings.EqualFold(allowedHeader, header) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+	return true
+}
+
+type corsResponseWriter struct {
+	*common.ResponseWriter
+	corsHeaders http.Header
+}
+
+func newCorsResponseWriter(writer http.ResponseWriter) *corsResponseWriter {
+	corsWriter := &corsResponseWriter{corsHeaders: http.Header{}}
+	corsWriter.ResponseWriter = common.WrapResponseWriter(writer, corsWriter.writeCorsHeaders)
+	return corsWriter
+}
+
+// writeCorsHeaders drops 'Access-Control-*' headers set down the chain, so they are not duplicated.
+// Responses vary by Origin with and without it, so shared caches don't serve one for the other.
+func (writer *corsResponseWriter) writeCorsHeaders(statusCode int) int {
+	headers := writer.ResponseWriter.Header()
+	for name := range headers {
+		if strings.HasPrefix(name, "Access-Control-") {
+			headers.Del(name)
+		}
+	}
+	for name, values := range writer.corsHeaders {
+		headers[name] = values
+	}
+	if !varies(headers, "Origin") {
+		headers.Add("Vary", "Origin")
+	}
+	return statusCode
+}
+
+// varies tells whether the Vary headers set down the chain already list the header
+func varies(headers http.Header, name string) bool {
+	for _, value := range headers["Vary"] {
+		for _, varied := range strings.Split(value, ",") {
+			varied = strings.TrimSpace(varied)
+			if varied == "*" || strings.EqualFold(varied, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isPreflight(request *http.Request) bool {
+	return request.Method == http.MethodOptions &&
+		request.Header.Get("Origin") != "" &&
+		request.Header.Get("Access-Control-Request-Method") != ""
+}
+
+func parseHeaderList(value string) []string {
+	var headers []string
+	for _, header := range strings.Split(value, ",") {
+		if header = strings.TrimSpace(header); header != "" {
+			headers = append(headers, http.CanonicalHeaderKey(header))
+		}
+	}
+	return headers
+}
+
+// originList matches exact origins and origin patterns with '*' wildcards
+type originList struct {
+	origins  []string
+	patterns []*regexp.Regexp
+}
+
+func newOriginList(origins []string) *originList {
+	list := &originList{origins: origins}
+	for _, origin := range origins {
+		if strings.Contains(origin, "*") {
+			list.patterns = append(list.patterns, originPattern(origin))
+		}
+	}
+	return list
+}
+
+func (list *originList) Contains(origin string) bool {
+	if origin == "" {
+		return false
+	}
+	for _, allowed := range list.origins {
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+	}
+	for _, pattern := range list.patterns {
+		if pattern.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func originPattern(origin string) *regexp.Regexp {
+	parts := strings.Split(origin, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	// Wildcard matches host labels only, it never spans the scheme, port or path separators
+	return regexp.MustCompile("^" + strings.Join(parts, `[^./:]+(?:\.[^./:]+)*`) + "$")
+}
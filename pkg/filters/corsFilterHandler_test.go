@@ -0,0 +1,197 @@
+package filters
+
+import (
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func createCorsFilter() *CorsFilter {
+	filter := NewCorsFilter(
+		"Filter name",
+		[]string{"https://app.example.com", "https://*.example.org"},
+		nil,
+		[]string{"X-CSRF-TOKEN"},
+		[]string{"X-CSRF-TOKEN"},
+		true,
+		0,
+	)
+	filter.SetNext(&StubHandler{})
+	return filter
+}
+
+func TestCorsPreflightShortCircuits(t *testing.T) {
+	// Given
+	nextChainRequest = nil
+	request := httptest.NewRequest("OPTIONS", "/foo", nil)
+	request.Header.Set("Origin", "https://app.example.com")
+	request.Header.Set("Access-Control-Request-Method", "POST")
+	request.Header.Set("Access-Control-Request-Headers", "x-csrf-token")
+	w := httptest.NewRecorder()
+
+	// When
+	createCorsFilter().Handle(logrus.NewEntry(logrus.StandardLogger()), w, request)
+
+	// Then
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expect preflight answered with 204, got: %v", w.Code)
+	}
+	if nextChainRequest != nil {
+		t.Fatalf("Preflight must not reach next handler")
+	}
+	if methods := w.Header().Get("Access-Control-Allow-Methods"); methods != "GET, HEAD, POST" {
+		t.Fatalf("Expect default methods allowed, got: %v", methods)
+	}
+	if w.Header().Get("Access-Control-Max-Age") != "" {
+		t.Fatalf("Max age must not be sent when not configured")
+	}
+}
+
+func TestCorsPreflightDenied(t *testing.T) {
+	cases := []struct {
+		origin  string
+		method  string
+		headers string
+	}{
+		{"https://evil.com", "POST", ""},
+		{"https://example.org", "POST", ""},
+		{"https://app.example.org:8443", "POST", ""},
+		{"https://app.example.com", "DELETE", ""},
+		{"https://app.example.com", "POST", "Authorization"},
+	}
+	for _, testCase := range cases {
+		request := httptest.NewRequest("OPTIONS", "/foo", nil)
+		request.Header.Set("Origin", testCase.origin)
+		request.Header.Set("Access-Control-Request-Method", testCase.method)
+		request.Header.Set("Access-Control-Request-Headers", testCase.headers)
+		w := httptest.NewRecorder()
+
+		createCorsFilter().Handle(logrus.NewEntry(logrus.StandardLogger()), w, request)
+
+		if w.Code != http.StatusForbidden || w.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Fatalf("Expect preflight %+v denied, got: %v", testCase, w.Code)
+		}
+	}
+}
+
+func TestCorsActualRequest(t *testing.T) {
+	// Given
+	request := httptest.NewRequest("POST", "/foo", nil)
+	request.Header.Set("Origin", "https://tenant.eu.example.org")
+	w := httptest.NewRecorder()
+
+	// When
+	createCorsFilter().Handle(logrus.NewEntry(logrus.StandardLogger()), w, request)
+
+	// Then
+	if nextChainRequest != request {
+		t.Fatalf("Request must reach next handler")
+	}
+	if origin := w.Header().Get("Access-Control-Allow-Origin"); origin != "https://tenant.eu.example.org" {
+		t.Fatalf("Expect origin allowed by pattern, got: %v", origin)
+	}
+	if w.Header().Get("Access-Control-Allow-Credentials") != "true" {
+		t.Fatalf("Expect credentials allowed")
+	}
+	if exposed := w.Header().Get("Access-Control-Expose-Headers"); exposed != "X-CSRF-TOKEN" {
+		t.Fatalf("Expect CSRF header exposed, got: %v", exposed)
+	}
+}
+
+func TestCorsRequestFromUnknownOrigin(t *testing.T) {
+	// Given
+	request := httptest.NewRequest("GET", "/foo", nil)
+	request.Header.Set("Origin", "https://evil.com")
+	w := httptest.NewRecorder()
+
+	// When
+	createCorsFilter().Handle(logrus.NewEntry(logrus.StandardLogger()), w, request)
+
+	// Then
+	if nextChainRequest != request {
+		t.Fatalf("Request must reach next handler")
+	}
+	if w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("Unknown origin must not be allowed")
+	}
+}
+
+func TestCorsVaryByOrigin(t *testing.T) {
+	cases := []struct {
+		origin       string
+		upstreamVary []string
+		expected     []string
+	}{
+		{"", nil, []string{"Origin"}},
+		{"https://app.example.com", nil, []string{"Origin"}},
+		{"https://evil.com", []string{"Accept-Encoding"}, []string{"Accept-Encoding", "Origin"}},
+		{"", []string{"Accept-Encoding, origin"}, []string{"Accept-Encoding, origin"}},
+	}
+	for i, testCase := range cases {
+		// Given
+		filter := createCorsFilter()
+		filter.SetNext(&varyingHandler{vary: testCase.upstreamVary})
+		request := httptest.NewRequest("GET", "/foo", nil)
+		if testCase.origin != "" {
+			request.Header.Set("Origin", testCase.origin)
+		}
+		w := httptest.NewRecorder()
+
+		// When
+		filter.Handle(logrus.NewEntry(logrus.StandardLogger()), w, request)
+
+		// Then
+		if vary := w.Header()["Vary"]; !reflect.DeepEqual(vary, testCase.expected) {
+			t.Fatalf("Case %v: expect Vary %v, got: %v", i, testCase.expected, vary)
+		}
+	}
+}
+
+// varyingHandler answers with the Vary headers of an upstream
+type varyingHandler struct {
+	vary []string
+}
+
+func (handler *varyingHandler) Handle(log *logrus.Entry, writer http.ResponseWriter, request *http.Request) {
+	for _, value := range handler.vary {
+		writer.Header().Add("Vary", value)
+	}
+	writer.WriteHeader(200)
+}
+
+func TestCorsReplacesUpstreamHeaders(t *testing.T) {
+	// Given
+	filter := createCorsFilter()
+	filter.SetNext(&upstreamCorsHandler{})
+	request := httptest.NewRequest("GET", "/foo", nil)
+	request.Header.Set("Origin", "https://app.example.com")
+	w := httptest.NewRecorder()
+
+	// When
+	filter.Handle(logrus.NewEntry(logrus.StandardLogger()), w, request)
+
+	// Then
+	if origins := w.Header()["Access-Control-Allow-Origin"]; len(origins) != 1 || origins[0] != "https://app.example.com" {
+		t.Fatalf("Expect only the filter allowed origin, got: %v", origins)
+	}
+	if w.Header().Get("Access-Control-Max-Age") != "" {
+		t.Fatalf("Upstream CORS headers must be removed")
+	}
+	if w.Header().Get("X-Upstream") != "true" {
+		t.Fatalf("Other upstream headers must be kept")
+	}
+}
+
+// upstreamCorsHandler answers with its own CORS headers, as a proxied upstream could
+type upstreamCorsHandler struct {
+}
+
+func (handler *upstreamCorsHandler) Handle(log *logrus.Entry, writer http.ResponseWriter, request *http.Request) {
+	nextChainRequest = request
+	writer.Header().Add("Access-Control-Allow-Origin", "*")
+	writer.Header().Set("Access-Control-Max-Age", "600")
+	writer.Header().Set("X-Upstream", "true")
+	writer.WriteHeader(200)
+}
@@ -2,6 +2,7 @@ package filters
 
 import (
 	"bytes"
+	"fmt"
 	"github.com/Alcereo/ordinator/pkg/common"
 	log "github.com/sirupsen/logrus"
 	"net/http"
@@ -44,15 +45,14 @@ func (filter *LogFilterHandler) Handle(log *log.Entry, writer http.ResponseWrite
 
 // Factory
 
-func CreateLogFilter(name string, template string, next common.RequestHandler) *LogFilterHandler {
+func CreateLogFilter(name string, template string, next common.RequestHandler) (*LogFilterHandler, error) {
 	parse, err := templ.New(name).Parse(template)
 	if err != nil {
-		log.Warnf("Log filter templ error: %v. Skip filter", err)
-		return nil
+		return nil, fmt.Errorf("log filter template error. Reason: %v", err)
 	}
 	return &LogFilterHandler{
 		next:     &next,
 		Name:     name,
 		template: parse,
-	}
+	}, nil
 }
@@ -0,0 +1,128 @@
+package filters
+
+import (
+	"github.com/Alcereo/ordinator/pkg/common"
+	log "github.com/sirupsen/logrus"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RateLimitCachePort keeps token buckets, shared cache adapters make limits hold across replicas
+type RateLimitCachePort interface {
+	TakeToken(key string, rate float64, burst int) (allowed bool, retryAfter time.Duration, err error)
+}
+
+// RateLimitKeyFunc returns the key requests are limited by, or false when the request has none
+type RateLimitKeyFunc func(request *http.Request) (string, bool)
+
+type RateLimitFilterHandler struct {
+	Name              string
+	next              *common.RequestHandler
+	RateLimitCache    RateLimitCachePort
+	Key               RateLimitKeyFunc
+	Rate              float64
+	Burst             int
+	TrustForwardedFor bool
+}
+
+// CreateRateLimitFilter limits requests to rate per second with bursts up to burst requests.
+// Requests without the key, like anonymous requests limited by user, are limited by client ip.
+func CreateRateLimitFilter(
+	name string,
+	rateLimitCache RateLimitCachePort,
+	key RateLimitKeyFunc,
+	rate float64,
+	burst int,
+	trustForwardedFor bool,
+) *RateLimitFilterHandler {
+	if burst <= 0 {
+		burst = int(math.Max(1, math.Ceil(rate)))
+	}
+	return &RateLimitFilterHandler{
+		Name:              name,
+		next:              nil,
+		RateLimitCache:    rateLimitCache,
+		Key:               key,
+		Rate:              rate,
+		Burst:             burst,
+		TrustForwardedFor: trustForwardedFor,
+	}
+}
+
+func (filter *RateLimitFilterHandler) SetNext(nextHandler common.RequestHandler) {
+	filter.next = &nextHandler
+}
+
+func (filter *RateLimitFilterHandler) Handle(log *log.Entry, writer http.ResponseWriter, request *http.Request) {
+	log = log.WithField("filterName", filter.Name)
+
+	key, found := filter.Key(request)
+	if !found {
+		key = "client-ip:" + ClientIp(request, filter.TrustForwardedFor)
+	}
+	log = log.WithField("rateLimitKey", key)
+
+	allowed, retryAfter, err := filter.RateLimitCache.TakeToken(filter.Name+":"+key, filter.Rate, filter.Burst)
+	if err != nil {
+		// Limits are protection, the gateway keeps serving when the cache is not available
+		log.Errorf("Rate limit check error. Request passed. Reason: %v", err)
+		allowed = true
+	}
+	if !allowed {
+		log.Debugf("Rate limit exceeded. Retry after: %v", retryAfter)
+		writer.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		writer.WriteHeader(http.StatusTooManyRequests)
+		return
+	}
+
+	if filter.next != nil {
+		(*filter.next).Handle(log, writer, request)
+	} else {
+		log.Debugf("Rate limit filter error: %+v. Next handler is empty", filter.Name)
+	}
+}
+
+func ClientIpRateLimitKey(trustForwardedFor bool) RateLimitKeyFunc {
+	return func(request *http.Request) (string, bool) {
+		return "client-ip:" + ClientIp(request, trustForwardedFor), true
+	}
+}
+
+func SessionRateLimitKey(request *http.Request) (string, bool) {
+	session, ok := request.Context().Value(common.SessionContextKey).(*common.Session)
+	if !ok || session == nil || session.Id == "" {
+		return "", false
+	}
+	return "session:" + string(session.Id), true
+}
+
+func UserRateLimitKey(request *http.Request) (string, bool) {
+	userData, ok := request.Context().Value(common.UserDataContextKey).(*common.UserData)
+	if !ok || userData == nil || userData.Identifier == "" {
+		return "", false
+	}
+	return "user:" + userData.Identifier, true
+}
+
+// ClientIp takes the last 'X-Forwarded-For' address only when the gateway is behind a trusted proxy.
+// It is the one appended by that proxy, the addresses before it are sent by the client
+// and could be chosen to get a fresh limit key.
+func ClientIp(request *http.Request, trustForwardedFor bool) string {
+	if trustForwardedFor {
+		if forwarded := request.Header["X-Forwarded-For"]; len(forwarded) > 0 {
+			addresses := strings.Split(forwarded[len(forwarded)-1], ",")
+			if address := strings.TrimSpace(addresses[len(addresses)-1]); address != "" {
+				return address
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		return request.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,137 @@
+package filters
+
+import (
+	"context"
+	"errors"
+	"github.com/Alcereo/ordinator/pkg/common"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimitExceeded(t *testing.T) {
+	// Given
+	handler := CreateRateLimitFilter("Filter name", newStubRateLimitCache(), ClientIpRateLimitKey(false), 0.5, 2, false)
+	handler.SetNext(&StubHandler{})
+
+	// When
+	codes := make([]int, 0, 3)
+	var lastResult *http.Response
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		handler.Handle(logrus.NewEntry(logrus.StandardLogger()), w, httptest.NewRequest("GET", "/foo", nil))
+		lastResult = w.Result()
+		codes = append(codes, lastResult.StatusCode)
+	}
+
+	// Then
+	if codes[0] != 200 || codes[1] != 200 || codes[2] != http.StatusTooManyRequests {
+		t.Fatalf("Expect burst of 2 requests passed and third limited, got: %v", codes)
+	}
+	if retryAfter := lastResult.Header.Get("Retry-After"); retryAfter != "2" {
+		t.Fatalf("Expect 'Retry-After' of 2 seconds, got: '%v'", retryAfter)
+	}
+}
+
+func TestRateLimitBySession(t *testing.T) {
+	// Given
+	handler := CreateRateLimitFilter("Filter name", newStubRateLimitCache(), SessionRateLimitKey, 1, 1, false)
+	handler.SetNext(&StubHandler{})
+	requestWithSession := func(id common.SessionId) *http.Request {
+		request := httptest.NewRequest("GET", "/foo", nil)
+		return request.WithContext(context.WithValue(request.Context(), common.SessionContextKey, &common.Session{Id: id}))
+	}
+
+	// When
+	first := httptest.NewRecorder()
+	handler.Handle(logrus.NewEntry(logrus.StandardLogger()), first, requestWithSession("s1"))
+	other := httptest.NewRecorder()
+	handler.Handle(logrus.NewEntry(logrus.StandardLogger()), other, requestWithSession("s2"))
+	repeated := httptest.NewRecorder()
+	handler.Handle(logrus.NewEntry(logrus.StandardLogger()), repeated, requestWithSession("s1"))
+
+	// Then
+	if first.Code != 200 || other.Code != 200 {
+		t.Fatalf("Expect sessions limited separately, got: %v, %v", first.Code, other.Code)
+	}
+	if repeated.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expect repeated session request limited, got: %v", repeated.Code)
+	}
+}
+
+func TestRateLimitFallsBackToClientIp(t *testing.T) {
+	// Given
+	cache := newStubRateLimitCache()
+	handler := CreateRateLimitFilter("Filter name", cache, UserRateLimitKey, 1, 1, false)
+	handler.SetNext(&StubHandler{})
+
+	// When
+	request := httptest.NewRequest("GET", "/foo", nil)
+	request.RemoteAddr = "10.0.0.1:5000"
+	handler.Handle(logrus.NewEntry(logrus.StandardLogger()), httptest.NewRecorder(), request)
+
+	// Then
+	if _, found := cache.buckets["Filter name:client-ip:10.0.0.1"]; !found {
+		t.Fatalf("Anonymous request must be limited by client ip, buckets: %v", cache.buckets)
+	}
+}
+
+func TestRateLimitCacheErrorPassesRequest(t *testing.T) {
+	// Given
+	cache := newStubRateLimitCache()
+	cache.err = errors.New("connection refused")
+	handler := CreateRateLimitFilter("Filter name", cache, ClientIpRateLimitKey(false), 1, 1, false)
+	handler.SetNext(&StubHandler{})
+
+	// When
+	w := httptest.NewRecorder()
+	handler.Handle(logrus.NewEntry(logrus.StandardLogger()), w, httptest.NewRequest("GET", "/foo", nil))
+
+	// Then
+	if w.Code != 200 {
+		t.Fatalf("Expect request passed when cache is not available, got: %v", w.Code)
+	}
+}
+
+func TestClientIp(t *testing.T) {
+	request := httptest.NewRequest("GET", "/foo", nil)
+	request.RemoteAddr = "10.0.0.1:5000"
+	// Client sends a spoofed address, the trusted proxy appends the one it sees
+	request.Header.Set("X-Forwarded-For", "198.51.100.1, 203.0.113.7")
+
+	if ip := ClientIp(request, false); ip != "10.0.0.1" {
+		t.Fatalf("Untrusted 'X-Forwarded-For' must be ignored, got: %v", ip)
+	}
+	if ip := ClientIp(request, true); ip != "203.0.113.7" {
+		t.Fatalf("Expect last 'X-Forwarded-For' address, got: %v", ip)
+	}
+
+	request.Header.Add("X-Forwarded-For", "192.0.2.5")
+	if ip := ClientIp(request, true); ip != "192.0.2.5" {
+		t.Fatalf("Expect last address of the last 'X-Forwarded-For' header, got: %v", ip)
+	}
+}
+
+type stubRateLimitCache struct {
+	buckets map[string]*common.TokenBucket
+	err     error
+}
+
+func newStubRateLimitCache() *stubRateLimitCache {
+	return &stubRateLimitCache{buckets: make(map[string]*common.TokenBucket)}
+}
+
+func (cache *stubRateLimitCache) TakeToken(key string, rate float64, burst int) (bool, time.Duration, error) {
+	if cache.err != nil {
+		return false, 0, cache.err
+	}
+	bucket, found := cache.buckets[key]
+	if !found {
+		bucket = &common.TokenBucket{}
+		cache.buckets[key] = bucket
+	}
+	allowed, retryAfter := bucket.Take(time.Now(), rate, burst)
+	return allowed, retryAfter, nil
+}
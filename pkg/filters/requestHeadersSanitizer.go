@@ -0,0 +1,48 @@
+package filters
+
+import (
+	"github.com/Alcereo/ordinator/pkg/common"
+	"github.com/sirupsen/logrus"
+	"net/http"
+)
+
+// requestHeadersSanitizer removes and overwrites client request headers before the route filters run,
+// so backends trusting identity headers never get copies supplied by clients
+type requestHeadersSanitizer struct {
+	next      common.RequestHandler
+	remove    []string
+	protected func() []string
+	set       http.Header
+}
+
+// NewRequestHeadersSanitizer removes the headers of both lists and then sets the set headers.
+// Protected headers are resolved on each request, so they can be collected while the routes are built.
+func NewRequestHeadersSanitizer(
+	remove []string,
+	protected func() []string,
+	set http.Header,
+	next common.RequestHandler,
+) *requestHeadersSanitizer {
+	return &requestHeadersSanitizer{
+		next:      next,
+		remove:    remove,
+		protected: protected,
+		set:       set,
+	}
+}
+
+func (sanitizer *requestHeadersSanitizer) Handle(log *logrus.Entry, writer http.ResponseWriter, request *http.Request) {
+	for _, header := range sanitizer.protected() {
+		if _, found := request.Header[http.CanonicalHeaderKey(header)]; found {
+			log.Warnf("Client request contains protected header %v. Header removed.", header)
+			request.Header.Del(header)
+		}
+	}
+	for _, header := range sanitizer.remove {
+		request.Header.Del(header)
+	}
+	for name, values := range sanitizer.set {
+		request.Header[name] = values
+	}
+	sanitizer.next.Handle(log, writer, request)
+}
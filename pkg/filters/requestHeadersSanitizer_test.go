@@ -0,0 +1,43 @@
+package filters
+
+import (
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestHeadersSanitized(t *testing.T) {
+	// Given
+	protected := []string{"X-User-Data"}
+	sanitizer := NewRequestHeadersSanitizer(
+		[]string{"x-debug"},
+		func() []string { return protected },
+		http.Header{"X-Gateway": {"ordinator"}},
+		&StubHandler{},
+	)
+	request := httptest.NewRequest("GET", "/foo", nil)
+	request.Header.Add("x-user-data", "forged")
+	request.Header.Add("X-User-Data", "forged-again")
+	request.Header.Set("X-Debug", "true")
+	request.Header.Set("X-Gateway", "forged")
+	request.Header.Set("Accept", "application/json")
+
+	// When
+	sanitizer.Handle(logrus.NewEntry(logrus.StandardLogger()), httptest.NewRecorder(), request)
+
+	// Then
+	headers := nextChainRequest.Header
+	if _, found := headers["X-User-Data"]; found {
+		t.Fatalf("Protected header must be removed, got: %v", headers)
+	}
+	if _, found := headers["X-Debug"]; found {
+		t.Fatalf("Configured header must be removed, got: %v", headers)
+	}
+	if values := headers["X-Gateway"]; len(values) != 1 || values[0] != "ordinator" {
+		t.Fatalf("Expect header overwritten, got: %v", values)
+	}
+	if headers.Get("Accept") != "application/json" {
+		t.Fatalf("Other headers must be kept")
+	}
+}
@@ -0,0 +1,216 @@
+package filters
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/Alcereo/ordinator/pkg/common"
+	"github.com/Alcereo/ordinator/pkg/crypt"
+	"github.com/satori/go.uuid"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"time"
+)
+
+const defaultSessionCookieMaxBytes = 4096
+
+// SealedSessionFilterHandler keeps the whole session in the cookie, encrypted and authenticated
+// with the keyring, so no shared state is required between gateway instances.
+type SealedSessionFilterHandler struct {
+	Name                   string
+	next                   *common.RequestHandler
+	SessionCookieName      string
+	Keyring                *crypt.Keyring
+	CookieTTLHours         int
+	RenewCookieBeforeHours int
+	CookiePath             string
+	CookieDomain           string
+	CookieMaxBytes         int
+}
+
+func CreateSealedSessionFilter(
+	name string,
+	cookieName string,
+	keyring *crypt.Keyring,
+	cookieTTLHours int,
+	renewCookieBeforeHours int,
+	cookiePath string,
+	cookieDomain string,
+	cookieMaxBytes int,
+) *SealedSessionFilterHandler {
+	if cookieMaxBytes <= 0 {
+		cookieMaxBytes = defaultSessionCookieMaxBytes
+	}
+	return &SealedSessionFilterHandler{
+		Name:                   name,
+		SessionCookieName:      cookieName,
+		Keyring:                keyring,
+		next:                   nil,
+		CookieTTLHours:         cookieTTLHours,
+		RenewCookieBeforeHours: renewCookieBeforeHours,
+		CookiePath:             cookiePath,
+		CookieDomain:           cookieDomain,
+		CookieMaxBytes:         cookieMaxBytes,
+	}
+}
+
+func (filter *SealedSessionFilterHandler) SetNext(nextHandler common.RequestHandler) {
+	filter.next = &nextHandler
+}
+
+func (filter *SealedSessionFilterHandler) Handle(log *log.Entry, writer http.ResponseWriter, request *http.Request) {
+	log = log.WithField("filterName", filter.Name)
+	session := filter.getOrCreateSession(log, request)
+	log = log.WithField("sessionId", session.Id)
+	log.Debugf("Session retrieved")
+	newContext := context.WithValue(request.Context(), common.SessionContextKey, session)
+	newRequest := request.WithContext(newContext)
+
+	// Session can be changed down the chain, cookie is written right before the response headers
+	sessionWriter := &sealedSessionWriter{
+		filter:  filter,
+		session: session,
+		log:     log,
+	}
+	sessionWriter.ResponseWriter = common.WrapResponseWriter(writer, sessionWriter.writeCookie)
+	if filter.next != nil {
+		(*filter.next).Handle(log, sessionWriter, newRequest)
+	} else {
+		log.Debugf("Session filter error: %+v. Next handler is empty", filter.Name)
+	}
+	if !sessionWriter.HeaderWritten() {
+		sessionWriter.WriteHeader(200)
+	}
+}
+
+func (filter *SealedSessionFilterHandler) getOrCreateSession(log *log.Entry, request *http.Request) *common.Session {
+	cookie, err := request.Cookie(filter.SessionCookieName)
+	if err != nil || cookie == nil {
+		log.Tracef("Cookie was not found in the request context. Creating new Session")
+		return filter.createNewSession(nil)
+	}
+
+	session, rotated, err := filter.openSession(cookie.Value)
+	if err != nil {
+		log.Warnf("Session cookie can't be opened. Creating new session. Reason: %v", err)
+		return filter.createNewSession(nil)
+	}
+	if session.Expires.Before(time.Now()) {
+		log.Debugf("Session expired. Creating new session.")
+		return filter.createNewSession(nil)
+	}
+	if session.Expires.Before(time.Now().Add(time.Hour * time.Duration(filter.RenewCookieBeforeHours))) {
+		log.Tracef("Session cookie renewing.")
+		return filter.createNewSession(session)
+	}
+	if rotated {
+		log.Tracef("Session cookie was sealed with retired key. Resealing.")
+		session.Modified = true
+	}
+	return session
+}
+
+func (filter *SealedSessionFilterHandler) createNewSession(oldSession *common.Session) *common.Session {
+	session := &common.Session{
+		Id:       common.SessionId(uuid.NewV4().String()),
+		Expires:  time.Now().Add(time.Hour * time.Duration(filter.CookieTTLHours)),
+		Modified: true,
+	}
+	if oldSession != nil {
+		session.Id = oldSession.Id
+		session.UserData = oldSession.UserData
+		session.LoginState = oldSession.LoginState
+	}
+	return session
+}
+
+func (filter *SealedSessionFilterHandler) openSession(cookieValue string) (*common.Session, bool, error) {
+	sealed, err := base64.RawURLEncoding.DecodeString(cookieValue)
+	if err != nil {
+		return nil, false, err
+	}
+	data, rotated, err := filter.Keyring.Open(sealed, []byte(filter.SessionCookieName))
+	if err != nil {
+		return nil, false, err
+	}
+	var session common.Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, false, err
+	}
+	session.Cookie = common.SessionCookie(cookieValue)
+	return &session, rotated, nil
+}
+
+func (filter *SealedSessionFilterHandler) sealSession(session *common.Session) (string, error) {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := filter.Keyring.Seal(data, []byte(filter.SessionCookieName))
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+type sealedSessionWriter struct {
+	*common.ResponseWriter
+	filter  *SealedSessionFilterHandler
+	session *common.Session
+	log     *log.Entry
+}
+
+// writeCookie fails the response when the modified session can't be written,
+// instead of silently keeping the previous cookie
+func (writer *sealedSessionWriter) writeCookie(statusCode int) int {
+	if !writer.session.Modified || writer.session.Removed {
+		return statusCode
+	}
+
+	value, err := writer.sealCookieValue()
+	if err != nil {
+		writer.log.Errorf("Sealing session error. Session cookie is not updated. Reason: %v", err)
+		return http.StatusInternalServerError
+	}
+
+	writer.session.Cookie = common.SessionCookie(value)
+	writer.session.Modified = false
+	http.SetCookie(writer.ResponseWriter, &http.Cookie{
+		Name:     writer.filter.SessionCookieName,
+		Value:    value,
+		Expires:  writer.session.Expires,
+		Path:     writer.filter.CookiePath,
+		Domain:   writer.filter.CookieDomain,
+		HttpOnly: true,
+	})
+	return statusCode
+}
+
+// sealCookieValue drops provider tokens when the sealed session doesn't fit the cookie.
+// Token revocation and provider logout are not available for such sessions.
+func (writer *sealedSessionWriter) sealCookieValue() (string, error) {
+	session := writer.session
+	value, err := writer.filter.sealSession(session)
+	if err != nil {
+		return "", err
+	}
+	if len(value) > writer.filter.CookieMaxBytes && session.UserData != nil && session.UserData.Tokens != (common.ProviderTokens{}) {
+		writer.log.Warnf(
+			"Sealed session is %v bytes, exceeds limit of %v bytes. Provider tokens are not kept in the session cookie.",
+			len(value),
+			writer.filter.CookieMaxBytes,
+		)
+		userData := *session.UserData
+		userData.Tokens = common.ProviderTokens{}
+		minimalSession := *session
+		minimalSession.UserData = &userData
+		if value, err = writer.filter.sealSession(&minimalSession); err != nil {
+			return "", err
+		}
+	}
+	if len(value) > writer.filter.CookieMaxBytes {
+		return "", fmt.Errorf("sealed session is %v bytes, exceeds limit of %v bytes", len(value), writer.filter.CookieMaxBytes)
+	}
+	return value, nil
+}
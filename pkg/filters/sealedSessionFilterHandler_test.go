@@ -0,0 +1,255 @@
+package filters
+
+import (
+	"github.com/Alcereo/ordinator/pkg/common"
+	"github.com/Alcereo/ordinator/pkg/crypt"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSealedNewSessionCreate(t *testing.T) {
+	// Given
+	handler := createSealedSessionFilter(t, 0, "active-key")
+	handler.SetNext(&StubHandler{})
+
+	// When
+	w := httptest.NewRecorder()
+	handler.Handle(logrus.NewEntry(logrus.StandardLogger()), w, httptest.NewRequest("GET", "/foo", nil))
+
+	// Then
+	cookie := findCookie("sealed-session", w.Result())
+	if cookie == nil {
+		t.Fatalf("Set-Cookie header for new session not found")
+	}
+	if !cookie.HttpOnly {
+		t.Fatalf("Session cookie must be HttpOnly")
+	}
+	session := contextSession(t)
+	if session.Id == "" {
+		t.Fatalf("Session must have identifier")
+	}
+}
+
+func TestSealedExistingSessionGet(t *testing.T) {
+	// Given
+	handler := createSealedSessionFilter(t, 0, "active-key")
+	handler.SetNext(&StubHandler{})
+	cookie, sessionId := issueSealedCookie(t, handler)
+
+	// When
+	req := httptest.NewRequest("GET", "/foo", nil)
+	req.AddCookie(cookie)
+	w := httptest.NewRecorder()
+	handler.Handle(logrus.NewEntry(logrus.StandardLogger()), w, req)
+
+	// Then
+	if contextSession(t).Id != sessionId {
+		t.Fatalf("Expecting session %v from cookie, actual: %v", sessionId, contextSession(t).Id)
+	}
+	if findCookie("sealed-session", w.Result()) != nil {
+		t.Fatalf("Unmodified session must not be written again")
+	}
+}
+
+func TestSealedSessionUserDataWritten(t *testing.T) {
+	// Given
+	handler := createSealedSessionFilter(t, 0, "active-key")
+	handler.SetNext(&userDataPuttingHandler{})
+
+	// When
+	w := httptest.NewRecorder()
+	handler.Handle(logrus.NewEntry(logrus.StandardLogger()), w, httptest.NewRequest("GET", "/foo", nil))
+
+	// Then
+	cookie := findCookie("sealed-session", w.Result())
+	if cookie == nil {
+		t.Fatalf("Set-Cookie header not found")
+	}
+	session, _, err := handler.openSession(cookie.Value)
+	if err != nil {
+		t.Fatalf("Opening sealed session error: %v", err)
+	}
+	if session.UserData == nil || session.UserData.Identifier != "user-1" {
+		t.Fatalf("User data must be sealed into the cookie")
+	}
+}
+
+func TestSealedSessionKeyRotation(t *testing.T) {
+	// Given
+	oldHandler := createSealedSessionFilter(t, 0, "old-key")
+	oldHandler.SetNext(&StubHandler{})
+	cookie, sessionId := issueSealedCookie(t, oldHandler)
+
+	handler := createSealedSessionFilter(t, 0, "new-key", "old-key")
+	handler.SetNext(&StubHandler{})
+
+	// When
+	req := httptest.NewRequest("GET", "/foo", nil)
+	req.AddCookie(cookie)
+	w := httptest.NewRecorder()
+	handler.Handle(logrus.NewEntry(logrus.StandardLogger()), w, req)
+
+	// Then
+	if contextSession(t).Id != sessionId {
+		t.Fatalf("Session sealed with retired key must be accepted")
+	}
+	resealed := findCookie("sealed-session", w.Result())
+	if resealed == nil {
+		t.Fatalf("Session sealed with retired key must be resealed with active key")
+	}
+	if _, rotated, err := handler.openSession(resealed.Value); err != nil || rotated {
+		t.Fatalf("Resealed session must be opened with active key")
+	}
+}
+
+func TestSealedTamperedCookie(t *testing.T) {
+	// Given
+	handler := createSealedSessionFilter(t, 0, "active-key")
+	handler.SetNext(&StubHandler{})
+	cookie, sessionId := issueSealedCookie(t, handler)
+	cookie.Value = cookie.Value[:len(cookie.Value)-2] + "AA"
+
+	// When
+	req := httptest.NewRequest("GET", "/foo", nil)
+	req.AddCookie(cookie)
+	handler.Handle(logrus.NewEntry(logrus.StandardLogger()), httptest.NewRecorder(), req)
+
+	// Then
+	if contextSession(t).Id == sessionId {
+		t.Fatalf("Tampered cookie must not be accepted")
+	}
+}
+
+func TestSealedCookieSizeLimit(t *testing.T) {
+	// Given
+	handler := createSealedSessionFilter(t, 64, "active-key")
+	handler.SetNext(&userDataPuttingHandler{})
+
+	// When
+	w := httptest.NewRecorder()
+	handler.Handle(logrus.NewEntry(logrus.StandardLogger()), w, httptest.NewRequest("GET", "/foo", nil))
+
+	// Then
+	if findCookie("sealed-session", w.Result()) != nil {
+		t.Fatalf("Cookie exceeding size limit must not be written")
+	}
+	if w.Code != 500 {
+		t.Fatalf("Expecting failed response for the session not fitting the cookie, actual status: %v", w.Code)
+	}
+}
+
+func TestSealedCookieSizeLimitDropsProviderTokens(t *testing.T) {
+	// Given
+	handler := createSealedSessionFilter(t, 512, "active-key")
+	handler.SetNext(&userDataPuttingHandler{tokens: common.ProviderTokens{
+		AccessToken: strings.Repeat("a", 1024),
+		IdToken:     strings.Repeat("i", 1024),
+	}})
+
+	// When
+	w := httptest.NewRecorder()
+	handler.Handle(logrus.NewEntry(logrus.StandardLogger()), w, httptest.NewRequest("GET", "/foo", nil))
+
+	// Then
+	cookie := findCookie("sealed-session", w.Result())
+	if cookie == nil || w.Code != 200 {
+		t.Fatalf("Session without provider tokens must be written, status: %v", w.Code)
+	}
+	session, _, err := handler.openSession(cookie.Value)
+	if err != nil {
+		t.Fatalf("Opening sealed session error: %v", err)
+	}
+	if session.UserData == nil || session.UserData.Identifier != "user-1" {
+		t.Fatalf("User data must be sealed into the cookie")
+	}
+	if session.UserData.Tokens != (common.ProviderTokens{}) {
+		t.Fatalf("Provider tokens must be dropped from the cookie")
+	}
+}
+
+func TestSealedRemovedSessionNotWritten(t *testing.T) {
+	// Given
+	handler := createSealedSessionFilter(t, 0, "active-key")
+	handler.SetNext(&sessionRemovingHandler{})
+
+	// When
+	w := httptest.NewRecorder()
+	handler.Handle(logrus.NewEntry(logrus.StandardLogger()), w, httptest.NewRequest("GET", "/foo", nil))
+
+	// Then
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].MaxAge >= 0 {
+		t.Fatalf("Only the expiring cookie must be written for the removed session, actual: %v", cookies)
+	}
+}
+
+// Internal
+
+func createSealedSessionFilter(t *testing.T, maxBytes int, activeKey string, retiredKeys ...string) *SealedSessionFilterHandler {
+	keyring, err := crypt.NewKeyring(activeKey, retiredKeys...)
+	if err != nil {
+		t.Fatalf("Keyring creation error: %v", err)
+	}
+	return CreateSealedSessionFilter("Filter name", "sealed-session", keyring, 3, 0, "/", "localhost", maxBytes)
+}
+
+func issueSealedCookie(t *testing.T, handler *SealedSessionFilterHandler) (*http.Cookie, common.SessionId) {
+	w := httptest.NewRecorder()
+	handler.Handle(logrus.NewEntry(logrus.StandardLogger()), w, httptest.NewRequest("GET", "/foo", nil))
+	cookie := findCookie("sealed-session", w.Result())
+	if cookie == nil {
+		t.Fatalf("Set-Cookie header for new session not found")
+	}
+	return cookie, contextSession(t).Id
+}
+
+func contextSession(t *testing.T) *common.Session {
+	value := nextChainRequest.Context().Value(common.SessionContextKey)
+	if value == nil {
+		t.Fatalf("Session must be set in context")
+	}
+	return value.(*common.Session)
+}
+
+func findCookie(name string, response *http.Response) *http.Cookie {
+	for _, cookie := range response.Cookies() {
+		if cookie.Name == name {
+			return cookie
+		}
+	}
+	return nil
+}
+
+type userDataPuttingHandler struct {
+	tokens common.ProviderTokens
+}
+
+func (handler *userDataPuttingHandler) Handle(log *logrus.Entry, writer http.ResponseWriter, request *http.Request) {
+	nextChainRequest = request
+	session := request.Context().Value(common.SessionContextKey).(*common.Session)
+	session.UserData = &common.UserData{
+		Identifier: "user-1",
+		Username:   "Some user with a rather long name",
+		Email:      "some-user@mail.com",
+		Tokens:     handler.tokens,
+	}
+	session.Modified = true
+	writer.WriteHeader(200)
+}
+
+// sessionRemovingHandler ends the session the way the logout handler does
+type sessionRemovingHandler struct {
+}
+
+func (handler *sessionRemovingHandler) Handle(log *logrus.Entry, writer http.ResponseWriter, request *http.Request) {
+	nextChainRequest = request
+	session := request.Context().Value(common.SessionContextKey).(*common.Session)
+	http.SetCookie(writer, &http.Cookie{Name: "sealed-session", MaxAge: -1})
+	session.UserData = nil
+	session.Modified = true
+	session.Removed = true
+	writer.WriteHeader(302)
+}
@@ -2,6 +2,7 @@ package filters
 
 import (
 	"github.com/Alcereo/ordinator/pkg/common"
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cast"
 	"net/http"
 	"net/http/httptest"
@@ -21,7 +22,7 @@ func TestNewSessionCreate(t *testing.T) {
 	handler.SetNext(&StubHandler{})
 
 	// When
-	handler.Handle(w, req)
+	handler.Handle(logrus.NewEntry(logrus.StandardLogger()), w, req)
 
 	// Then
 	result := w.Result()
@@ -57,7 +58,7 @@ func TestExistingSessionGet(t *testing.T) {
 	w := httptest.NewRecorder()
 
 	// When
-	handler.Handle(w, req)
+	handler.Handle(logrus.NewEntry(logrus.StandardLogger()), w, req)
 
 	// Then
 	value := nextChainRequest.Context().Value(common.SessionContextKey)
@@ -91,7 +92,7 @@ func TestRenewCookie(t *testing.T) {
 	w := httptest.NewRecorder()
 
 	// When
-	handler.Handle(w, req)
+	handler.Handle(logrus.NewEntry(logrus.StandardLogger()), w, req)
 
 	// Then
 	result := w.Result()
@@ -178,6 +179,6 @@ var nextChainRequest *http.Request
 type StubHandler struct {
 }
 
-func (handler *StubHandler) Handle(writer http.ResponseWriter, request *http.Request) {
+func (handler *StubHandler) Handle(log *logrus.Entry, writer http.ResponseWriter, request *http.Request) {
 	nextChainRequest = request
 }
@@ -0,0 +1,180 @@
+package jwks
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+)
+
+type JsonWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyId     string `json:"kid,omitempty"`
+	Use       string `json:"use,omitempty"`
+	Algorithm string `json:"alg,omitempty"`
+	Modulus   string `json:"n,omitempty"`
+	Exponent  string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+}
+
+type JsonWebKeySet struct {
+	Keys []JsonWebKey `json:"keys"`
+}
+
+func Parse(data []byte) (*JsonWebKeySet, error) {
+	var keySet JsonWebKeySet
+	if err := json.Unmarshal(data, &keySet); err != nil {
+		return nil, fmt.Errorf("parsing JWKS error. Reason: %v", err)
+	}
+	return &keySet, nil
+}
+
+// Find returns the key with the given id. Empty kid matches the only key of a single key set.
+func (keySet *JsonWebKeySet) Find(kid string) (*JsonWebKey, bool) {
+	if kid == "" && len(keySet.Keys) == 1 {
+		return &keySet.Keys[0], true
+	}
+	for i := range keySet.Keys {
+		if keySet.Keys[i].KeyId == kid {
+			return &keySet.Keys[i], true
+		}
+	}
+	return nil, false
+}
+
+func (key *JsonWebKey) PublicKey() (crypto.PublicKey, error) {
+	switch key.KeyType {
+	case "RSA":
+		modulus, err := decodeBigInt(key.Modulus)
+		if err != nil {
+			return nil, fmt.Errorf("decoding RSA modulus of key '%v' error. Reason: %v", key.KeyId, err)
+		}
+		exponent, err := decodeBigInt(key.Exponent)
+		if err != nil {
+			return nil, fmt.Errorf("decoding RSA exponent of key '%v' error. Reason: %v", key.KeyId, err)
+		}
+		return &rsa.PublicKey{
+			N: modulus,
+			E: int(exponent.Int64()),
+		}, nil
+	case "EC":
+		curve, err := resolveCurve(key.Curve)
+		if err != nil {
+			return nil, err
+		}
+		x, err := decodeBigInt(key.X)
+		if err != nil {
+			return nil, fmt.Errorf("decoding EC 'x' of key '%v' error. Reason: %v", key.KeyId, err)
+		}
+		y, err := decodeBigInt(key.Y)
+		if err != nil {
+			return nil, fmt.Errorf("decoding EC 'y' of key '%v' error. Reason: %v", key.KeyId, err)
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("EC key '%v' point is not on curve %v", key.KeyId, key.Curve)
+		}
+		return &ecdsa.PublicKey{
+			Curve: curve,
+			X:     x,
+			Y:     y,
+		}, nil
+	case "OKP":
+		if key.Curve != "Ed25519" {
+			return nil, fmt.Errorf("unsupported OKP curve '%v'", key.Curve)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(key.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("decoding Ed25519 'x' of key '%v' error", key.KeyId)
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type '%v' of key '%v'", key.KeyType, key.KeyId)
+	}
+}
+
+// NewJsonWebKey publishes the public key for verifying signatures of the algorithm.
+// Empty key id is replaced with the key thumbprint.
+func NewJsonWebKey(kid string, algorithm string, publicKey crypto.PublicKey) (*JsonWebKey, error) {
+	key := &JsonWebKey{
+		KeyId:     kid,
+		Use:       "sig",
+		Algorithm: algorithm,
+	}
+	switch publicKey := publicKey.(type) {
+	case *rsa.PublicKey:
+		key.KeyType = "RSA"
+		key.Modulus = base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes())
+		key.Exponent = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes())
+	case *ecdsa.PublicKey:
+		key.KeyType = "EC"
+		key.Curve = publicKey.Curve.Params().Name
+		size := (publicKey.Curve.Params().BitSize + 7) / 8
+		key.X = base64.RawURLEncoding.EncodeToString(padded(publicKey.X.Bytes(), size))
+		key.Y = base64.RawURLEncoding.EncodeToString(padded(publicKey.Y.Bytes(), size))
+	case ed25519.PublicKey:
+		key.KeyType = "OKP"
+		key.Curve = "Ed25519"
+		key.X = base64.RawURLEncoding.EncodeToString(publicKey)
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", publicKey)
+	}
+	if key.KeyId == "" {
+		key.KeyId = key.Thumbprint()
+	}
+	return key, nil
+}
+
+// Thumbprint is the RFC 7638 SHA-256 thumbprint of the key
+func (key *JsonWebKey) Thumbprint() string {
+	var members string
+	switch key.KeyType {
+	case "RSA":
+		members = fmt.Sprintf(`{"e":"%s","kty":"RSA","n":"%s"}`, key.Exponent, key.Modulus)
+	case "EC":
+		members = fmt.Sprintf(`{"crv":"%s","kty":"EC","x":"%s","y":"%s"}`, key.Curve, key.X, key.Y)
+	default:
+		members = fmt.Sprintf(`{"crv":"%s","kty":"%s","x":"%s"}`, key.Curve, key.KeyType, key.X)
+	}
+	sum := sha256.Sum256([]byte(members))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// EC coordinates are encoded with the full length of the curve
+func padded(bytes []byte, size int) []byte {
+	if len(bytes) >= size {
+		return bytes
+	}
+	return append(make([]byte, size-len(bytes)), bytes...)
+}
+
+func resolveCurve(name string) (elliptic.Curve, error) {
+	switch name {
+	case "P-256":
+		return elliptic.P256(), nil
+	case "P-384":
+		return elliptic.P384(), nil
+	case "P-521":
+		return elliptic.P521(), nil
+	default:
+		return nil, fmt.Errorf("unsupported EC curve '%v'", name)
+	}
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	if value == "" {
+		return nil, fmt.Errorf("value is empty")
+	}
+	bytes, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(bytes), nil
+}
@@ -0,0 +1,30 @@
+package jwks
+
+import (
+	"encoding/json"
+	"github.com/sirupsen/logrus"
+	"net/http"
+)
+
+// keySetHandler publishes public keys, so backends can verify tokens signed by the gateway
+type keySetHandler struct {
+	keySet func() *JsonWebKeySet
+}
+
+func NewKeySetHandler(keySet func() *JsonWebKeySet) *keySetHandler {
+	return &keySetHandler{
+		keySet: keySet,
+	}
+}
+
+func (handler *keySetHandler) Handle(log *logrus.Entry, writer http.ResponseWriter, request *http.Request) {
+	body, err := json.Marshal(handler.keySet())
+	if err != nil {
+		log.Errorf("Key set marshalling error: %v", err)
+		writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Header().Set("Cache-Control", "public, max-age=300")
+	_, _ = writer.Write(body)
+}
@@ -0,0 +1,140 @@
+package jwks
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type KeySource interface {
+	Key(kid string) (crypto.PublicKey, error)
+}
+
+// Local key set, read once on start
+
+type fileKeySource struct {
+	path   string
+	keySet *JsonWebKeySet
+}
+
+func NewFileKeySource(path string) (*fileKeySource, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading JWKS file %v error. Reason: %v", path, err)
+	}
+	keySet, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	return &fileKeySource{
+		path:   path,
+		keySet: keySet,
+	}, nil
+}
+
+func (source *fileKeySource) Key(kid string) (crypto.PublicKey, error) {
+	key, found := source.keySet.Find(kid)
+	if !found {
+		return nil, fmt.Errorf("key '%v' not found in JWKS file %v", kid, source.path)
+	}
+	return key.PublicKey()
+}
+
+// Remote key set. Keys are fetched lazily and fetched again when an unknown key id appears,
+// but not more often than refreshInterval, so provider key rotation is picked up automatically.
+
+type remoteKeySource struct {
+	url             string
+	refreshInterval time.Duration
+	client          *http.Client
+	mutex           sync.Mutex
+	keySet          *JsonWebKeySet
+	fetchedAt       time.Time
+}
+
+func NewRemoteKeySource(url string, refreshInterval time.Duration) *remoteKeySource {
+	return &remoteKeySource{
+		url:             url,
+		refreshInterval: refreshInterval,
+		client:          &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (source *remoteKeySource) Key(kid string) (crypto.PublicKey, error) {
+	source.mutex.Lock()
+	defer source.mutex.Unlock()
+
+	if source.keySet != nil {
+		if key, found := source.keySet.Find(kid); found {
+			return key.PublicKey()
+		}
+		if time.Since(source.fetchedAt) < source.refreshInterval {
+			return nil, fmt.Errorf("key '%v' not found in JWKS %v", kid, source.url)
+		}
+	}
+
+	keySet, err := source.fetch()
+	if err != nil {
+		return nil, err
+	}
+	source.keySet = keySet
+	source.fetchedAt = time.Now()
+
+	key, found := keySet.Find(kid)
+	if !found {
+		return nil, fmt.Errorf("key '%v' not found in JWKS %v", kid, source.url)
+	}
+	return key.PublicKey()
+}
+
+func (source *remoteKeySource) fetch() (*JsonWebKeySet, error) {
+	resp, err := source.client.Get(source.url)
+	if err != nil {
+		return nil, fmt.Errorf("fetching JWKS %v error. Reason: %v", source.url, err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("fetching JWKS %v error. Reason: %v", source.url, err)
+	}
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("fetching JWKS %v error. Status: %v", source.url, resp.StatusCode)
+	}
+	return Parse(body)
+}
+
+// Keyfunc resolves verification keys for jwt-go by the 'kid' header.
+// Only asymmetric algorithms are accepted and the key type must match the algorithm.
+func Keyfunc(source KeySource) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, err := source.Key(kid)
+		if err != nil {
+			return nil, err
+		}
+		switch token.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+			if _, ok := key.(*rsa.PublicKey); ok {
+				return key, nil
+			}
+		case *jwt.SigningMethodECDSA:
+			if _, ok := key.(*ecdsa.PublicKey); ok {
+				return key, nil
+			}
+		case *signingMethodEdDSA:
+			if _, ok := key.(ed25519.PublicKey); ok {
+				return key, nil
+			}
+		default:
+			return nil, fmt.Errorf("unsupported signing algorithm '%v'", token.Method.Alg())
+		}
+		return nil, fmt.Errorf("key '%v' doesn't match signing algorithm '%v'", kid, token.Method.Alg())
+	}
+}
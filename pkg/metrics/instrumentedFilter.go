@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"context"
+	"github.com/Alcereo/ordinator/pkg/common"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"strconv"
+)
+
+// instrumentedFilter records whether the filter passed the request down the chain
+// or responded by itself, and with which status.
+type instrumentedFilter struct {
+	name   string
+	filter common.RequestChainedHandler
+}
+
+type filterOutcome struct {
+	passed bool
+}
+
+func InstrumentFilter(name string, filter common.RequestChainedHandler) common.RequestChainedHandler {
+	return &instrumentedFilter{
+		name:   name,
+		filter: filter,
+	}
+}
+
+func (instrumented *instrumentedFilter) SetNext(handler common.RequestHandler) {
+	instrumented.filter.SetNext(&passMarker{
+		owner: instrumented,
+		next:  handler,
+	})
+}
+
+func (instrumented *instrumentedFilter) Handle(log *logrus.Entry, writer http.ResponseWriter, request *http.Request) {
+	outcome := &filterOutcome{}
+	recorder := newStatusRecorder(writer)
+	markedRequest := request.WithContext(context.WithValue(request.Context(), instrumented, outcome))
+
+	instrumented.filter.Handle(log, recorder, markedRequest)
+
+	filterOutcomes.WithLabelValues(instrumented.name, outcome.label(recorder.Status())).Inc()
+}
+
+func (outcome *filterOutcome) label(status int) string {
+	switch {
+	case outcome.passed:
+		return "pass"
+	case status >= 300 && status < 400:
+		return "redirect"
+	default:
+		return strconv.Itoa(status)
+	}
+}
+
+type passMarker struct {
+	owner *instrumentedFilter
+	next  common.RequestHandler
+}
+
+func (marker *passMarker) Handle(log *logrus.Entry, writer http.ResponseWriter, request *http.Request) {
+	if outcome, ok := request.Context().Value(marker.owner).(*filterOutcome); ok {
+		outcome.passed = true
+	}
+	marker.next.Handle(log, writer, request)
+}
@@ -0,0 +1,132 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const namespace = "ordinator"
+
+var registry = prometheus.NewRegistry()
+
+var (
+	routerRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "router_requests_total",
+			Help:      "Requests handled by router pattern, hosts, request method and response status code.",
+		},
+		[]string{"pattern", "hosts", "method", "code"},
+	)
+	routerRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "router_request_duration_seconds",
+			Help:      "Request latency by router pattern, hosts and request method, including filters and upstream.",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"pattern", "hosts", "method"},
+	)
+	filterOutcomes = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "filter_outcomes_total",
+			Help:      "Filter outcomes by filter name: pass, redirect or the status code the filter responded with.",
+		},
+		[]string{"filter", "outcome"},
+	)
+	upstreamResponses = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "upstream_responses_total",
+			Help:      "Upstream responses by target host and status code, 'error' for failed requests.",
+		},
+		[]string{"target", "code"},
+	)
+	oauthRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "oauth_request_duration_seconds",
+			Help:      "Authorization provider request latency by provider, operation and result.",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"provider", "operation", "result"},
+	)
+	cacheLookups = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "cache_lookups_total",
+			Help:      "Cache adapter lookups by adapter identifier, entry kind and result: hit or miss.",
+		},
+		[]string{"adapter", "kind", "result"},
+	)
+)
+
+func init() {
+	registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		routerRequests,
+		routerRequestDuration,
+		filterOutcomes,
+		upstreamResponses,
+		oauthRequestDuration,
+		cacheLookups,
+	)
+}
+
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// InstrumentRouter counts requests and observes latency of the router handler.
+// Routers sharing a pattern are told apart by their hosts, joined with a comma.
+func InstrumentRouter(pattern string, hosts []string, handler http.HandlerFunc) http.HandlerFunc {
+	hostsLabel := strings.Join(hosts, ",")
+	return func(writer http.ResponseWriter, request *http.Request) {
+		start := time.Now()
+		recorder := newStatusRecorder(writer)
+		handler(recorder, request)
+		method := methodLabel(request.Method)
+		routerRequests.WithLabelValues(pattern, hostsLabel, method, strconv.Itoa(recorder.Status())).Inc()
+		routerRequestDuration.WithLabelValues(pattern, hostsLabel, method).Observe(time.Since(start).Seconds())
+	}
+}
+
+// methodLabel keeps the label cardinality bounded, request methods are client controlled
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return "OTHER"
+}
+
+func ObserveUpstreamResponse(target string, statusCode int) {
+	upstreamResponses.WithLabelValues(target, strconv.Itoa(statusCode)).Inc()
+}
+
+func ObserveUpstreamError(target string) {
+	upstreamResponses.WithLabelValues(target, "error").Inc()
+}
+
+func ObserveOAuthRequest(provider string, operation string, start time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	oauthRequestDuration.WithLabelValues(provider, operation, result).Observe(time.Since(start).Seconds())
+}
+
+func ObserveCacheLookup(adapter string, kind string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	cacheLookups.WithLabelValues(adapter, kind, result).Inc()
+}
@@ -0,0 +1,120 @@
+package metrics
+
+import (
+	"github.com/Alcereo/ordinator/pkg/common"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFilterOutcomes(t *testing.T) {
+	cases := []struct {
+		name    string
+		status  int
+		passes  bool
+		outcome string
+	}{
+		{name: "passing-filter", passes: true, outcome: "pass"},
+		{name: "unauthorized-filter", status: http.StatusUnauthorized, outcome: "401"},
+		{name: "forbidden-filter", status: http.StatusForbidden, outcome: "403"},
+		{name: "redirecting-filter", status: http.StatusFound, outcome: "redirect"},
+		{name: "failing-filter", status: http.StatusInternalServerError, outcome: "500"},
+	}
+	for _, testCase := range cases {
+		// Given
+		filter := InstrumentFilter(testCase.name, &stubFilter{status: testCase.status, passes: testCase.passes})
+		filter.SetNext(&stubHandler{})
+
+		// When
+		filter.Handle(logrus.NewEntry(logrus.StandardLogger()), httptest.NewRecorder(), httptest.NewRequest("GET", "/foo", nil))
+
+		// Then
+		count := testutil.ToFloat64(filterOutcomes.WithLabelValues(testCase.name, testCase.outcome))
+		if count != 1 {
+			t.Fatalf("Expecting outcome %v for filter %v counted once, actual: %v", testCase.outcome, testCase.name, count)
+		}
+	}
+}
+
+func TestNestedFilterOutcomes(t *testing.T) {
+	// Given
+	inner := InstrumentFilter("nested-inner-filter", &stubFilter{status: http.StatusForbidden})
+	inner.SetNext(&stubHandler{})
+	outer := InstrumentFilter("nested-outer-filter", &stubFilter{passes: true})
+	outer.SetNext(inner)
+
+	// When
+	outer.Handle(logrus.NewEntry(logrus.StandardLogger()), httptest.NewRecorder(), httptest.NewRequest("GET", "/foo", nil))
+
+	// Then
+	if testutil.ToFloat64(filterOutcomes.WithLabelValues("nested-outer-filter", "pass")) != 1 {
+		t.Fatalf("Outer filter must be counted as passed")
+	}
+	if testutil.ToFloat64(filterOutcomes.WithLabelValues("nested-inner-filter", "403")) != 1 {
+		t.Fatalf("Inner filter must be counted with its own status")
+	}
+}
+
+func TestRouterRequests(t *testing.T) {
+	// Given
+	handler := InstrumentRouter("/router-test/", []string{"a.example.com", "b.example.com"}, func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusTeapot)
+	})
+
+	// When
+	handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/router-test/foo", nil))
+	handler(httptest.NewRecorder(), httptest.NewRequest("BREW", "/router-test/foo", nil))
+
+	// Then
+	if testutil.ToFloat64(routerRequests.WithLabelValues("/router-test/", "a.example.com,b.example.com", "GET", "418")) != 1 {
+		t.Fatalf("Router request must be counted with hosts, method and response status")
+	}
+	if testutil.ToFloat64(routerRequests.WithLabelValues("/router-test/", "a.example.com,b.example.com", "OTHER", "418")) != 1 {
+		t.Fatalf("Unknown request method must be counted as OTHER")
+	}
+}
+
+func TestHandlerExposesMetrics(t *testing.T) {
+	// Given
+	ObserveCacheLookup("exposed-adapter", "user-data", true)
+
+	// When
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	// Then
+	expected := `ordinator_cache_lookups_total{adapter="exposed-adapter",kind="user-data",result="hit"} 1`
+	if !strings.Contains(w.Body.String(), expected) {
+		t.Fatalf("Expecting exposed metric %v", expected)
+	}
+}
+
+// Internal
+
+type stubFilter struct {
+	next   common.RequestHandler
+	status int
+	passes bool
+}
+
+func (filter *stubFilter) SetNext(handler common.RequestHandler) {
+	filter.next = handler
+}
+
+func (filter *stubFilter) Handle(log *logrus.Entry, writer http.ResponseWriter, request *http.Request) {
+	if filter.passes {
+		filter.next.Handle(log, writer, request)
+		return
+	}
+	writer.WriteHeader(filter.status)
+}
+
+type stubHandler struct {
+}
+
+func (*stubHandler) Handle(log *logrus.Entry, writer http.ResponseWriter, request *http.Request) {
+	writer.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,30 @@
+package metrics
+
+import (
+	"github.com/Alcereo/ordinator/pkg/common"
+	"net/http"
+)
+
+type statusRecorder struct {
+	*common.ResponseWriter
+	status int
+}
+
+func newStatusRecorder(writer http.ResponseWriter) *statusRecorder {
+	recorder := &statusRecorder{}
+	recorder.ResponseWriter = common.WrapResponseWriter(writer, recorder.recordStatus)
+	return recorder
+}
+
+func (recorder *statusRecorder) recordStatus(statusCode int) int {
+	recorder.status = statusCode
+	return statusCode
+}
+
+// Status returns 200 when nothing was written, as the server does
+func (recorder *statusRecorder) Status() int {
+	if recorder.status == 0 {
+		return http.StatusOK
+	}
+	return recorder.status
+}
@@ -0,0 +1,250 @@
+package proxy
+
+import (
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultProbeInterval      = 10 * time.Second
+	defaultProbeTimeout       = 2 * time.Second
+	defaultHealthyThreshold   = 2
+	defaultUnhealthyThreshold = 3
+	defaultEjectionDuration   = 30 * time.Second
+)
+
+// targetHealth combines the active probe state and the passive ejection of a target.
+// Zero value is a healthy target.
+type targetHealth struct {
+	mutex             sync.Mutex
+	probeFailed       bool
+	consecutiveProbes int
+	consecutiveErrors int
+	ejectedUntil      time.Time
+	lastProbeError    string
+}
+
+// Available reports whether the target can receive traffic
+func (target *Target) Available() bool {
+	target.health.mutex.Lock()
+	defer target.health.mutex.Unlock()
+	return !target.health.probeFailed && !time.Now().Before(target.health.ejectedUntil)
+}
+
+type ActiveHealthCheck struct {
+	Path               string
+	Interval           time.Duration
+	Timeout            time.Duration
+	HealthyThreshold   int
+	UnhealthyThreshold int
+}
+
+type PassiveHealthCheck struct {
+	ConsecutiveFailures int
+	Ejection            time.Duration
+}
+
+type TargetHealthStatus struct {
+	Target            string     `json:"target"`
+	Available         bool       `json:"available"`
+	ProbeFailed       bool       `json:"probeFailed"`
+	EjectedUntil      *time.Time `json:"ejectedUntil,omitempty"`
+	ConsecutiveErrors int        `json:"consecutiveErrors"`
+	LastProbeError    string     `json:"lastProbeError,omitempty"`
+	ActiveConnections int64      `json:"activeConnections"`
+}
+
+type RouterHealthStatus struct {
+	Router  string               `json:"router"`
+	Targets []TargetHealthStatus `json:"targets"`
+}
+
+// HealthChecker probes targets of a router in background and ejects targets which
+// keep failing the proxied requests. Both checks are optional.
+type HealthChecker struct {
+	Router  string
+	targets []*Target
+	active  *ActiveHealthCheck
+	passive *PassiveHealthCheck
+	client  *http.Client
+	stop    chan struct{}
+	log     *logrus.Entry
+}
+
+func NewHealthChecker(router string, balancer LoadBalancer, active *ActiveHealthCheck, passive *PassiveHealthCheck) *HealthChecker {
+	if active != nil {
+		if active.Interval <= 0 {
+			active.Interval = defaultProbeInterval
+		}
+		if active.Timeout <= 0 {
+			active.Timeout = defaultProbeTimeout
+		}
+		if active.HealthyThreshold <= 0 {
+			active.HealthyThreshold = defaultHealthyThreshold
+		}
+		if active.UnhealthyThreshold <= 0 {
+			active.UnhealthyThreshold = defaultUnhealthyThreshold
+		}
+	}
+	if passive != nil && passive.Ejection <= 0 {
+		passive.Ejection = defaultEjectionDuration
+	}
+	checker := &HealthChecker{
+		Router:  router,
+		targets: balancer.Targets(),
+		active:  active,
+		passive: passive,
+		stop:    make(chan struct{}),
+		log:     logrus.WithField("router", router),
+	}
+	if active != nil {
+		checker.client = &http.Client{
+			Timeout: active.Timeout,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+		go checker.probePeriodically()
+	}
+	return checker
+}
+
+// Close stops the active probes
+func (checker *HealthChecker) Close() {
+	close(checker.stop)
+}
+
+func (checker *HealthChecker) probePeriodically() {
+	ticker := time.NewTicker(checker.active.Interval)
+	defer ticker.Stop()
+	checker.probeAll()
+	for {
+		select {
+		case <-ticker.C:
+			checker.probeAll()
+		case <-checker.stop:
+			return
+		}
+	}
+}
+
+func (checker *HealthChecker) probeAll() {
+	var wait sync.WaitGroup
+	for _, target := range checker.targets {
+		wait.Add(1)
+		go func(target *Target) {
+			defer wait.Done()
+			checker.recordProbe(target, checker.probe(target))
+		}(target)
+	}
+	wait.Wait()
+}
+
+func (checker *HealthChecker) probe(target *Target) string {
+	probeUrl := target.Address
+	probeUrl.Path = checker.active.Path
+	probeUrl.RawQuery = ""
+	response, err := checker.client.Get(probeUrl.String())
+	if err != nil {
+		return err.Error()
+	}
+	_ = response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return response.Status
+	}
+	return ""
+}
+
+// recordProbe changes the probe state only after threshold of consecutive opposite results
+func (checker *HealthChecker) recordProbe(target *Target, probeError string) {
+	health := &target.health
+	health.mutex.Lock()
+	defer health.mutex.Unlock()
+
+	failed := probeError != ""
+	health.lastProbeError = probeError
+	if failed != health.probeFailed {
+		health.consecutiveProbes++
+	} else {
+		health.consecutiveProbes = 0
+	}
+
+	switch {
+	case failed && !health.probeFailed && health.consecutiveProbes >= checker.active.UnhealthyThreshold:
+		health.probeFailed = true
+		health.consecutiveProbes = 0
+		checker.log.Warnf("Upstream %v failed health probes and is marked unhealthy. Reason: %v", target.Address.Host, probeError)
+	case !failed && health.probeFailed && health.consecutiveProbes >= checker.active.HealthyThreshold:
+		health.probeFailed = false
+		health.consecutiveProbes = 0
+		checker.log.Infof("Upstream %v passed health probes and is marked healthy", target.Address.Host)
+	}
+}
+
+// ObserveResponse counts 5xx responses of proxied requests for the passive check
+func (checker *HealthChecker) ObserveResponse(target *Target, statusCode int) {
+	if checker == nil || checker.passive == nil {
+		return
+	}
+	if statusCode >= 500 {
+		checker.recordFailure(target)
+		return
+	}
+	target.health.mutex.Lock()
+	target.health.consecutiveErrors = 0
+	target.health.mutex.Unlock()
+}
+
+// ObserveError counts connection errors of proxied requests for the passive check
+func (checker *HealthChecker) ObserveError(target *Target) {
+	if checker == nil || checker.passive == nil {
+		return
+	}
+	checker.recordFailure(target)
+}
+
+func (checker *HealthChecker) recordFailure(target *Target) {
+	health := &target.health
+	health.mutex.Lock()
+	defer health.mutex.Unlock()
+
+	health.consecutiveErrors++
+	if health.consecutiveErrors < checker.passive.ConsecutiveFailures || time.Now().Before(health.ejectedUntil) {
+		return
+	}
+	health.consecutiveErrors = 0
+	health.ejectedUntil = time.Now().Add(checker.passive.Ejection)
+	checker.log.Warnf(
+		"Upstream %v ejected until %v after %v consecutive failures",
+		target.Address.Host,
+		health.ejectedUntil.Format(time.RFC3339),
+		checker.passive.ConsecutiveFailures,
+	)
+}
+
+func (checker *HealthChecker) Status() RouterHealthStatus {
+	status := RouterHealthStatus{
+		Router:  checker.Router,
+		Targets: make([]TargetHealthStatus, 0, len(checker.targets)),
+	}
+	for _, target := range checker.targets {
+		target.health.mutex.Lock()
+		targetStatus := TargetHealthStatus{
+			Target:            target.Address.String(),
+			ProbeFailed:       target.health.probeFailed,
+			ConsecutiveErrors: target.health.consecutiveErrors,
+			LastProbeError:    target.health.lastProbeError,
+			ActiveConnections: target.ActiveConnections(),
+		}
+		if time.Now().Before(target.health.ejectedUntil) {
+			ejectedUntil := target.health.ejectedUntil
+			targetStatus.EjectedUntil = &ejectedUntil
+		}
+		target.health.mutex.Unlock()
+		targetStatus.Available = target.Available()
+		status.Targets = append(status.Targets, targetStatus)
+	}
+	return status
+}
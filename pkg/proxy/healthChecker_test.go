@@ -0,0 +1,160 @@
+package proxy
+
+import (
+	"encoding/json"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestActiveHealthCheck(t *testing.T) {
+	// Given
+	var healthy int32 = 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" || atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	address, _ := url.Parse(server.URL)
+	balancer := NewRoundRobinBalancer([]url.URL{*address})
+	checker := NewHealthChecker("/api/", balancer, &ActiveHealthCheck{
+		Path:               "/health",
+		Interval:           10 * time.Millisecond,
+		HealthyThreshold:   2,
+		UnhealthyThreshold: 2,
+	}, nil)
+	defer checker.Close()
+	target := balancer.Targets()[0]
+
+	// When
+	atomic.StoreInt32(&healthy, 0)
+
+	// Then
+	waitFor(t, "target marked unhealthy", func() bool { return !target.Available() })
+	if balancer.Choose(httptest.NewRequest("GET", "/foo", nil)) != nil {
+		t.Fatalf("Unhealthy target must not be chosen")
+	}
+
+	// When
+	atomic.StoreInt32(&healthy, 1)
+
+	// Then
+	waitFor(t, "target marked healthy", target.Available)
+}
+
+func TestPassiveEjection(t *testing.T) {
+	// Given
+	balancer := NewRoundRobinBalancer(targetAddresses(2))
+	checker := NewHealthChecker("/api/", balancer, nil, &PassiveHealthCheck{
+		ConsecutiveFailures: 3,
+		Ejection:            50 * time.Millisecond,
+	})
+	defer checker.Close()
+	failing := balancer.Targets()[0]
+
+	// When
+	checker.ObserveResponse(failing, http.StatusInternalServerError)
+	checker.ObserveError(failing)
+
+	// Then
+	if !failing.Available() {
+		t.Fatalf("Target must not be ejected before consecutive failures threshold")
+	}
+
+	// When
+	checker.ObserveResponse(failing, http.StatusBadGateway)
+
+	// Then
+	if failing.Available() {
+		t.Fatalf("Target must be ejected after consecutive failures")
+	}
+	for i := 0; i < 4; i++ {
+		if balancer.Choose(httptest.NewRequest("GET", "/foo", nil)) == failing {
+			t.Fatalf("Ejected target must not be chosen")
+		}
+	}
+	if checker.Status().Targets[0].EjectedUntil == nil {
+		t.Fatalf("Ejection must be exposed in the status")
+	}
+	waitFor(t, "target re-admitted after cooldown", failing.Available)
+}
+
+func TestPassiveSuccessResetsFailures(t *testing.T) {
+	// Given
+	balancer := NewRoundRobinBalancer(targetAddresses(1))
+	checker := NewHealthChecker("/api/", balancer, nil, &PassiveHealthCheck{ConsecutiveFailures: 2})
+	defer checker.Close()
+	target := balancer.Targets()[0]
+
+	// When
+	checker.ObserveError(target)
+	checker.ObserveResponse(target, http.StatusOK)
+	checker.ObserveError(target)
+
+	// Then
+	if !target.Available() {
+		t.Fatalf("Failures which are not consecutive must not eject the target")
+	}
+}
+
+func TestNoAvailableTargets(t *testing.T) {
+	// Given
+	balancer := NewRoundRobinBalancer(targetAddresses(1))
+	checker := NewHealthChecker("/api/", balancer, nil, &PassiveHealthCheck{ConsecutiveFailures: 1})
+	defer checker.Close()
+	checker.ObserveError(balancer.Targets()[0])
+	handler := NewReverseProxyHandler(balancer, checker, nil, NewTransport(TransportSettings{}), StreamingSettings{})
+
+	// When
+	w := httptest.NewRecorder()
+	handler.Handle(logrus.NewEntry(logrus.StandardLogger()), w, httptest.NewRequest("GET", "/foo", nil))
+
+	// Then
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expecting %v without available targets, actual: %v", http.StatusServiceUnavailable, w.Code)
+	}
+}
+
+func TestHealthStatusHandler(t *testing.T) {
+	// Given
+	balancer := NewRoundRobinBalancer(targetAddresses(2))
+	checker := NewHealthChecker("/api/", balancer, nil, &PassiveHealthCheck{ConsecutiveFailures: 1})
+	defer checker.Close()
+	checker.ObserveError(balancer.Targets()[1])
+	handler := NewHealthStatusHandler(func() []*HealthChecker {
+		return []*HealthChecker{checker}
+	})
+
+	// When
+	w := httptest.NewRecorder()
+	handler.Handle(logrus.NewEntry(logrus.StandardLogger()), w, httptest.NewRequest("GET", "/admin/upstreams", nil))
+
+	// Then
+	var statuses []RouterHealthStatus
+	if err := json.Unmarshal(w.Body.Bytes(), &statuses); err != nil {
+		t.Fatalf("Status response parsing error: %v", err)
+	}
+	if len(statuses) != 1 || statuses[0].Router != "/api/" || len(statuses[0].Targets) != 2 {
+		t.Fatalf("Unexpected status: %+v", statuses)
+	}
+	if !statuses[0].Targets[0].Available || statuses[0].Targets[1].Available {
+		t.Fatalf("Expecting only the first target available: %+v", statuses[0].Targets)
+	}
+}
+
+// Internal
+
+func waitFor(t *testing.T, description string, condition func() bool) {
+	deadline := time.Now().Add(2 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timeout waiting for: %v", description)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
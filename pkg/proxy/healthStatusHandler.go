@@ -0,0 +1,33 @@
+package proxy
+
+import (
+	"encoding/json"
+	"github.com/sirupsen/logrus"
+	"net/http"
+)
+
+// healthStatusHandler is an admin endpoint exposing upstream health state of all routers
+type healthStatusHandler struct {
+	checkers func() []*HealthChecker
+}
+
+func NewHealthStatusHandler(checkers func() []*HealthChecker) *healthStatusHandler {
+	return &healthStatusHandler{
+		checkers: checkers,
+	}
+}
+
+func (handler *healthStatusHandler) Handle(log *logrus.Entry, writer http.ResponseWriter, request *http.Request) {
+	statuses := make([]RouterHealthStatus, 0)
+	for _, checker := range handler.checkers() {
+		statuses = append(statuses, checker.Status())
+	}
+	body, err := json.Marshal(statuses)
+	if err != nil {
+		log.Errorf("Health status marshalling error: %v", err)
+		writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	_, _ = writer.Write(body)
+}
@@ -0,0 +1,163 @@
+package proxy
+
+import (
+	"github.com/Alcereo/ordinator/pkg/common"
+	"hash/crc32"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync/atomic"
+)
+
+const consistentHashReplicas = 100
+
+type Target struct {
+	Address           url.URL
+	activeConnections int64
+	health            targetHealth
+}
+
+func (target *Target) ActiveConnections() int64 {
+	return atomic.LoadInt64(&target.activeConnections)
+}
+
+func (target *Target) acquire() {
+	atomic.AddInt64(&target.activeConnections, 1)
+}
+
+func (target *Target) release() {
+	atomic.AddInt64(&target.activeConnections, -1)
+}
+
+// Choose returns nil when none of the targets is available
+type LoadBalancer interface {
+	Targets() []*Target
+	Choose(request *http.Request) *Target
+}
+
+func newTargets(addresses []url.URL) []*Target {
+	targets := make([]*Target, len(addresses))
+	for i, address := range addresses {
+		targets[i] = &Target{Address: address}
+	}
+	return targets
+}
+
+// Round robin
+
+type roundRobinBalancer struct {
+	targets []*Target
+	counter uint64
+}
+
+func NewRoundRobinBalancer(addresses []url.URL) *roundRobinBalancer {
+	return &roundRobinBalancer{
+		targets: newTargets(addresses),
+	}
+}
+
+func (balancer *roundRobinBalancer) Targets() []*Target {
+	return balancer.targets
+}
+
+func (balancer *roundRobinBalancer) Choose(request *http.Request) *Target {
+	start := atomic.AddUint64(&balancer.counter, 1) - 1
+	for i := range balancer.targets {
+		target := balancer.targets[(start+uint64(i))%uint64(len(balancer.targets))]
+		if target.Available() {
+			return target
+		}
+	}
+	return nil
+}
+
+// Least connections
+
+type leastConnectionsBalancer struct {
+	roundRobin *roundRobinBalancer
+}
+
+func NewLeastConnectionsBalancer(addresses []url.URL) *leastConnectionsBalancer {
+	return &leastConnectionsBalancer{
+		roundRobin: NewRoundRobinBalancer(addresses),
+	}
+}
+
+func (balancer *leastConnectionsBalancer) Targets() []*Target {
+	return balancer.roundRobin.targets
+}
+
+// Choose starts scanning from the round robin position, so ties are spread across targets
+func (balancer *leastConnectionsBalancer) Choose(request *http.Request) *Target {
+	targets := balancer.roundRobin.targets
+	start := atomic.AddUint64(&balancer.roundRobin.counter, 1) - 1
+	var chosen *Target
+	for i := range targets {
+		target := targets[(start+uint64(i))%uint64(len(targets))]
+		if !target.Available() {
+			continue
+		}
+		if chosen == nil || target.ActiveConnections() < chosen.ActiveConnections() {
+			chosen = target
+		}
+	}
+	return chosen
+}
+
+// Consistent hash by session id
+
+type consistentHashBalancer struct {
+	targets  []*Target
+	ring     []uint32
+	ringNode map[uint32]*Target
+	fallback *roundRobinBalancer
+}
+
+// NewConsistentHashBalancer pins a session to a target, only sessions of an added or removed
+// target are moved. Requests without session are balanced with round robin.
+func NewConsistentHashBalancer(addresses []url.URL) *consistentHashBalancer {
+	fallback := NewRoundRobinBalancer(addresses)
+	balancer := &consistentHashBalancer{
+		targets:  fallback.targets,
+		ringNode: make(map[uint32]*Target),
+		fallback: fallback,
+	}
+	for _, target := range balancer.targets {
+		for replica := 0; replica < consistentHashReplicas; replica++ {
+			hash := crc32.ChecksumIEEE([]byte(strconv.Itoa(replica) + "-" + target.Address.String()))
+			if _, taken := balancer.ringNode[hash]; taken {
+				continue
+			}
+			balancer.ring = append(balancer.ring, hash)
+			balancer.ringNode[hash] = target
+		}
+	}
+	sort.Slice(balancer.ring, func(i, j int) bool {
+		return balancer.ring[i] < balancer.ring[j]
+	})
+	return balancer
+}
+
+func (balancer *consistentHashBalancer) Targets() []*Target {
+	return balancer.targets
+}
+
+func (balancer *consistentHashBalancer) Choose(request *http.Request) *Target {
+	session, ok := request.Context().Value(common.SessionContextKey).(*common.Session)
+	if !ok || session == nil || session.Id == "" {
+		return balancer.fallback.Choose(request)
+	}
+	hash := crc32.ChecksumIEEE([]byte(session.Id))
+	index := sort.Search(len(balancer.ring), func(i int) bool {
+		return balancer.ring[i] >= hash
+	})
+	// Sessions of an unavailable target are moved to the next target on the ring
+	for i := 0; i < len(balancer.ring); i++ {
+		target := balancer.ringNode[balancer.ring[(index+i)%len(balancer.ring)]]
+		if target.Available() {
+			return target
+		}
+	}
+	return nil
+}
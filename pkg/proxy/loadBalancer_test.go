@@ -0,0 +1,145 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"github.com/Alcereo/ordinator/pkg/common"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestRoundRobinBalancing(t *testing.T) {
+	// Given
+	balancer := NewRoundRobinBalancer(targetAddresses(3))
+	chosen := make(map[string]int)
+
+	// When
+	for i := 0; i < 6; i++ {
+		chosen[balancer.Choose(httptest.NewRequest("GET", "/foo", nil)).Address.Host]++
+	}
+
+	// Then
+	for _, target := range balancer.Targets() {
+		if chosen[target.Address.Host] != 2 {
+			t.Fatalf("Expecting target %v chosen 2 times, actual: %v", target.Address.Host, chosen[target.Address.Host])
+		}
+	}
+}
+
+func TestLeastConnectionsBalancing(t *testing.T) {
+	// Given
+	balancer := NewLeastConnectionsBalancer(targetAddresses(3))
+	targets := balancer.Targets()
+	targets[0].acquire()
+	targets[0].acquire()
+	targets[2].acquire()
+
+	// When
+	chosen := balancer.Choose(httptest.NewRequest("GET", "/foo", nil))
+
+	// Then
+	if chosen != targets[1] {
+		t.Fatalf("Expecting idle target %v, actual: %v", targets[1].Address.Host, chosen.Address.Host)
+	}
+}
+
+func TestConsistentHashBalancing(t *testing.T) {
+	// Given
+	balancer := NewConsistentHashBalancer(targetAddresses(3))
+
+	// When
+	first := balancer.Choose(sessionRequest("session-1"))
+	second := balancer.Choose(sessionRequest("session-1"))
+
+	// Then
+	if first != second {
+		t.Fatalf("Requests of the same session must be sent to the same target")
+	}
+}
+
+func TestConsistentHashRemovedTargetMovesOnlyItsSessions(t *testing.T) {
+	// Given
+	addresses := targetAddresses(4)
+	balancer := NewConsistentHashBalancer(addresses)
+	reduced := NewConsistentHashBalancer(addresses[:3])
+
+	// When
+	moved := 0
+	for i := 0; i < 200; i++ {
+		request := sessionRequest(fmt.Sprintf("session-%v", i))
+		before := balancer.Choose(request).Address.Host
+		after := reduced.Choose(request).Address.Host
+		if before != after && before != addresses[3].Host {
+			moved++
+		}
+	}
+
+	// Then
+	if moved != 0 {
+		t.Fatalf("Sessions of remaining targets must not move, moved: %v", moved)
+	}
+}
+
+func TestConsistentHashWithoutSession(t *testing.T) {
+	// Given
+	balancer := NewConsistentHashBalancer(targetAddresses(2))
+
+	// When
+	first := balancer.Choose(httptest.NewRequest("GET", "/foo", nil))
+	second := balancer.Choose(httptest.NewRequest("GET", "/foo", nil))
+
+	// Then
+	if first == second {
+		t.Fatalf("Requests without session must be balanced with round robin")
+	}
+}
+
+func TestBalancedRouting(t *testing.T) {
+	// Given
+	var hits []string
+	var addresses []url.URL
+	for _, name := range []string{"first", "second"} {
+		name := name
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits = append(hits, name)
+		}))
+		defer server.Close()
+		address, _ := url.Parse(server.URL)
+		addresses = append(addresses, *address)
+	}
+	handler := NewReverseProxyHandler(NewRoundRobinBalancer(addresses), nil, nil, NewTransport(TransportSettings{}), StreamingSettings{})
+
+	// When
+	for i := 0; i < 2; i++ {
+		handler.Handle(logrus.NewEntry(logrus.StandardLogger()), httptest.NewRecorder(), httptest.NewRequest("GET", "/foo", nil))
+	}
+
+	// Then
+	if len(hits) != 2 || hits[0] != "first" || hits[1] != "second" {
+		t.Fatalf("Expecting requests sent to both targets, actual: %v", hits)
+	}
+	for _, target := range handler.Balancer.Targets() {
+		if target.ActiveConnections() != 0 {
+			t.Fatalf("Connections must be released after response")
+		}
+	}
+}
+
+// Internal
+
+func targetAddresses(count int) []url.URL {
+	var addresses []url.URL
+	for i := 0; i < count; i++ {
+		addresses = append(addresses, url.URL{Scheme: "http", Host: fmt.Sprintf("backend-%v:8080", i)})
+	}
+	return addresses
+}
+
+func sessionRequest(sessionId string) *http.Request {
+	request := httptest.NewRequest("GET", "/foo", nil)
+	session := &common.Session{Id: common.SessionId(sessionId)}
+	return request.WithContext(context.WithValue(request.Context(), common.SessionContextKey, session))
+}
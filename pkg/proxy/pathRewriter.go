@@ -0,0 +1,129 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+type RewriteRule struct {
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+// PathRewriter maps the public request path to the upstream path: prefix is stripped,
+// regex rules are applied in order, then prefix is added.
+type PathRewriter struct {
+	StripPrefix string
+	AddPrefix   string
+	Rules       []RewriteRule
+}
+
+// NewRewriteRule compiles the pattern, replacement may refer capture groups as $1 or ${name}
+func NewRewriteRule(pattern string, replacement string) (RewriteRule, error) {
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		return RewriteRule{}, fmt.Errorf("rewrite pattern '%v' compilation error: %v", pattern, err)
+	}
+	return RewriteRule{
+		Pattern:     compiled,
+		Replacement: replacement,
+	}, nil
+}
+
+func (rewriter *PathRewriter) Rewrite(path string) string {
+	if rewriter == nil {
+		return path
+	}
+	if rewriter.StripPrefix != "" && strings.HasPrefix(path, rewriter.StripPrefix) {
+		path = ensureLeadingSlash(strings.TrimPrefix(path, rewriter.StripPrefix))
+	}
+	for _, rule := range rewriter.Rules {
+		path = rule.Pattern.ReplaceAllString(path, rule.Replacement)
+	}
+	if rewriter.AddPrefix != "" {
+		path = singleJoiningSlash(rewriter.AddPrefix, path)
+	}
+	return path
+}
+
+// RewriteUrl rewrites the escaped path, so encoded characters like '%2F' aren't decoded
+// into path separators on the way to the upstream
+func (rewriter *PathRewriter) RewriteUrl(requestUrl *url.URL) *url.URL {
+	rewritten := *requestUrl
+	escaped := rewriter.Rewrite(requestUrl.EscapedPath())
+	path, err := url.PathUnescape(escaped)
+	if err != nil {
+		// Replacement broke an escape sequence, the decoded path is rewritten instead
+		rewritten.Path = rewriter.Rewrite(requestUrl.Path)
+		rewritten.RawPath = ""
+		return &rewritten
+	}
+	rewritten.Path = path
+	rewritten.RawPath = escaped
+	return &rewritten
+}
+
+// RewriteLocation maps an upstream redirect back to the public path. Only prefixes are
+// reverted, regex rules can't be reverted in general.
+func (rewriter *PathRewriter) RewriteLocation(response *http.Response, target url.URL) {
+	location := response.Header.Get("Location")
+	if rewriter == nil || location == "" {
+		return
+	}
+	locationUrl, err := url.Parse(location)
+	if err != nil {
+		return
+	}
+	publicHost := response.Request.Host
+	if locationUrl.Host != "" && locationUrl.Host != target.Host && locationUrl.Host != publicHost {
+		return
+	}
+	if locationUrl.Host == "" && !strings.HasPrefix(locationUrl.Path, "/") {
+		// Relative to the current path, stays valid
+		return
+	}
+
+	upstreamPrefix := singleJoiningSlash(target.EscapedPath(), rewriter.AddPrefix)
+	escaped, found := trimPathPrefix(locationUrl.EscapedPath(), upstreamPrefix)
+	if !found {
+		return
+	}
+	if rewriter.StripPrefix != "" {
+		escaped = singleJoiningSlash(rewriter.StripPrefix, escaped)
+	}
+	path, err := url.PathUnescape(escaped)
+	if err != nil {
+		return
+	}
+
+	locationUrl.Path = path
+	locationUrl.RawPath = escaped
+	if locationUrl.Host == target.Host {
+		// Host relative, the browser keeps the public host
+		locationUrl.Scheme = ""
+		locationUrl.Host = ""
+		locationUrl.User = nil
+	}
+	response.Header.Set("Location", locationUrl.String())
+}
+
+func trimPathPrefix(path string, prefix string) (string, bool) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix == "" {
+		return ensureLeadingSlash(path), true
+	}
+	if path != prefix && !strings.HasPrefix(path, prefix+"/") {
+		return path, false
+	}
+	return ensureLeadingSlash(strings.TrimPrefix(path, prefix)), true
+}
+
+func ensureLeadingSlash(path string) string {
+	if !strings.HasPrefix(path, "/") {
+		return "/" + path
+	}
+	return path
+}
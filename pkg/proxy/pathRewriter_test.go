@@ -0,0 +1,105 @@
+package proxy
+
+import (
+	"github.com/magiconair/properties/assert"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestPathRewrite(t *testing.T) {
+	versionRule, err := NewRewriteRule(`^/users/(\d+)/profile$`, "/profiles/$1")
+	if err != nil {
+		t.Fatalf("Rewrite rule compilation error: %v", err)
+	}
+	cases := []struct {
+		rewriter PathRewriter
+		path     string
+		expected string
+	}{
+		{PathRewriter{StripPrefix: "/api/v1/"}, "/api/v1/users", "/users"},
+		{PathRewriter{StripPrefix: "/api/v1"}, "/api/v1", "/"},
+		{PathRewriter{StripPrefix: "/api/v1/"}, "/other/users", "/other/users"},
+		{PathRewriter{AddPrefix: "/internal/"}, "/users", "/internal/users"},
+		{PathRewriter{StripPrefix: "/api/v1/", AddPrefix: "/v1"}, "/api/v1/users", "/v1/users"},
+		{PathRewriter{StripPrefix: "/api/", Rules: []RewriteRule{versionRule}}, "/api/users/42/profile", "/profiles/42"},
+	}
+	for _, testCase := range cases {
+		assert.Equal(t, testCase.rewriter.Rewrite(testCase.path), testCase.expected)
+	}
+}
+
+func TestInvalidRewriteRule(t *testing.T) {
+	if _, err := NewRewriteRule(`(unclosed`, "$1"); err == nil {
+		t.Fatalf("Invalid pattern must be rejected")
+	}
+}
+
+func TestRewrittenPathForwarded(t *testing.T) {
+	// Given
+	ts := stubServer()
+	defer ts.Close()
+	requestUrl, _ := url.Parse(ts.URL + "/backend")
+	handler := NewReverseProxyHandler(
+		NewRoundRobinBalancer([]url.URL{*requestUrl}),
+		nil,
+		&PathRewriter{StripPrefix: "/api/v1/"},
+		NewTransport(TransportSettings{}),
+		StreamingSettings{},
+	)
+
+	// When
+	handler.Handle(logrus.NewEntry(logrus.StandardLogger()), httptest.NewRecorder(), httptest.NewRequest("GET", "/api/v1/users?page=2", nil))
+
+	// Then
+	assert.Equal(t, stubUri.String(), "/backend/users?page=2")
+}
+
+func TestLocationRewrite(t *testing.T) {
+	rewriter := &PathRewriter{StripPrefix: "/api/v1/", AddPrefix: "/v1"}
+	target := url.URL{Scheme: "http", Host: "backend:8081", Path: "/service"}
+	cases := []struct {
+		location string
+		expected string
+	}{
+		{"/service/v1/login?next=%2F", "/api/v1/login?next=%2F"},
+		{"http://backend:8081/service/v1/users/1", "/api/v1/users/1"},
+		{"http://gateway.example.com/service/v1/users/1", "http://gateway.example.com/api/v1/users/1"},
+		{"https://accounts.example.com/service/v1/login", "https://accounts.example.com/service/v1/login"},
+		{"/elsewhere", "/elsewhere"},
+		{"relative/path", "relative/path"},
+	}
+	for _, testCase := range cases {
+		request := httptest.NewRequest("GET", "http://gateway.example.com/api/v1/users", nil)
+		response := &http.Response{
+			Header:  http.Header{"Location": {testCase.location}},
+			Request: request,
+		}
+		rewriter.RewriteLocation(response, target)
+		assert.Equal(t, response.Header.Get("Location"), testCase.expected)
+	}
+}
+
+func TestRewrittenEncodedPathForwarded(t *testing.T) {
+	// Given
+	ts := stubServer()
+	defer ts.Close()
+	requestUrl, _ := url.Parse(ts.URL + "/backend")
+	handler := NewReverseProxyHandler(
+		NewRoundRobinBalancer([]url.URL{*requestUrl}),
+		nil,
+		&PathRewriter{StripPrefix: "/api/v1/"},
+		NewTransport(TransportSettings{}),
+		StreamingSettings{},
+	)
+
+	// When
+	handler.Handle(logrus.NewEntry(logrus.StandardLogger()), httptest.NewRecorder(), httptest.NewRequest("GET", "/api/v1/files/a%2Fb%3Fc?page=2", nil))
+
+	// Then
+	assert.Equal(t, stubUri.EscapedPath(), "/backend/files/a%2Fb%3Fc")
+	assert.Equal(t, stubUri.Path, "/backend/files/a/b?c")
+	assert.Equal(t, stubUri.RawQuery, "page=2")
+}
@@ -1,17 +1,152 @@
 package proxy
 
 import (
+	"context"
+	"errors"
+	"github.com/Alcereo/ordinator/pkg/metrics"
 	"github.com/sirupsen/logrus"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"strings"
 )
 
+type targetContextKey struct{}
+
+type logContextKey struct{}
+
+// ReverseProxyHandler keeps a single reverse proxy and transport for the router,
+// the target chosen by the balancer is passed to the proxy in the request context.
 type ReverseProxyHandler struct {
-	TargetAddress url.URL
+	Balancer      LoadBalancer
+	HealthChecker *HealthChecker
+	Rewriter      *PathRewriter
+	Streaming     StreamingSettings
+	proxy         *httputil.ReverseProxy
+}
+
+func NewReverseProxyHandler(
+	balancer LoadBalancer,
+	healthChecker *HealthChecker,
+	rewriter *PathRewriter,
+	transport http.RoundTripper,
+	streaming StreamingSettings,
+) *ReverseProxyHandler {
+	handler := &ReverseProxyHandler{
+		Balancer:      balancer,
+		HealthChecker: healthChecker,
+		Rewriter:      rewriter,
+		Streaming:     streaming,
+	}
+	handler.proxy = &httputil.ReverseProxy{
+		Director:       direct,
+		Transport:      transport,
+		FlushInterval:  streaming.FlushInterval,
+		ModifyResponse: handler.modifyResponse,
+		ErrorHandler:   handler.handleError,
+	}
+	return handler
 }
 
 func (router *ReverseProxyHandler) Handle(log *logrus.Entry, writer http.ResponseWriter, request *http.Request) {
-	proxy := httputil.NewSingleHostReverseProxy(&router.TargetAddress)
-	proxy.ServeHTTP(writer, request)
+	target := router.Balancer.Choose(request)
+	if target == nil {
+		log.Errorf("No available upstream targets")
+		writer.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	target.acquire()
+	defer target.release()
+	log = log.WithField("upstream", target.Address.Host)
+
+	ctx := context.WithValue(request.Context(), targetContextKey{}, target)
+	ctx = context.WithValue(ctx, logContextKey{}, log)
+	outgoing := request.WithContext(ctx)
+	if router.Rewriter != nil {
+		outgoing.URL = router.Rewriter.RewriteUrl(request.URL)
+		log.Tracef("Request path rewritten: %v -> %v", request.URL.EscapedPath(), outgoing.URL.EscapedPath())
+	}
+	if router.Streaming.UpgradeIdleTimeout > 0 {
+		writer = &idleTimeoutWriter{
+			ResponseWriter: writer,
+			timeout:        router.Streaming.UpgradeIdleTimeout,
+		}
+	}
+	router.proxy.ServeHTTP(writer, outgoing)
+}
+
+func (router *ReverseProxyHandler) modifyResponse(response *http.Response) error {
+	target := response.Request.Context().Value(targetContextKey{}).(*Target)
+	metrics.ObserveUpstreamResponse(target.Address.Host, response.StatusCode)
+	router.HealthChecker.ObserveResponse(target, response.StatusCode)
+	if router.Rewriter != nil {
+		router.Rewriter.RewriteLocation(response, target.Address)
+	}
+	return nil
+}
+
+func (router *ReverseProxyHandler) handleError(writer http.ResponseWriter, request *http.Request, err error) {
+	target := request.Context().Value(targetContextKey{}).(*Target)
+	log := request.Context().Value(logContextKey{}).(*logrus.Entry)
+	// Client went away, the upstream is not to blame and there is no one to respond to
+	if request.Context().Err() != nil || errors.Is(err, context.Canceled) {
+		log.Debugf("Upstream request canceled by the client: %v", err)
+		return
+	}
+	metrics.ObserveUpstreamError(target.Address.Host)
+	router.HealthChecker.ObserveError(target)
+
+	if isTimeout(err) {
+		log.Errorf("Upstream request timeout: %v", err)
+		writer.WriteHeader(http.StatusGatewayTimeout)
+		return
+	}
+	log.Errorf("Upstream request error: %v", err)
+	writer.WriteHeader(http.StatusBadGateway)
+}
+
+func isTimeout(err error) bool {
+	if err == context.DeadlineExceeded {
+		return true
+	}
+	netErr, ok := err.(net.Error)
+	return ok && netErr.Timeout()
+}
+
+// direct rewrites the request url to the chosen target, as the single host reverse proxy does
+func direct(request *http.Request) {
+	target := request.Context().Value(targetContextKey{}).(*Target).Address
+	request.URL.Scheme = target.Scheme
+	request.URL.Host = target.Host
+	request.URL.Path, request.URL.RawPath = joinUrlPath(&target, request.URL)
+	if target.RawQuery == "" || request.URL.RawQuery == "" {
+		request.URL.RawQuery = target.RawQuery + request.URL.RawQuery
+	} else {
+		request.URL.RawQuery = target.RawQuery + "&" + request.URL.RawQuery
+	}
+	if _, ok := request.Header["User-Agent"]; !ok {
+		// explicitly disable User-Agent so it's not set to default value
+		request.Header.Set("User-Agent", "")
+	}
+}
+
+// joinUrlPath joins the escaped paths too, so encoded characters like '%2F' reach the upstream as sent
+func joinUrlPath(a *url.URL, b *url.URL) (path string, rawPath string) {
+	if a.RawPath == "" && b.RawPath == "" {
+		return singleJoiningSlash(a.Path, b.Path), ""
+	}
+	return singleJoiningSlash(a.Path, b.Path), singleJoiningSlash(a.EscapedPath(), b.EscapedPath())
+}
+
+func singleJoiningSlash(a, b string) string {
+	aslash := strings.HasSuffix(a, "/")
+	bslash := strings.HasPrefix(b, "/")
+	switch {
+	case aslash && bslash:
+		return a + b[1:]
+	case !aslash && !bslash:
+		return a + "/" + b
+	}
+	return a + b
 }
@@ -1,12 +1,17 @@
 package proxy
 
 import (
+	"context"
 	"fmt"
 	"github.com/magiconair/properties/assert"
+	"github.com/sirupsen/logrus"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestRouting(t *testing.T) {
@@ -21,12 +26,10 @@ func TestRouting(t *testing.T) {
 	w := httptest.NewRecorder()
 
 	requestUrl, _ := new(url.URL).Parse(ts.URL + "/some-address")
-	handler := ReverseProxyHandler{
-		TargetAddress: *requestUrl,
-	}
+	handler := NewReverseProxyHandler(NewRoundRobinBalancer([]url.URL{*requestUrl}), nil, nil, NewTransport(TransportSettings{}), StreamingSettings{})
 
 	// When
-	handler.Handle(w, req)
+	handler.Handle(logrus.NewEntry(logrus.StandardLogger()), w, req)
 
 	// Then
 	assert.Equal(t, stubHeader.Get("Content-type"), "application/json")
@@ -46,3 +49,93 @@ func stubServer() *httptest.Server {
 	}))
 	return ts
 }
+
+func TestUpstreamConnectionReused(t *testing.T) {
+	// Given
+	var connections int32
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintln(w, "Hello, client")
+	}))
+	ts.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&connections, 1)
+		}
+	}
+	ts.Start()
+	defer ts.Close()
+	requestUrl, _ := url.Parse(ts.URL)
+	handler := NewReverseProxyHandler(NewRoundRobinBalancer([]url.URL{*requestUrl}), nil, nil, NewTransport(TransportSettings{}), StreamingSettings{})
+
+	// When
+	for i := 0; i < 3; i++ {
+		handler.Handle(logrus.NewEntry(logrus.StandardLogger()), httptest.NewRecorder(), httptest.NewRequest("GET", "/foo", nil))
+	}
+
+	// Then
+	assert.Equal(t, atomic.LoadInt32(&connections), int32(1))
+}
+
+func TestUpstreamUnavailable(t *testing.T) {
+	// Given
+	ts := stubServer()
+	requestUrl, _ := url.Parse(ts.URL)
+	ts.Close()
+	handler := NewReverseProxyHandler(NewRoundRobinBalancer([]url.URL{*requestUrl}), nil, nil, NewTransport(TransportSettings{}), StreamingSettings{})
+
+	// When
+	w := httptest.NewRecorder()
+	handler.Handle(logrus.NewEntry(logrus.StandardLogger()), w, httptest.NewRequest("GET", "/foo", nil))
+
+	// Then
+	assert.Equal(t, w.Code, http.StatusBadGateway)
+}
+
+func TestUpstreamTimeout(t *testing.T) {
+	// Given
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer ts.Close()
+	defer close(release)
+	requestUrl, _ := url.Parse(ts.URL)
+	handler := NewReverseProxyHandler(
+		NewRoundRobinBalancer([]url.URL{*requestUrl}),
+		nil,
+		nil,
+		NewTransport(TransportSettings{ResponseHeaderTimeout: 50 * time.Millisecond}),
+		StreamingSettings{},
+	)
+
+	// When
+	w := httptest.NewRecorder()
+	handler.Handle(logrus.NewEntry(logrus.StandardLogger()), w, httptest.NewRequest("GET", "/foo", nil))
+
+	// Then
+	assert.Equal(t, w.Code, http.StatusGatewayTimeout)
+}
+
+func TestClientCancellationKeepsTargetHealthy(t *testing.T) {
+	// Given
+	ts := stubServer()
+	defer ts.Close()
+	requestUrl, _ := url.Parse(ts.URL)
+	balancer := NewRoundRobinBalancer([]url.URL{*requestUrl})
+	checker := NewHealthChecker("/api/", balancer, nil, &PassiveHealthCheck{ConsecutiveFailures: 1})
+	defer checker.Close()
+	handler := NewReverseProxyHandler(balancer, checker, nil, NewTransport(TransportSettings{}), StreamingSettings{})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// When
+	w := httptest.NewRecorder()
+	handler.Handle(logrus.NewEntry(logrus.StandardLogger()), w, httptest.NewRequest("GET", "/foo", nil).WithContext(ctx))
+
+	// Then
+	if !balancer.Targets()[0].Available() {
+		t.Fatalf("Target must stay healthy when the client cancels the request")
+	}
+	if w.Flushed || len(w.Header()) != 0 || w.Body.Len() != 0 {
+		t.Fatalf("Nothing must be written to the canceled client")
+	}
+}
@@ -0,0 +1,67 @@
+package proxy
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// StreamingSettings of the router. Negative flush interval flushes after each write,
+// server-sent events are always flushed immediately. Zero idle timeout keeps upgraded
+// connections open until one of the sides closes it.
+type StreamingSettings struct {
+	FlushInterval      time.Duration
+	UpgradeIdleTimeout time.Duration
+}
+
+// idleTimeoutWriter closes upgraded connections, like WebSocket, without traffic in both directions
+type idleTimeoutWriter struct {
+	http.ResponseWriter
+	timeout time.Duration
+}
+
+func (writer *idleTimeoutWriter) Flush() {
+	if flusher, ok := writer.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (writer *idleTimeoutWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := writer.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer %T doesn't support hijacking", writer.ResponseWriter)
+	}
+	conn, readWriter, err := hijacker.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	idleConn := &idleTimeoutConn{Conn: conn, timeout: writer.timeout}
+	idleConn.extendDeadline()
+	return idleConn, readWriter, nil
+}
+
+// idleTimeoutConn extends the deadline of both directions on any traffic,
+// so a blocked read is interrupted only when the connection is idle
+type idleTimeoutConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (conn *idleTimeoutConn) Read(bytes []byte) (int, error) {
+	read, err := conn.Conn.Read(bytes)
+	if read > 0 {
+		conn.extendDeadline()
+	}
+	return read, err
+}
+
+func (conn *idleTimeoutConn) Write(bytes []byte) (int, error) {
+	conn.extendDeadline()
+	return conn.Conn.Write(bytes)
+}
+
+func (conn *idleTimeoutConn) extendDeadline() {
+	_ = conn.Conn.SetDeadline(time.Now().Add(conn.timeout))
+}
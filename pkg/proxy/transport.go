@@ -0,0 +1,53 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultDialTimeout           = 30 * time.Second
+	defaultTLSHandshakeTimeout   = 10 * time.Second
+	defaultResponseHeaderTimeout = 60 * time.Second
+	defaultIdleConnTimeout       = 90 * time.Second
+	defaultMaxIdleConnsPerHost   = 64
+)
+
+// TransportSettings zero values are replaced with defaults
+type TransportSettings struct {
+	DialTimeout           time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration
+	IdleConnTimeout       time.Duration
+	MaxIdleConnsPerHost   int
+}
+
+func NewTransport(settings TransportSettings) *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   orDefault(settings.DialTimeout, defaultDialTimeout),
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSHandshakeTimeout:   orDefault(settings.TLSHandshakeTimeout, defaultTLSHandshakeTimeout),
+		ResponseHeaderTimeout: orDefault(settings.ResponseHeaderTimeout, defaultResponseHeaderTimeout),
+		IdleConnTimeout:       orDefault(settings.IdleConnTimeout, defaultIdleConnTimeout),
+		MaxIdleConnsPerHost:   orDefaultInt(settings.MaxIdleConnsPerHost, defaultMaxIdleConnsPerHost),
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
+
+func orDefault(value time.Duration, defaultValue time.Duration) time.Duration {
+	if value <= 0 {
+		return defaultValue
+	}
+	return value
+}
+
+func orDefaultInt(value int, defaultValue int) int {
+	if value <= 0 {
+		return defaultValue
+	}
+	return value
+}
@@ -0,0 +1,291 @@
+package routing
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+)
+
+// ValueMatch requires the header or query parameter to be present,
+// and to be equal to the value when it's not empty
+type ValueMatch struct {
+	Name  string
+	Value string
+}
+
+// Route is matched by path pattern as the http.ServeMux does: pattern with trailing slash
+// matches the whole subtree, otherwise the path must be equal. Empty conditions match any request.
+// Hosts may contain wildcard subdomains as '*.example.com'.
+type Route struct {
+	Pattern string
+	Hosts   []string
+	Methods []string
+	Headers []ValueMatch
+	Query   []ValueMatch
+	Handler http.Handler
+}
+
+// Multiplexer chooses the most specific matching route: exact host over wildcard host over any host,
+// then longer path pattern, then routes restricted by method, then routes with more header
+// and query conditions. Routes equal by these rules are matched in registration order.
+type Multiplexer struct {
+	routes []*route
+}
+
+type route struct {
+	Route
+	order       int
+	exactHosts  map[string]bool
+	wildcards   []string
+	methods     map[string]bool
+	description string
+}
+
+func NewMultiplexer() *Multiplexer {
+	return &Multiplexer{}
+}
+
+func (multiplexer *Multiplexer) Handle(newRoute Route) error {
+	if newRoute.Pattern == "" || newRoute.Pattern[0] != '/' {
+		return fmt.Errorf("route pattern '%v' must start with '/'", newRoute.Pattern)
+	}
+	if newRoute.Handler == nil {
+		return fmt.Errorf("route '%v' handler is empty", newRoute.Pattern)
+	}
+
+	compiled := &route{
+		Route:      newRoute,
+		order:      len(multiplexer.routes),
+		exactHosts: make(map[string]bool),
+		methods:    make(map[string]bool),
+	}
+	for _, host := range newRoute.Hosts {
+		host = strings.ToLower(host)
+		if strings.HasPrefix(host, "*.") {
+			compiled.wildcards = append(compiled.wildcards, host[1:])
+		} else {
+			compiled.exactHosts[host] = true
+		}
+	}
+	for _, method := range newRoute.Methods {
+		compiled.methods[strings.ToUpper(method)] = true
+	}
+	compiled.description = compiled.describe()
+
+	for _, existing := range multiplexer.routes {
+		if existing.description == compiled.description {
+			return fmt.Errorf("route %v is already registered", compiled.description)
+		}
+	}
+
+	multiplexer.routes = append(multiplexer.routes, compiled)
+	sort.SliceStable(multiplexer.routes, func(i, j int) bool {
+		return multiplexer.routes[i].precedes(multiplexer.routes[j])
+	})
+	return nil
+}
+
+func (multiplexer *Multiplexer) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	if request.RequestURI == "*" {
+		writer.Header().Set("Connection", "close")
+		writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// Routes are matched by the clean path only, so the upstream must not receive another one
+	requestPath := cleanPath(request.URL.Path)
+	if requestPath != request.URL.Path && request.Method != http.MethodConnect {
+		cleaned := *request.URL
+		cleaned.Path = requestPath
+		cleaned.RawPath = ""
+		http.Redirect(writer, request, cleaned.String(), http.StatusMovedPermanently)
+		return
+	}
+
+	host := requestHost(request)
+	var allowed []string
+	var chosen *route
+	var chosenHost hostMatch
+	for _, candidate := range multiplexer.routes {
+		matchedHost := candidate.matchHost(host)
+		if !matchedHost.found || !candidate.matchesPath(requestPath) {
+			continue
+		}
+		if !candidate.matchesHeaders(request) || !candidate.matchesQuery(request) {
+			continue
+		}
+		if !candidate.matchesMethod(request.Method) {
+			allowed = append(allowed, candidate.Methods...)
+			continue
+		}
+		// Routes are sorted by the rules following the host, the first one of the best host match wins
+		if chosen == nil || matchedHost.precedes(chosenHost) {
+			chosen = candidate
+			chosenHost = matchedHost
+		}
+	}
+	if chosen != nil {
+		chosen.Handler.ServeHTTP(writer, request)
+		return
+	}
+
+	if len(allowed) > 0 {
+		writer.Header().Set("Allow", strings.Join(allowed, ", "))
+		http.Error(writer, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if multiplexer.hasSubtree(host, requestPath+"/") {
+		// Same as http.ServeMux, '/tree' is redirected to the registered '/tree/'
+		subtree := *request.URL
+		subtree.Path = requestPath + "/"
+		http.Redirect(writer, request, subtree.String(), http.StatusMovedPermanently)
+		return
+	}
+	http.NotFound(writer, request)
+}
+
+func (multiplexer *Multiplexer) hasSubtree(host string, subtreePath string) bool {
+	for _, candidate := range multiplexer.routes {
+		if candidate.Pattern == subtreePath && candidate.matchHost(host).found {
+			return true
+		}
+	}
+	return false
+}
+
+// precedes orders the routes by the rules following the host,
+// the host precedence depends on the request host the route is matched by
+func (candidate *route) precedes(other *route) bool {
+	if len(candidate.Pattern) != len(other.Pattern) {
+		return len(candidate.Pattern) > len(other.Pattern)
+	}
+	if (len(candidate.methods) > 0) != (len(other.methods) > 0) {
+		return len(candidate.methods) > 0
+	}
+	conditions := len(candidate.Headers) + len(candidate.Query)
+	otherConditions := len(other.Headers) + len(other.Query)
+	if conditions != otherConditions {
+		return conditions > otherConditions
+	}
+	return candidate.order < other.order
+}
+
+type hostRank int
+
+const (
+	anyHostRank hostRank = iota
+	wildcardHostRank
+	exactHostRank
+)
+
+// hostMatch is the most specific of the route hosts matching the request host
+type hostMatch struct {
+	found  bool
+	rank   hostRank
+	length int
+}
+
+// precedes prefers exact host over wildcard host over any host, then the longer wildcard
+func (match hostMatch) precedes(other hostMatch) bool {
+	if match.rank != other.rank {
+		return match.rank > other.rank
+	}
+	return match.length > other.length
+}
+
+func (candidate *route) matchHost(host string) hostMatch {
+	if len(candidate.Hosts) == 0 {
+		return hostMatch{found: true, rank: anyHostRank}
+	}
+	if candidate.exactHosts[host] {
+		return hostMatch{found: true, rank: exactHostRank, length: len(host)}
+	}
+	match := hostMatch{}
+	for _, suffix := range candidate.wildcards {
+		if strings.HasSuffix(host, suffix) && len(host) > len(suffix) && len(suffix) > match.length {
+			match = hostMatch{found: true, rank: wildcardHostRank, length: len(suffix)}
+		}
+	}
+	return match
+}
+
+func (candidate *route) matchesPath(requestPath string) bool {
+	if strings.HasSuffix(candidate.Pattern, "/") {
+		return strings.HasPrefix(requestPath, candidate.Pattern)
+	}
+	return requestPath == candidate.Pattern
+}
+
+func (candidate *route) matchesMethod(method string) bool {
+	return len(candidate.methods) == 0 || candidate.methods[method]
+}
+
+func (candidate *route) matchesHeaders(request *http.Request) bool {
+	for _, match := range candidate.Headers {
+		values, found := request.Header[http.CanonicalHeaderKey(match.Name)]
+		if !found || !containsValue(values, match.Value) {
+			return false
+		}
+	}
+	return true
+}
+
+func (candidate *route) matchesQuery(request *http.Request) bool {
+	query := request.URL.Query()
+	for _, match := range candidate.Query {
+		values, found := query[match.Name]
+		if !found || !containsValue(values, match.Value) {
+			return false
+		}
+	}
+	return true
+}
+
+func (candidate *route) describe() string {
+	return fmt.Sprintf(
+		"pattern: %v; hosts: %v; methods: %v; headers: %v; query: %v",
+		candidate.Pattern,
+		candidate.Hosts,
+		candidate.Methods,
+		candidate.Headers,
+		candidate.Query,
+	)
+}
+
+func containsValue(values []string, expected string) bool {
+	if expected == "" {
+		return true
+	}
+	for _, value := range values {
+		if value == expected {
+			return true
+		}
+	}
+	return false
+}
+
+func requestHost(request *http.Request) string {
+	host := strings.ToLower(request.Host)
+	if withoutPort, _, err := net.SplitHostPort(host); err == nil {
+		return withoutPort
+	}
+	return host
+}
+
+// cleanPath removes '.' and '..' elements, keeping the trailing slash
+func cleanPath(requestPath string) string {
+	if requestPath == "" {
+		return "/"
+	}
+	if requestPath[0] != '/' {
+		requestPath = "/" + requestPath
+	}
+	cleaned := path.Clean(requestPath)
+	if strings.HasSuffix(requestPath, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
@@ -0,0 +1,169 @@
+package routing
+
+import (
+	"github.com/magiconair/properties/assert"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestPathMatching(t *testing.T) {
+	// Given
+	multiplexer := createMultiplexer(t,
+		Route{Pattern: "/api/"},
+		Route{Pattern: "/api/v2/"},
+		Route{Pattern: "/login"},
+	)
+
+	// Then
+	assert.Equal(t, serve(multiplexer, "GET", "http://localhost/api/users"), "/api/")
+	assert.Equal(t, serve(multiplexer, "GET", "http://localhost/api/v2/users"), "/api/v2/")
+	assert.Equal(t, serve(multiplexer, "GET", "http://localhost/login"), "/login")
+	assert.Equal(t, serve(multiplexer, "GET", "http://localhost/login/other"), "404")
+	assert.Equal(t, serve(multiplexer, "GET", "http://localhost/api"), "301")
+	assert.Equal(t, serve(multiplexer, "GET", "http://localhost/api/v2/../../login"), "301")
+}
+
+func TestHostMatching(t *testing.T) {
+	// Given
+	multiplexer := createMultiplexer(t,
+		Route{Pattern: "/", Hosts: []string{"*.example.com"}, Handler: named("wildcard")},
+		Route{Pattern: "/", Hosts: []string{"admin.example.com"}, Handler: named("admin")},
+		Route{Pattern: "/", Hosts: []string{"*.eu.example.com"}, Handler: named("eu-wildcard")},
+		Route{Pattern: "/", Handler: named("any")},
+	)
+
+	// Then
+	assert.Equal(t, serve(multiplexer, "GET", "http://admin.example.com/"), "admin")
+	assert.Equal(t, serve(multiplexer, "GET", "http://ADMIN.example.com:8080/"), "admin")
+	assert.Equal(t, serve(multiplexer, "GET", "http://shop.example.com/"), "wildcard")
+	assert.Equal(t, serve(multiplexer, "GET", "http://shop.eu.example.com/"), "eu-wildcard")
+	assert.Equal(t, serve(multiplexer, "GET", "http://example.com/"), "any")
+	assert.Equal(t, serve(multiplexer, "GET", "http://other.org/"), "any")
+}
+
+func TestHostPrecedence(t *testing.T) {
+	// Given
+	multiplexer := createMultiplexer(t,
+		Route{Pattern: "/", Hosts: []string{"www.example.com", "*.example.org"}, Handler: named("mixed")},
+		Route{Pattern: "/shop/", Hosts: []string{"*.example.org"}, Handler: named("shop-wildcard")},
+		Route{Pattern: "/", Hosts: []string{"api.example.org"}, Handler: named("api")},
+		Route{Pattern: "/shop/cart/", Handler: named("any")},
+	)
+
+	// Then
+	assert.Equal(t, serve(multiplexer, "GET", "http://www.example.com/shop/cart/items"), "mixed")
+	assert.Equal(t, serve(multiplexer, "GET", "http://eu.example.org/shop/cart/items"), "shop-wildcard")
+	assert.Equal(t, serve(multiplexer, "GET", "http://eu.example.org/"), "mixed")
+	assert.Equal(t, serve(multiplexer, "GET", "http://api.example.org/shop/cart/items"), "api")
+	assert.Equal(t, serve(multiplexer, "GET", "http://other.org/shop/cart/items"), "any")
+}
+
+func TestMethodMatching(t *testing.T) {
+	// Given
+	multiplexer := createMultiplexer(t,
+		Route{Pattern: "/api/", Methods: []string{"GET", "HEAD"}, Handler: named("read")},
+		Route{Pattern: "/api/", Methods: []string{"post"}, Handler: named("write")},
+		Route{Pattern: "/only-get", Methods: []string{"GET"}},
+	)
+
+	// Then
+	assert.Equal(t, serve(multiplexer, "GET", "http://localhost/api/users"), "read")
+	assert.Equal(t, serve(multiplexer, "POST", "http://localhost/api/users"), "write")
+	assert.Equal(t, serve(multiplexer, "DELETE", "http://localhost/api/users"), "405")
+
+	w := httptest.NewRecorder()
+	multiplexer.ServeHTTP(w, httptest.NewRequest("PUT", "http://localhost/only-get", nil))
+	assert.Equal(t, w.Header().Get("Allow"), "GET")
+}
+
+func TestHeaderAndQueryMatching(t *testing.T) {
+	// Given
+	multiplexer := createMultiplexer(t,
+		Route{Pattern: "/api/", Handler: named("default")},
+		Route{Pattern: "/api/", Headers: []ValueMatch{{Name: "x-api-version", Value: "2"}}, Handler: named("version-2")},
+		Route{Pattern: "/api/", Query: []ValueMatch{{Name: "debug"}}, Handler: named("debug")},
+	)
+
+	// When
+	versioned := httptest.NewRequest("GET", "http://localhost/api/users", nil)
+	versioned.Header.Set("X-Api-Version", "2")
+	otherVersion := httptest.NewRequest("GET", "http://localhost/api/users", nil)
+	otherVersion.Header.Set("X-Api-Version", "3")
+
+	// Then
+	assert.Equal(t, serveRequest(multiplexer, versioned), "version-2")
+	assert.Equal(t, serveRequest(multiplexer, otherVersion), "default")
+	assert.Equal(t, serve(multiplexer, "GET", "http://localhost/api/users?debug"), "debug")
+	assert.Equal(t, serve(multiplexer, "GET", "http://localhost/api/users"), "default")
+}
+
+func TestPrecedenceDoesNotDependOnOrder(t *testing.T) {
+	routes := []Route{
+		{Pattern: "/", Handler: named("root")},
+		{Pattern: "/api/", Handler: named("api")},
+		{Pattern: "/api/", Methods: []string{"GET"}, Handler: named("api-get")},
+		{Pattern: "/api/", Hosts: []string{"*.example.com"}, Handler: named("api-wildcard")},
+	}
+	reversed := []Route{routes[3], routes[2], routes[1], routes[0]}
+
+	for _, ordered := range [][]Route{routes, reversed} {
+		// Given
+		multiplexer := createMultiplexer(t, ordered...)
+
+		// Then
+		assert.Equal(t, serve(multiplexer, "GET", "http://localhost/api/users"), "api-get")
+		assert.Equal(t, serve(multiplexer, "POST", "http://localhost/api/users"), "api")
+		assert.Equal(t, serve(multiplexer, "POST", "http://shop.example.com/api/users"), "api-wildcard")
+		assert.Equal(t, serve(multiplexer, "POST", "http://localhost/pages"), "root")
+	}
+}
+
+func TestDuplicateRoute(t *testing.T) {
+	// Given
+	multiplexer := createMultiplexer(t, Route{Pattern: "/api/", Methods: []string{"GET"}})
+
+	// When
+	err := multiplexer.Handle(Route{Pattern: "/api/", Methods: []string{"GET"}, Handler: named("duplicate")})
+
+	// Then
+	if err == nil {
+		t.Fatalf("Duplicate route must be rejected")
+	}
+}
+
+// Internal
+
+func createMultiplexer(t *testing.T, routes ...Route) *Multiplexer {
+	multiplexer := NewMultiplexer()
+	for _, route := range routes {
+		if route.Handler == nil {
+			route.Handler = named(route.Pattern)
+		}
+		if err := multiplexer.Handle(route); err != nil {
+			t.Fatalf("Route registration error: %v", err)
+		}
+	}
+	return multiplexer
+}
+
+func named(name string) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		_, _ = writer.Write([]byte(name))
+	})
+}
+
+func serve(multiplexer *Multiplexer, method string, target string) string {
+	return serveRequest(multiplexer, httptest.NewRequest(method, target, nil))
+}
+
+// serveRequest returns the name of the matched route or the status code
+func serveRequest(multiplexer *Multiplexer, request *http.Request) string {
+	w := httptest.NewRecorder()
+	multiplexer.ServeHTTP(w, request)
+	if w.Code != http.StatusOK {
+		return strconv.Itoa(w.Code)
+	}
+	return w.Body.String()
+}
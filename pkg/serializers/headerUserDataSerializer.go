@@ -0,0 +1,85 @@
+package serializers
+
+import (
+	"fmt"
+	"github.com/Alcereo/ordinator/pkg/common"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// DefaultUserDataHeaders maps user data fields to the headers legacy backends usually expect
+var DefaultUserDataHeaders = map[string]string{
+	"identifier": "X-User-Id",
+	"username":   "X-User-Name",
+	"email":      "X-User-Email",
+	"picture":    "X-User-Picture",
+	"locale":     "X-User-Locale",
+	"groups":     "X-User-Groups",
+}
+
+var userDataFields = map[string]func(*common.UserData) string{
+	"identifier": func(userData *common.UserData) string { return userData.Identifier },
+	"username":   func(userData *common.UserData) string { return userData.Username },
+	"email":      func(userData *common.UserData) string { return userData.Email },
+	"picture":    func(userData *common.UserData) string { return userData.Picture },
+	"locale":     func(userData *common.UserData) string { return userData.Locale },
+	"groups":     func(userData *common.UserData) string { return strings.Join(userData.Groups, ",") },
+}
+
+// headerUserDataSerializer writes each user data field to its own plain header
+type headerUserDataSerializer struct {
+	headers map[string]string
+}
+
+// NewHeaderUserDataSerializer overrides the default headers of the fields by the given ones,
+// empty header name stops sending the field.
+func NewHeaderUserDataSerializer(headers map[string]string) (*headerUserDataSerializer, error) {
+	fieldHeaders := make(map[string]string, len(DefaultUserDataHeaders))
+	for field, header := range DefaultUserDataHeaders {
+		fieldHeaders[field] = header
+	}
+	for field, header := range headers {
+		field = strings.ToLower(field)
+		if _, found := userDataFields[field]; !found {
+			return nil, fmt.Errorf("unknown user data field '%v'", field)
+		}
+		if header == "" {
+			delete(fieldHeaders, field)
+		} else {
+			fieldHeaders[field] = http.CanonicalHeaderKey(header)
+		}
+	}
+	return &headerUserDataSerializer{
+		headers: fieldHeaders,
+	}, nil
+}
+
+func (serializer *headerUserDataSerializer) Headers(userData *common.UserData) (http.Header, error) {
+	headers := http.Header{}
+	for field, header := range serializer.headers {
+		if value := headerValue(userDataFields[field](userData)); value != "" {
+			headers.Set(header, value)
+		}
+	}
+	return headers, nil
+}
+
+func (serializer *headerUserDataSerializer) HeaderNames() []string {
+	names := make([]string, 0, len(serializer.headers))
+	for _, header := range serializer.headers {
+		names = append(names, header)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// headerValue drops control characters, provider data must not break the request headers
+func headerValue(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r < ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, value)
+}
@@ -0,0 +1,37 @@
+package serializers
+
+import (
+	"github.com/Alcereo/ordinator/pkg/common"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSerializeHeaders(t *testing.T) {
+	serializer, err := NewHeaderUserDataSerializer(map[string]string{
+		"email":   "x-mail",
+		"picture": "",
+	})
+	assert.Empty(t, err)
+
+	headers, err := serializer.Headers(&common.UserData{
+		Identifier: "user-1",
+		Username:   "some-name\r\nX-Injected: true",
+		Email:      "some@mail.ru",
+		Picture:    "picture-url",
+		Groups:     []string{"staff", "admins"},
+	})
+	assert.Empty(t, err)
+
+	assert.Equal(t, "user-1", headers.Get("X-User-Id"))
+	assert.Equal(t, "some-nameX-Injected: true", headers.Get("X-User-Name"))
+	assert.Equal(t, "some@mail.ru", headers.Get("X-Mail"))
+	assert.Equal(t, "staff,admins", headers.Get("X-User-Groups"))
+	assert.Empty(t, headers.Get("X-User-Picture"))
+	assert.Empty(t, headers.Get("X-User-Locale"))
+	assert.Equal(t, []string{"X-Mail", "X-User-Groups", "X-User-Id", "X-User-Locale", "X-User-Name"}, serializer.HeaderNames())
+}
+
+func TestUnknownUserDataField(t *testing.T) {
+	_, err := NewHeaderUserDataSerializer(map[string]string{"password": "X-Password"})
+	assert.NotEmpty(t, err)
+}
@@ -1,27 +1,159 @@
 package serializers
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
 	"github.com/Alcereo/ordinator/pkg/common"
+	"github.com/Alcereo/ordinator/pkg/jwks"
 	"github.com/dgrijalva/jwt-go"
+	"time"
 )
 
+// DefaultJwtLifetime is short, the token is issued for each proxied request
+const DefaultJwtLifetime = 5 * time.Minute
+
+// JwtSigner signs tokens with a shared HS256 secret or with an RS256, ES256 or EdDSA private key
+type JwtSigner struct {
+	method    jwt.SigningMethod
+	key       interface{}
+	KeyId     string
+	publicKey crypto.PublicKey
+}
+
+func NewHmacSigner(secret string, keyId string) *JwtSigner {
+	return &JwtSigner{
+		method: jwt.SigningMethodHS256,
+		key:    []byte(secret),
+		KeyId:  keyId,
+	}
+}
+
+// NewPemSigner reads PKCS#8, PKCS#1 RSA or SEC 1 EC private key.
+// Empty key id is replaced with the public key thumbprint.
+func NewPemSigner(algorithm string, pemData []byte, keyId string) (*JwtSigner, error) {
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return nil, fmt.Errorf("PEM block not found")
+	}
+	privateKey, err := parsePrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	signer := &JwtSigner{key: privateKey}
+	switch key := privateKey.(type) {
+	case *rsa.PrivateKey:
+		signer.method, signer.publicKey = jwt.SigningMethodRS256, &key.PublicKey
+	case *ecdsa.PrivateKey:
+		if key.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("ES256 requires P-256 key, got %v", key.Curve.Params().Name)
+		}
+		signer.method, signer.publicKey = jwt.SigningMethodES256, &key.PublicKey
+	case ed25519.PrivateKey:
+		signer.method, signer.publicKey = jwks.SigningMethodEdDSA, key.Public()
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", privateKey)
+	}
+	if signer.method.Alg() != algorithm {
+		return nil, fmt.Errorf("private key doesn't match algorithm %v", algorithm)
+	}
+
+	publicKey, err := signer.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	signer.KeyId = publicKey.KeyId
+	if keyId != "" {
+		signer.KeyId = keyId
+	}
+	return signer, nil
+}
+
+func parsePrivateKey(der []byte) (interface{}, error) {
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("private key is neither PKCS#8, PKCS#1 nor SEC 1")
+}
+
+// PublicKey returns the key to publish in JWKS, shared secrets are never published
+func (signer *JwtSigner) PublicKey() (*jwks.JsonWebKey, error) {
+	if signer.publicKey == nil {
+		return nil, fmt.Errorf("%v signer doesn't have a public key", signer.method.Alg())
+	}
+	return jwks.NewJsonWebKey(signer.KeyId, signer.method.Alg(), signer.publicKey)
+}
+
+func (signer *JwtSigner) Asymmetric() bool {
+	return signer.publicKey != nil
+}
+
+// JwtClaimsSettings of the standard claims. Issuer and audience are omitted when empty.
+type JwtClaimsSettings struct {
+	Issuer   string
+	Audience []string
+	Lifetime time.Duration
+}
+
 type jwtUserDataSerializer struct {
-	hmacSampleSecret string
+	signer   *JwtSigner
+	settings JwtClaimsSettings
+	now      func() time.Time
 }
 
-func NewJwtUserDataSerializer(hmacSampleSecret string) *jwtUserDataSerializer {
+func NewJwtUserDataSerializer(signer *JwtSigner, settings JwtClaimsSettings) *jwtUserDataSerializer {
+	if settings.Lifetime <= 0 {
+		settings.Lifetime = DefaultJwtLifetime
+	}
 	return &jwtUserDataSerializer{
-		hmacSampleSecret: hmacSampleSecret,
+		signer:   signer,
+		settings: settings,
+		now:      time.Now,
 	}
 }
 
+func (serializer *jwtUserDataSerializer) Signer() *JwtSigner {
+	return serializer.signer
+}
+
 func (serializer *jwtUserDataSerializer) Serialize(userData *common.UserData) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+	now := serializer.now()
+	claims := jwt.MapClaims{
 		"identifier": userData.Identifier,
 		"username":   userData.Username,
 		"email":      userData.Email,
 		"locale":     userData.Locale,
 		"picture":    userData.Picture,
-	})
-	return token.SignedString([]byte(serializer.hmacSampleSecret))
+		"sub":        userData.Identifier,
+		"iat":        now.Unix(),
+		"exp":        now.Add(serializer.settings.Lifetime).Unix(),
+	}
+	if serializer.settings.Issuer != "" {
+		claims["iss"] = serializer.settings.Issuer
+	}
+	switch len(serializer.settings.Audience) {
+	case 0:
+	case 1:
+		claims["aud"] = serializer.settings.Audience[0]
+	default:
+		claims["aud"] = serializer.settings.Audience
+	}
+
+	token := jwt.NewWithClaims(serializer.signer.method, claims)
+	if serializer.signer.KeyId != "" {
+		token.Header["kid"] = serializer.signer.KeyId
+	}
+	return token.SignedString(serializer.signer.key)
 }